@@ -4,13 +4,13 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"fmt"
+	"github.com/sp41414/goHttp/pkg/client"
 	"github.com/sp41414/goHttp/pkg/headers"
 	"github.com/sp41414/goHttp/pkg/request"
 	"github.com/sp41414/goHttp/pkg/response"
 	"github.com/sp41414/goHttp/pkg/server"
 	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
@@ -23,25 +23,20 @@ const port = 9000
 func handler(w *response.Writer, req *request.Request) {
 	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/") {
 		trimmed := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-		res, err := http.Get(fmt.Sprintf("https://httpbin.org/%s", trimmed))
+		res, err := client.Get(fmt.Sprintf("https://httpbin.org/%s", trimmed))
 		if err != nil {
 			log.Println(err)
 			return
 		}
+		defer res.Body.Close()
 		w.WriteStatusLine(response.StatusCode(res.StatusCode))
 
 		h := headers.NewHeaders()
-		for k, v := range res.Header {
-			loweredK := strings.ToLower(k)
-			if loweredK == "content-length" || loweredK == "transfer-encoding" {
+		for k, v := range res.Headers {
+			if k == "content-length" || k == "transfer-encoding" || k == "connection" {
 				continue
 			}
-
-			err := h.Add(loweredK, strings.Join(v, ", "))
-			if err != nil {
-				log.Println(err)
-				return
-			}
+			h[k] = v
 		}
 		err = h.Add("Transfer-Encoding", "chunked")
 		if err != nil {
@@ -58,24 +53,25 @@ func handler(w *response.Writer, req *request.Request) {
 		chunk := make([]byte, 1024)
 		buf := bytes.Buffer{}
 		for {
-			n, err := res.Body.Read(chunk)
-			if err != nil {
-				if err == io.EOF {
-					break
+			n, readErr := res.Body.Read(chunk)
+			if n > 0 {
+				n, err = w.WriteChunkedBody(chunk[:n])
+				if err != nil {
+					log.Println(err)
+					return
 				}
-				log.Println(err)
-				return
-			}
 
-			n, err = w.WriteChunkedBody(chunk[:n])
-			if err != nil {
-				log.Println(err)
-				return
+				_, err = buf.Write(chunk[:n])
+				if err != nil {
+					log.Println(err)
+					return
+				}
 			}
-
-			_, err = buf.Write(chunk[:n])
-			if err != nil {
-				log.Println(err)
+			if readErr != nil {
+				if readErr == io.EOF {
+					break
+				}
+				log.Println(readErr)
 				return
 			}
 		}
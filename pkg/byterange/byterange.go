@@ -0,0 +1,302 @@
+// Package byterange implements range requests as described in RFC 9110
+// section 14: parsing the Range header, evaluating If-Range, and answering
+// with 206 Partial Content, multipart/byteranges or 416 Range Not
+// Satisfiable.
+//
+// ServeContent answers a request from any io.ReadSeeker:
+//
+//	func handler(w *response.Writer, req *request.Request) {
+//		f, err := os.Open("video.mp4")
+//		if err != nil {
+//			return
+//		}
+//		defer f.Close()
+//		byterange.ServeContent(w, req, f, headers.Headers{"content-type": "video/mp4"})
+//	}
+package byterange
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/conditional"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxRanges is the largest number of ranges served in one response. Larger
+// requests are answered with the whole representation, as RFC 9110 section
+// 14.2 allows, since many tiny ranges cost more to serve than they save.
+const maxRanges = 100
+
+var (
+	// ErrInvalid is returned by Parse for a Range header that is not a
+	// valid bytes range set. Servers ignore such a header.
+	ErrInvalid = errors.New("Error: invalid range")
+	// ErrUnsatisfiable is returned by Parse when none of the ranges overlap
+	// the representation. Servers answer with 416 Range Not Satisfiable.
+	ErrUnsatisfiable = errors.New("Error: range not satisfiable")
+)
+
+// Range is a satisfiable byte range of a representation.
+type Range struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange returns the Content-Range header value of r for a
+// representation of size bytes, e.g. "bytes 0-499/1234".
+func (r Range) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// Parse parses a Range header value for a representation of size bytes,
+// e.g. "bytes=0-499, -500". It returns the satisfiable ranges in the order
+// requested, with last positions beyond the end and suffix ranges longer
+// than the representation shortened to fit.
+func Parse(header string, size int64) ([]Range, error) {
+	unit, set, ok := strings.Cut(header, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, ErrInvalid
+	}
+
+	var ranges []Range
+	valid := false
+	for _, spec := range strings.Split(set, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, ErrInvalid
+		}
+
+		if first == "" {
+			// suffix range: the last n bytes
+			n, ok := parsePos(last)
+			if !ok {
+				return nil, ErrInvalid
+			}
+			valid = true
+			if n > 0 && size > 0 {
+				n = min(n, size)
+				ranges = append(ranges, Range{Start: size - n, Length: n})
+			}
+			continue
+		}
+
+		start, ok := parsePos(first)
+		if !ok {
+			return nil, ErrInvalid
+		}
+		end := size - 1
+		if last != "" {
+			if end, ok = parsePos(last); !ok || end < start {
+				return nil, ErrInvalid
+			}
+			end = min(end, size-1)
+		}
+		valid = true
+		if start < size {
+			ranges = append(ranges, Range{Start: start, Length: end - start + 1})
+		}
+	}
+
+	if !valid {
+		return nil, ErrInvalid
+	}
+	if len(ranges) == 0 {
+		return nil, ErrUnsatisfiable
+	}
+	return ranges, nil
+}
+
+// parsePos parses a non-negative decimal position.
+func parsePos(s string) (int64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// ServeContent writes a response to req with the content read from content
+// and the headers h, which describe the representation, e.g. Content-Type,
+// ETag and Last-Modified. Its size is found by seeking to the end.
+//
+// A GET request with a satisfiable Range header, and a matching If-Range if
+// present, gets 206 Partial Content: a single range is sent with a
+// Content-Range header, several as multipart/byteranges. Unsatisfiable
+// ranges get 416 Range Not Satisfiable. Any other request, including one
+// with an invalid Range header, gets the whole content with 200 OK. Every
+// response advertises "Accept-Ranges: bytes".
+func ServeContent(w *response.Writer, req *request.Request, content io.ReadSeeker, h headers.Headers) error {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	h = h.LowerKeys()
+	h["accept-ranges"] = "bytes"
+
+	var ranges []Range
+	if header := req.Headers.Get("Range"); header != "" && req.RequestLine.Method == "GET" && ifRange(req.Headers, h) {
+		ranges, err = Parse(header, size)
+		if errors.Is(err, ErrUnsatisfiable) {
+			h["content-range"] = fmt.Sprintf("bytes */%d", size)
+			h["content-length"] = "0"
+			delete(h, "content-type")
+			if err := w.WriteStatusLine(response.RANGE_NOT_SATISFIABLE); err != nil {
+				return err
+			}
+			return w.WriteHeaders(h)
+		}
+		if len(ranges) > maxRanges || sumLength(ranges) > size {
+			ranges = nil
+		}
+	}
+
+	send := req.RequestLine.Method != "HEAD"
+	switch len(ranges) {
+	case 0:
+		h["content-length"] = strconv.FormatInt(size, 10)
+		if err := writeHead(w, response.OK, h); err != nil || !send {
+			return err
+		}
+		_, err = io.CopyN(response.BodyWriter(w), content, size)
+		return err
+	case 1:
+		r := ranges[0]
+		h["content-range"] = r.ContentRange(size)
+		h["content-length"] = strconv.FormatInt(r.Length, 10)
+		if err := writeHead(w, response.PARTIAL_CONTENT, h); err != nil {
+			return err
+		}
+		return copyRange(response.BodyWriter(w), content, r)
+	default:
+		return writeMultipart(w, content, ranges, size, h)
+	}
+}
+
+// writeMultipart sends ranges of content as a multipart/byteranges body,
+// see RFC 9110 section 14.6.
+func writeMultipart(w *response.Writer, content io.ReadSeeker, ranges []Range, size int64, h headers.Headers) error {
+	boundary, err := randomBoundary()
+	if err != nil {
+		return err
+	}
+
+	contentType := h["content-type"]
+	partHeader := func(r Range) string {
+		head := "--" + boundary + "\r\n"
+		if contentType != "" {
+			head += "content-type: " + contentType + "\r\n"
+		}
+		return head + "content-range: " + r.ContentRange(size) + "\r\n\r\n"
+	}
+	closing := "--" + boundary + "--\r\n"
+
+	// the length is known up front, so the body does not need chunking
+	var length int64
+	for i, r := range ranges {
+		if i > 0 {
+			length += 2
+		}
+		length += int64(len(partHeader(r))) + r.Length
+	}
+	length += 2 + int64(len(closing))
+
+	h["content-type"] = "multipart/byteranges; boundary=" + boundary
+	h["content-length"] = strconv.FormatInt(length, 10)
+	if err := writeHead(w, response.PARTIAL_CONTENT, h); err != nil {
+		return err
+	}
+
+	body := response.BodyWriter(w)
+	for i, r := range ranges {
+		if i > 0 {
+			if _, err := io.WriteString(body, "\r\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(body, partHeader(r)); err != nil {
+			return err
+		}
+		if err := copyRange(body, content, r); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(body, "\r\n"+closing)
+	return err
+}
+
+// ifRange reports whether the ranges of a request with headers reqHeaders
+// apply to the representation with headers h, as decided by its If-Range
+// header, see RFC 9110 section 13.1.5. An entity tag must match the ETag
+// with the strong comparison, and a date must equal Last-Modified exactly.
+func ifRange(reqHeaders, h headers.Headers) bool {
+	value := strings.TrimSpace(reqHeaders.Get("If-Range"))
+	if value == "" {
+		return true
+	}
+	if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "W/") {
+		return conditional.StrongMatch(value, h["etag"])
+	}
+
+	t, err := conditional.ParseTime(value)
+	if err != nil {
+		return false
+	}
+	modified, err := conditional.ParseTime(h["last-modified"])
+	return err == nil && t.Equal(modified)
+}
+
+// writeHead writes the status line and the headers h.
+func writeHead(w *response.Writer, statusCode response.StatusCode, h headers.Headers) error {
+	if err := w.WriteStatusLine(statusCode); err != nil {
+		return err
+	}
+	return w.WriteHeaders(h)
+}
+
+// copyRange copies the range r of content to dst.
+func copyRange(dst io.Writer, content io.ReadSeeker, r Range) error {
+	if _, err := content.Seek(r.Start, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.CopyN(dst, content, r.Length)
+	return err
+}
+
+// sumLength returns the total length of ranges.
+func sumLength(ranges []Range) int64 {
+	var sum int64
+	for _, r := range ranges {
+		sum += r.Length
+	}
+	return sum
+}
+
+// randomBoundary returns a multipart boundary that is unlikely to appear in
+// the content.
+func randomBoundary() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,146 @@
+package byterange
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/internal/handlertest"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		header string
+		ranges []Range
+		err    error
+	}{
+		// Test: First and last positions, open-ended and suffix ranges
+		{"bytes=0-499", []Range{{0, 500}}, nil},
+		{"bytes=500-", []Range{{500, 500}}, nil},
+		{"bytes=-200", []Range{{800, 200}}, nil},
+		{"Bytes = 0-0, -1", []Range{{0, 1}, {999, 1}}, nil},
+		{"bytes=10-20,,30-40", []Range{{10, 11}, {30, 11}}, nil},
+		// Test: Ranges beyond the end are shortened
+		{"bytes=900-2000", []Range{{900, 100}}, nil},
+		{"bytes=-5000", []Range{{0, 1000}}, nil},
+		// Test: Unsatisfiable ranges are dropped
+		{"bytes=0-9, 1000-1100", []Range{{0, 10}}, nil},
+		{"bytes=1000-", nil, ErrUnsatisfiable},
+		{"bytes=-0", nil, ErrUnsatisfiable},
+		// Test: Invalid headers
+		{"bytes=", nil, ErrInvalid},
+		{"items=0-1", nil, ErrInvalid},
+		{"bytes=5-1", nil, ErrInvalid},
+		{"bytes=a-b", nil, ErrInvalid},
+		{"bytes=+1-2", nil, ErrInvalid},
+		{"bytes=1", nil, ErrInvalid},
+		{"bytes=-", nil, ErrInvalid},
+		{"bytes=0-1, x", nil, ErrInvalid},
+	}
+	for _, tt := range tests {
+		ranges, err := Parse(tt.header, 1000)
+		assert.ErrorIs(t, err, tt.err, tt.header)
+		assert.Equal(t, tt.ranges, ranges, tt.header)
+	}
+
+	// Test: Nothing is satisfiable in an empty representation
+	_, err := Parse("bytes=0-", 0)
+	assert.ErrorIs(t, err, ErrUnsatisfiable)
+}
+
+const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// serve runs ServeContent for a request with the method and extra header
+// lines, and parses the response.
+func serve(t *testing.T, method string, headerLines ...string) (*response.Response, string) {
+	t.Helper()
+	h := headers.Headers{
+		"Content-Type":  "text/plain",
+		"etag":          `"v1"`,
+		"last-modified": "Fri, 01 Mar 2024 12:00:00 GMT",
+	}
+	return handlertest.Serve(t, func(w *response.Writer, req *request.Request) {
+		require.NoError(t, ServeContent(w, req, strings.NewReader(content), h))
+	}, method, "/file", headerLines...)
+}
+
+func TestServeContent(t *testing.T) {
+	// Test: Without a Range header the whole content is sent
+	res, body := serve(t, "GET")
+	assert.Equal(t, response.OK, res.StatusCode)
+	assert.Equal(t, content, body)
+	assert.Equal(t, "bytes", res.Headers.Get("Accept-Ranges"))
+	assert.Equal(t, "text/plain", res.Headers.Get("Content-Type"))
+
+	// Test: A single range
+	res, body = serve(t, "GET", "Range: bytes=10-15")
+	assert.Equal(t, response.PARTIAL_CONTENT, res.StatusCode)
+	assert.Equal(t, "abcdef", body)
+	assert.Equal(t, "bytes 10-15/36", res.Headers.Get("Content-Range"))
+	assert.Equal(t, int64(6), res.ContentLength)
+
+	// Test: Several ranges are sent as multipart/byteranges
+	res, body = serve(t, "GET", "Range: bytes=0-2, -3")
+	assert.Equal(t, response.PARTIAL_CONTENT, res.StatusCode)
+	assert.Equal(t, int64(len(body)), res.ContentLength)
+	mediaType, params, err := mime.ParseMediaType(res.Headers.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+	mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	var parts []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, "text/plain", part.Header.Get("Content-Type"))
+		parts = append(parts, part.Header.Get("Content-Range")+" "+string(data))
+	}
+	assert.Equal(t, []string{"bytes 0-2/36 012", "bytes 33-35/36 xyz"}, parts)
+
+	// Test: Unsatisfiable ranges get 416 with the size
+	res, body = serve(t, "GET", "Range: bytes=100-200")
+	assert.Equal(t, response.RANGE_NOT_SATISFIABLE, res.StatusCode)
+	assert.Equal(t, "bytes */36", res.Headers.Get("Content-Range"))
+	assert.Empty(t, body)
+
+	// Test: Invalid Range headers are ignored
+	res, body = serve(t, "GET", "Range: bytes=5-1")
+	assert.Equal(t, response.OK, res.StatusCode)
+	assert.Equal(t, content, body)
+
+	// Test: Range only applies to GET
+	res, body = serve(t, "HEAD", "Range: bytes=0-1")
+	assert.Equal(t, response.OK, res.StatusCode)
+	assert.Equal(t, "36", res.Headers.Get("Content-Length"))
+	assert.Empty(t, body)
+
+	// Test: If-Range with the current strong ETag or date applies the range
+	res, _ = serve(t, "GET", "Range: bytes=0-1", `If-Range: "v1"`)
+	assert.Equal(t, response.PARTIAL_CONTENT, res.StatusCode)
+	res, _ = serve(t, "GET", "Range: bytes=0-1", "If-Range: Fri, 01 Mar 2024 12:00:00 GMT")
+	assert.Equal(t, response.PARTIAL_CONTENT, res.StatusCode)
+
+	// Test: A changed or weak validator sends the whole content instead
+	for _, ifRange := range []string{`"v0"`, `W/"v1"`, "Fri, 01 Mar 2024 11:00:00 GMT", "yesterday"} {
+		res, body = serve(t, "GET", "Range: bytes=0-1", "If-Range: "+ifRange)
+		assert.Equal(t, response.OK, res.StatusCode, ifRange)
+		assert.Equal(t, content, body, ifRange)
+	}
+
+	// Test: Overlapping ranges adding up to more than the content are
+	// answered with the whole content
+	res, body = serve(t, "GET", "Range: bytes=0-30, 5-35")
+	assert.Equal(t, response.OK, res.StatusCode)
+	assert.Equal(t, content, body)
+}
@@ -0,0 +1,206 @@
+// Package chunked implements an incremental decoder for the HTTP/1.1 chunked
+// transfer coding described in RFC 9112 section 7.1.
+//
+// The decoder is strict: chunk sizes must be plain hexadecimal digits, every
+// line must end with CRLF, and any framing error is reported instead of being
+// repaired, since lenient chunk parsing is a common source of request
+// smuggling vulnerabilities.
+package chunked
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"strconv"
+)
+
+// maxSizeDigits is the largest number of hex digits accepted in a chunk size,
+// which keeps every size representable as a non-negative int64.
+const maxSizeDigits = 15
+
+// maxSizeLineLength is the longest chunk size line accepted, extensions
+// included, and maxTrailerSize the largest trailer section. They bound the
+// data a caller has to buffer while a line is incomplete.
+const (
+	maxSizeLineLength = 4 << 10
+	maxTrailerSize    = 64 << 10
+)
+
+// decoderState represents the part of the chunked body the decoder expects next.
+type decoderState int
+
+const (
+	stateSize decoderState = iota
+	stateData
+	stateDataEnd
+	stateTrailers
+	stateDone
+)
+
+// Decoder decodes a chunked message body that may arrive in arbitrary pieces.
+type Decoder struct {
+	// Trailers holds the trailer fields received after the last chunk.
+	Trailers headers.Headers
+
+	state     decoderState
+	remaining int64
+	// trailerSize counts the bytes of the trailer section consumed so far.
+	trailerSize int
+}
+
+// NewDecoder creates a Decoder that expects the first chunk size line.
+func NewDecoder() *Decoder {
+	return &Decoder{
+		Trailers: headers.NewHeaders(),
+		state:    stateSize,
+	}
+}
+
+// Done reports whether the last chunk and the trailer section have been decoded.
+func (d *Decoder) Done() bool {
+	return d.state == stateDone
+}
+
+// Decode consumes as much of data as possible, appending decoded chunk data
+// to dst. It returns the extended dst and the number of bytes of data that
+// were consumed. Unconsumed bytes must be passed again, followed by more
+// data, on the next call.
+//
+// Once the message body is complete, Done reports true and Decode consumes
+// nothing further.
+func (d *Decoder) Decode(dst, data []byte) ([]byte, int, error) {
+	consumed := 0
+	for {
+		switch d.state {
+		case stateSize:
+			size, n, err := parseSizeLine(data[consumed:])
+			if err != nil {
+				return dst, consumed, err
+			}
+			if n == 0 {
+				return dst, consumed, nil
+			}
+			consumed += n
+			d.remaining = size
+			if size == 0 {
+				d.state = stateTrailers
+			} else {
+				d.state = stateData
+			}
+		case stateData:
+			n := int64(len(data) - consumed)
+			if n == 0 {
+				return dst, consumed, nil
+			}
+			n = min(n, d.remaining)
+			dst = append(dst, data[consumed:consumed+int(n)]...)
+			consumed += int(n)
+			d.remaining -= n
+			if d.remaining == 0 {
+				d.state = stateDataEnd
+			}
+		case stateDataEnd:
+			rest := data[consumed:]
+			if len(rest) < 2 {
+				if len(rest) == 1 && rest[0] != '\r' {
+					return dst, consumed, fmt.Errorf("invalid chunk: data is not followed by CRLF")
+				}
+				return dst, consumed, nil
+			}
+			if rest[0] != '\r' || rest[1] != '\n' {
+				return dst, consumed, fmt.Errorf("invalid chunk: data is not followed by CRLF")
+			}
+			consumed += 2
+			d.state = stateSize
+		case stateTrailers:
+			n, done, err := d.Trailers.Parse(data[consumed:])
+			if err != nil {
+				return dst, consumed, fmt.Errorf("invalid chunk trailer: %v", err)
+			}
+			if !done && n == 0 {
+				if d.trailerSize+len(data)-consumed > maxTrailerSize {
+					return dst, consumed, fmt.Errorf("invalid chunk trailer: trailer section too large")
+				}
+				return dst, consumed, nil
+			}
+			consumed += n
+			d.trailerSize += n
+			if d.trailerSize > maxTrailerSize {
+				return dst, consumed, fmt.Errorf("invalid chunk trailer: trailer section too large")
+			}
+			if done {
+				d.state = stateDone
+			}
+		case stateDone:
+			return dst, consumed, nil
+		}
+	}
+}
+
+// parseSizeLine parses a chunk size line of the form
+//
+//	chunk-size [ chunk-ext ] CRLF
+//
+// It returns the chunk size and the number of bytes read, which is 0 if the
+// line is not complete yet. Chunk extensions are validated and discarded.
+func parseSizeLine(data []byte) (int64, int, error) {
+	if err := checkBareLF(data); err != nil {
+		return 0, 0, err
+	}
+	idx := bytes.Index(data, []byte("\r\n"))
+	if idx == -1 && len(data) > maxSizeLineLength || idx > maxSizeLineLength {
+		return 0, 0, fmt.Errorf("invalid chunk size: line too long")
+	}
+	if idx == -1 {
+		digits := 0
+		for digits < len(data) && isHexDigit(data[digits]) {
+			digits++
+		}
+		if digits > maxSizeDigits {
+			return 0, 0, fmt.Errorf("invalid chunk size: too long")
+		}
+		return 0, 0, nil
+	}
+	line := data[:idx]
+
+	digits := 0
+	for digits < len(line) && isHexDigit(line[digits]) {
+		digits++
+	}
+	if digits == 0 {
+		return 0, 0, fmt.Errorf("invalid chunk size: %q is not hexadecimal", line)
+	}
+	if digits > maxSizeDigits {
+		return 0, 0, fmt.Errorf("invalid chunk size: too long")
+	}
+
+	ext := bytes.TrimLeft(line[digits:], " \t")
+	if len(ext) > 0 && ext[0] != ';' {
+		return 0, 0, fmt.Errorf("invalid chunk size: unexpected %q after size", ext)
+	}
+	for _, c := range ext {
+		if c < ' ' && c != '\t' || c == 0x7f {
+			return 0, 0, fmt.Errorf("invalid chunk extension: contains control characters")
+		}
+	}
+
+	size, err := strconv.ParseInt(string(line[:digits]), 16, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid chunk size: %v", err)
+	}
+	return size, idx + 2, nil
+}
+
+// checkBareLF returns an error if the first line feed in data is not
+// preceded by a carriage return, i.e. the current line ends with a bare LF.
+func checkBareLF(data []byte) error {
+	i := bytes.IndexByte(data, '\n')
+	if i == -1 || i > 0 && data[i-1] == '\r' {
+		return nil
+	}
+	return fmt.Errorf("invalid line ending: bare LF")
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,104 @@
+package chunked
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	// Test: Body split across calls
+	d := NewDecoder()
+	data := []byte("5\r\nhello\r\n7\r\n, world\r\n0\r\nX-Sum: 12\r\n\r\n")
+	var body []byte
+	pending := []byte{}
+	for i := 0; i < len(data); i += 2 {
+		pending = append(pending, data[i:min(i+2, len(data))]...)
+		var n int
+		var err error
+		body, n, err = d.Decode(body, pending)
+		require.NoError(t, err)
+		pending = pending[n:]
+	}
+	require.True(t, d.Done())
+	assert.Equal(t, "hello, world", string(body))
+	assert.Equal(t, "12", d.Trailers.Get("X-Sum"))
+	assert.Empty(t, pending)
+
+	// Test: Uppercase hex digits and extensions
+	d = NewDecoder()
+	body, n, err := d.Decode(nil, []byte("A ; ext=\"x\"\r\n0123456789\r\n0\r\n\r\nrest"))
+	require.NoError(t, err)
+	require.True(t, d.Done())
+	assert.Equal(t, "0123456789", string(body))
+	assert.Equal(t, 30, n)
+
+	// Test: Incomplete size line waits for more data
+	d = NewDecoder()
+	_, n, err = d.Decode(nil, []byte("5"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// Test: Invalid size
+	d = NewDecoder()
+	_, _, err = d.Decode(nil, []byte("z\r\n"))
+	require.Error(t, err)
+
+	// Test: Size too long
+	d = NewDecoder()
+	_, _, err = d.Decode(nil, []byte("1000000000000000"))
+	require.Error(t, err)
+
+	// Test: Missing CRLF after data
+	d = NewDecoder()
+	_, _, err = d.Decode(nil, []byte("3\r\nabcd"))
+	require.Error(t, err)
+
+	// Test: Endless chunk extension
+	d = NewDecoder()
+	_, _, err = d.Decode(nil, []byte("5;"+strings.Repeat("a", maxSizeLineLength)))
+	require.Error(t, err)
+
+	// Test: Chunk extension within the limit
+	d = NewDecoder()
+	_, n, err = d.Decode(nil, []byte("5;"+strings.Repeat("a", 100)+"\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 104, n)
+
+	// Test: Endless trailer field line
+	d = NewDecoder()
+	_, _, err = d.Decode(nil, []byte("0\r\nX-Sum: "+strings.Repeat("1", maxTrailerSize)))
+	require.Error(t, err)
+
+	// Test: Trailer section too large
+	d = NewDecoder()
+	data = []byte("0\r\n" + strings.Repeat("X-Sum: 1\r\n", maxTrailerSize/10+1))
+	_, _, err = d.Decode(nil, data)
+	require.Error(t, err)
+}
+
+func TestReader(t *testing.T) {
+	// Test: A body read through a small buffer stops at its end
+	src := bufio.NewReaderSize(strings.NewReader("5\r\nhello\r\n7\r\n, world\r\n0\r\nX-Sum: 12\r\n\r\nnext"), 16)
+	trailers := headers.NewHeaders()
+	body, err := io.ReadAll(NewReader(src, trailers))
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", string(body))
+	assert.Equal(t, "12", trailers.Get("X-Sum"))
+	rest, err := io.ReadAll(src)
+	require.NoError(t, err)
+	assert.Equal(t, "next", string(rest))
+
+	// Test: A truncated body fails
+	_, err = io.ReadAll(NewReader(bufio.NewReader(strings.NewReader("5\r\nhel")), nil))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Invalid framing fails
+	_, err = io.ReadAll(NewReader(bufio.NewReader(strings.NewReader("5\r\nhelloX\r\n")), nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package chunked
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeAll decodes data, feeding it to a new Decoder in pieces of the given
+// size like a network read would. It fails if the data left unconsumed, which
+// a caller has to buffer, grows beyond the limits of the decoder.
+func decodeAll(data []byte, size int) (*Decoder, []byte, int, error) {
+	d := NewDecoder()
+	var body []byte
+	pending := []byte{}
+	consumed := 0
+	for pos := 0; pos < len(data); pos += size {
+		pending = append(pending, data[pos:min(pos+size, len(data))]...)
+		var n int
+		var err error
+		body, n, err = d.Decode(body, pending)
+		if err != nil {
+			return d, body, consumed, err
+		}
+		pending = pending[n:]
+		consumed += n
+		if len(pending) > maxTrailerSize+size {
+			return d, body, consumed, fmt.Errorf("%d bytes left unconsumed", len(pending))
+		}
+	}
+	return d, body, consumed, nil
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte("5\r\nhello\r\n7\r\n, world\r\n0\r\nX-Sum: 12\r\n\r\n"), uint8(2))
+	f.Add([]byte("A ; ext=\"x\"\r\n0123456789\r\n0\r\n\r\n"), uint8(1))
+	f.Add([]byte("ffffffffffffffffff\r\n"), uint8(4))
+	f.Add([]byte("3\r\nabc\n0\r\n\r\n"), uint8(3))
+	f.Add([]byte("5;"+strings.Repeat("a", maxSizeLineLength)), uint8(255))
+
+	f.Fuzz(func(t *testing.T, data []byte, size uint8) {
+		whole, wholeBody, wholeN, wholeErr := decodeAll(data, max(len(data), 1))
+		split, splitBody, splitN, splitErr := decodeAll(data, max(int(size), 1))
+
+		// the decoder must consume or reject data instead of letting the
+		// caller buffer it without bound
+		if splitErr != nil {
+			require.NotContains(t, splitErr.Error(), "unconsumed")
+		}
+
+		// the result must not depend on how the input was split
+		if wholeErr != nil {
+			require.Error(t, splitErr)
+			return
+		}
+		require.NoError(t, splitErr)
+		assert.Equal(t, string(wholeBody), string(splitBody))
+		assert.Equal(t, wholeN, splitN)
+		assert.Equal(t, whole.Done(), split.Done())
+		assert.Equal(t, whole.Trailers, split.Trailers)
+
+		// decoded data is always smaller than the encoded input
+		assert.LessOrEqual(t, wholeN, len(data))
+		assert.LessOrEqual(t, len(wholeBody), wholeN)
+	})
+}
@@ -0,0 +1,76 @@
+package chunked
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"io"
+)
+
+// Reader decodes a chunked body as it is read from a bufio.Reader, for bodies
+// that are streamed instead of collected by the caller. It reads nothing
+// past the end of the body, so the data buffered after it is left for
+// whatever follows on the connection.
+type Reader struct {
+	r       *bufio.Reader
+	decoder *Decoder
+	// pending holds decoded data not yet returned by Read.
+	pending []byte
+}
+
+// NewReader returns a Reader decoding the chunked body read from r. The
+// trailer fields are added to trailers once the body is complete, if it is
+// not nil.
+func NewReader(r *bufio.Reader, trailers headers.Headers) *Reader {
+	d := NewDecoder()
+	if trailers != nil {
+		d.Trailers = trailers
+	}
+	return &Reader{r: r, decoder: d}
+}
+
+// Read reads decoded body data. It returns io.EOF after the last chunk and
+// the trailer section, and io.ErrUnexpectedEOF if r ends before them.
+func (c *Reader) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if c.decoder.Done() {
+			return 0, io.EOF
+		}
+
+		// decode what is buffered, reading more only when that is not
+		// enough to make progress
+		want := max(c.r.Buffered(), 1)
+		for {
+			data, err := c.r.Peek(want)
+			if len(data) == 0 && err != nil {
+				if err == io.EOF {
+					return 0, io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+			decoded, n, decodeErr := c.decoder.Decode(c.pending[:0], data)
+			c.pending = decoded
+			c.r.Discard(n)
+			if decodeErr != nil {
+				return 0, fmt.Errorf("Error: invalid chunked body (%v)", decodeErr)
+			}
+			if n > 0 || c.decoder.Done() {
+				break
+			}
+			if err != nil {
+				if err == io.EOF {
+					return 0, io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+			if len(data) == c.r.Size() {
+				return 0, fmt.Errorf("Error: invalid chunked body (line too long)")
+			}
+			want = len(data) + 1
+		}
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,299 @@
+// Package client implements an HTTP/1.1 client on top of the request and
+// headers packages.
+//
+// Requests are request.Request values, serialized with WriteRequest, and
+// responses are parsed by ReadResponse with the response package. The
+// response body is a stream framed by Content-Length, the chunked transfer
+// coding or the end of the connection:
+//
+//	res, err := client.Get("https://example.com/")
+//	if err != nil {
+//		return err
+//	}
+//	defer res.Body.Close()
+//	body, err := io.ReadAll(res.Body)
+//
+// Each request uses a new connection, which the client asks the server to
+// close after the response.
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/request"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client sends HTTP/1.1 requests. The zero value is ready to use.
+type Client struct {
+	// Timeout limits the time to connect, send the request and read the
+	// whole response, including its body. Zero means no limit.
+	Timeout time.Duration
+	// TLSConfig configures connections to https URLs. The ServerName is
+	// set from the URL if empty.
+	TLSConfig *tls.Config
+	// Dial opens the connection to addr, a host:port pair. It defaults to
+	// net.Dial over TCP.
+	Dial func(network, addr string) (net.Conn, error)
+}
+
+// DefaultClient is the Client used by Get and Post.
+var DefaultClient = &Client{}
+
+// Get sends a GET request for rawURL with DefaultClient.
+func Get(rawURL string) (*Response, error) {
+	req, err := NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultClient.Do(req)
+}
+
+// Post sends a POST request for rawURL with the body of contentType with
+// DefaultClient.
+func Post(rawURL, contentType string, body []byte) (*Response, error) {
+	req, err := NewRequest("POST", rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Headers["content-type"] = contentType
+	return DefaultClient.Do(req)
+}
+
+// NewRequest returns a request for an absolute http or https URL with a
+// Host header. The URL is kept as the request target until Do sends the
+// request in origin-form, e.g. "/path?query".
+func NewRequest(method, rawURL string, body []byte) (*request.Request, error) {
+	u, err := parseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &request.Request{
+		RequestLine: request.RequestLine{
+			Method:        method,
+			RequestTarget: u.String(),
+			HttpVersion:   "1.1",
+		},
+		Headers: headers.Headers{"host": u.Host},
+		Body:    body,
+	}, nil
+}
+
+// parseURL parses an absolute http or https URL.
+func parseURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("Error: invalid URL (%v)", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Error: unsupported URL scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("Error: URL %q has no host", rawURL)
+	}
+	return u, nil
+}
+
+// Do sends req and returns the response once its header section is read.
+// The caller must close the response body, which closes the connection.
+//
+// The request target is either an absolute URL, as made by NewRequest, or
+// a path sent over plain HTTP to the Host header. req is not modified. A
+// Content-Length is added for a request with a body, unless it is chunked,
+// and "Connection: close" unless a Connection header is present.
+// Interim 1xx responses other than 101 Switching Protocols are skipped.
+func (c *Client) Do(req *request.Request) (*Response, error) {
+	out, u, err := prepare(req)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.dial(u)
+	if err != nil {
+		return nil, err
+	}
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	bw := bufio.NewWriter(conn)
+	if err := WriteRequest(bw, out); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error: could not send request (%v)", err)
+	}
+
+	res, err := ReadResponse(bufio.NewReader(conn), out.RequestLine.Method)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	res.conn = conn
+	return res, nil
+}
+
+// prepare returns the request to send for req in origin-form, and the URL
+// of the server.
+func prepare(req *request.Request) (*request.Request, *url.URL, error) {
+	out := *req
+	out.Headers = headers.NewHeaders()
+	for k, v := range req.Headers {
+		out.Headers[strings.ToLower(k)] = v
+	}
+
+	target := req.RequestLine.RequestTarget
+	var u *url.URL
+	if strings.Contains(target, "://") {
+		var err error
+		u, err = parseURL(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		out.RequestLine.RequestTarget = u.RequestURI()
+		if out.Headers["host"] == "" {
+			out.Headers["host"] = u.Host
+		}
+	} else {
+		host := out.Headers["host"]
+		if host == "" {
+			return nil, nil, fmt.Errorf("Error: request has neither an absolute URL nor a Host header")
+		}
+		u = &url.URL{Scheme: "http", Host: host}
+	}
+
+	if _, ok := out.Headers["connection"]; !ok {
+		out.Headers["connection"] = "close"
+	}
+	return &out, u, nil
+}
+
+// dial connects to the server of u, with TLS for https.
+func (c *Client) dial(u *url.URL) (net.Conn, error) {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	dial := c.Dial
+	if dial == nil {
+		dialer := &net.Dialer{Timeout: c.Timeout}
+		dial = dialer.Dial
+	}
+	conn, err := dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Error: could not connect to %s (%v)", addr, err)
+	}
+	if u.Scheme != "https" {
+		return conn, nil
+	}
+
+	config := &tls.Config{}
+	if c.TLSConfig != nil {
+		config = c.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = u.Hostname()
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+	tlsConn := tls.Client(conn, config)
+	if c.Timeout > 0 {
+		tlsConn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error: TLS handshake with %s failed (%v)", addr, err)
+	}
+	return tlsConn, nil
+}
+
+// WriteRequest serializes req in the HTTP/1.1 wire format: the request
+// line, the header fields and the body.
+//
+// A body is sent with a Content-Length, which is added if missing, or with
+// the chunked transfer coding if the Transfer-Encoding header says so, as a
+// single chunk followed by req.Trailers. Methods, targets and field values
+// that would change the meaning of the message, such as ones containing
+// CR or LF, are rejected.
+func WriteRequest(w io.Writer, req *request.Request) error {
+	method, target := req.RequestLine.Method, req.RequestLine.RequestTarget
+	if method == "" || strings.ContainsAny(method, " \t\r\n") {
+		return fmt.Errorf("Error: invalid method %q", method)
+	}
+	if target == "" || strings.ContainsAny(target, " \t\r\n") {
+		return fmt.Errorf("Error: invalid request target %q", target)
+	}
+
+	h := headers.NewHeaders()
+	for k, v := range req.Headers {
+		h[strings.ToLower(k)] = v
+	}
+	chunked := strings.EqualFold(strings.TrimSpace(h["transfer-encoding"]), "chunked")
+	if _, ok := h["content-length"]; !ok && !chunked && (len(req.Body) > 0 || allowsBody(method)) {
+		h["content-length"] = strconv.Itoa(len(req.Body))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", method, target)
+	if err := writeFields(&b, h); err != nil {
+		return err
+	}
+	b.WriteString("\r\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return fmt.Errorf("Error: could not send request (%v)", err)
+	}
+
+	b.Reset()
+	if !chunked {
+		_, err := w.Write(req.Body)
+		return err
+	}
+	if len(req.Body) > 0 {
+		fmt.Fprintf(&b, "%x\r\n%s\r\n", len(req.Body), req.Body)
+	}
+	b.WriteString("0\r\n")
+	if err := writeFields(&b, req.Trailers); err != nil {
+		return err
+	}
+	b.WriteString("\r\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// allowsBody reports whether requests with method usually carry a body, so
+// that an empty one is sent with "Content-Length: 0".
+func allowsBody(method string) bool {
+	return method == "POST" || method == "PUT" || method == "PATCH"
+}
+
+// writeFields writes the field lines of h, with lowercase names.
+func writeFields(b *strings.Builder, h headers.Headers) error {
+	for k, v := range h {
+		name := strings.ToLower(strings.TrimSpace(k))
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("Error: invalid field name %q", k)
+		}
+		for _, line := range headers.SplitLines(name, v) {
+			if !headers.ValidValue(line) {
+				return fmt.Errorf("Error: invalid value for field %q", k)
+			}
+			fmt.Fprintf(b, "%s: %s\r\n", name, strings.TrimSpace(line))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/sp41414/goHttp/pkg/cookie"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readResponse parses raw one byte at a time and reads its whole body.
+func readResponse(t *testing.T, raw, method string) (*Response, string, error) {
+	t.Helper()
+	res, err := ReadResponse(bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(raw)), 16), method)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := io.ReadAll(res.Body)
+	return res, string(body), err
+}
+
+func TestWriteRequest(t *testing.T) {
+	// Test: A body gets a Content-Length and parses back unchanged
+	req, err := NewRequest("POST", "http://localhost:9000/items?sort=asc", []byte(`{"name":"a"}`))
+	require.NoError(t, err)
+	out, u, err := prepare(req)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:9000", u.Host)
+	assert.Equal(t, "http://localhost:9000/items?sort=asc", req.RequestLine.RequestTarget, "req is not modified")
+	var buf bytes.Buffer
+	require.NoError(t, WriteRequest(&buf, out))
+	assert.True(t, strings.HasPrefix(buf.String(), "POST /items?sort=asc HTTP/1.1\r\n"))
+	parsed, err := request.RequestFromReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:9000", parsed.Headers.Get("Host"))
+	assert.Equal(t, "12", parsed.Headers.Get("Content-Length"))
+	assert.Equal(t, "close", parsed.Headers.Get("Connection"))
+	assert.Equal(t, `{"name":"a"}`, string(parsed.Body))
+
+	// Test: A chunked body is sent with its trailers
+	req = &request.Request{
+		RequestLine: request.RequestLine{Method: "PUT", RequestTarget: "/upload"},
+		Headers:     headers.Headers{"Host": "localhost", "Transfer-Encoding": "chunked", "Trailer": "x-sum"},
+		Body:        []byte("data"),
+		Trailers:    headers.Headers{"x-sum": "42"},
+	}
+	buf.Reset()
+	require.NoError(t, WriteRequest(&buf, req))
+	parsed, err = request.RequestFromReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(parsed.Body))
+	assert.Equal(t, "42", parsed.Trailers.Get("x-sum"))
+
+	// Test: GET without a body has no Content-Length
+	req, err = NewRequest("GET", "https://example.com", nil)
+	require.NoError(t, err)
+	out, u, err = prepare(req)
+	require.NoError(t, err)
+	assert.Equal(t, "https", u.Scheme)
+	buf.Reset()
+	require.NoError(t, WriteRequest(&buf, out))
+	assert.True(t, strings.HasPrefix(buf.String(), "GET / HTTP/1.1\r\n"))
+	assert.NotContains(t, buf.String(), "content-length")
+
+	// Test: Values that would split the message are rejected
+	for _, req := range []*request.Request{
+		{RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/ HTTP/1.1\r\nX-Injected: 1"}},
+		{RequestLine: request.RequestLine{Method: "GET /", RequestTarget: "/"}},
+		{RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/"}, Headers: headers.Headers{"x-a": "1\r\nx-b: 2"}},
+		{RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/"}, Headers: headers.Headers{"x-a:": "1"}},
+	} {
+		assert.Error(t, WriteRequest(io.Discard, req))
+	}
+
+	// Test: Unsupported URLs
+	for _, rawURL := range []string{"ftp://example.com/", "/relative", "http://"} {
+		_, err := NewRequest("GET", rawURL, nil)
+		assert.Error(t, err, rawURL)
+	}
+}
+
+func TestReadResponse(t *testing.T) {
+	// Test: Content-Length delimits the body, leaving the rest unread
+	r := bufio.NewReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 5\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\n\r\nhelloHTTP/1.1"))
+	res, err := ReadResponse(r, "GET")
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "OK", res.Reason)
+	assert.Equal(t, "1.1", res.HttpVersion)
+	assert.Equal(t, int64(5), res.ContentLength)
+	assert.Equal(t, []string{"a=1", "b=2"}, res.Headers.Values("Set-Cookie"))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	rest, _ := io.ReadAll(r)
+	assert.Equal(t, "HTTP/1.1", string(rest))
+
+	// Test: Chunked bodies with trailers, read one byte at a time
+	res, body2, err := readResponse(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n7;ext=1\r\n, world\r\n0\r\nX-Sum: 42\r\n\r\n", "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", body2)
+	assert.Equal(t, int64(-1), res.ContentLength)
+	assert.Equal(t, "42", res.Trailers.Get("X-Sum"))
+
+	// Test: Interim responses are skipped
+	res, body2, err = readResponse(t, "HTTP/1.1 103 Early Hints\r\nLink: </a.css>\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok", "GET")
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "ok", body2)
+	assert.Empty(t, res.Headers.Get("Link"))
+
+	// Test: Without framing the body ends with the connection
+	res, body2, err = readResponse(t, "HTTP/1.0 200 Fine Thanks\r\n\r\nuntil the end", "GET")
+	require.NoError(t, err)
+	assert.Equal(t, "until the end", body2)
+	assert.Equal(t, "Fine Thanks", res.Reason)
+	assert.Equal(t, "1.0", res.HttpVersion)
+
+	// Test: Bodiless responses ignore their framing headers
+	for _, tt := range []struct{ raw, method string }{
+		{"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", "HEAD"},
+		{"HTTP/1.1 204 No Content\r\n\r\n", "GET"},
+		{"HTTP/1.1 304 Not Modified\r\nTransfer-Encoding: chunked\r\n\r\n", "GET"},
+	} {
+		res, body2, err = readResponse(t, tt.raw, tt.method)
+		require.NoError(t, err, tt.raw)
+		assert.Empty(t, body2, tt.raw)
+		assert.Equal(t, int64(0), res.ContentLength, tt.raw)
+	}
+
+	// Test: An empty reason phrase, with or without the space
+	for _, raw := range []string{"HTTP/1.1 404 \r\n\r\n", "HTTP/1.1 404\r\n\r\n"} {
+		res, _, err = readResponse(t, raw, "HEAD")
+		require.NoError(t, err, raw)
+		assert.Equal(t, 404, res.StatusCode)
+		assert.Empty(t, res.Reason)
+	}
+
+	// Test: Truncated bodies are errors
+	_, _, err = readResponse(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort", "GET")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, _, err = readResponse(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhel", "GET")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Malformed responses
+	for _, raw := range []string{
+		"HTTP/1.1 200 OK\r\n",
+		"HTTP/1.1 200 OK\n\r\n",
+		"HTTP/2 200 OK\r\n\r\n",
+		"HTTP/1.1 20 OK\r\n\r\n",
+		"HTTP/1.1 abc OK\r\n\r\n",
+		"HTTP/1.1 200 O\x00K\r\n\r\n",
+		"ICY 200 OK\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nBad Header: x\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: 1, 2\r\n\r\nx",
+		"HTTP/1.1 200 OK\r\nContent-Length: 100\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nok\r\n0\r\n\r\n",
+		"HTTP/1.1 103 Early Hints\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" + strings.Repeat("0", 40),
+	} {
+		_, _, err = readResponse(t, raw, "GET")
+		assert.Error(t, err, raw)
+	}
+}
+
+// serveRaw accepts a single connection, reads the request and answers with
+// raw before closing it. It returns the address to connect to.
+func serveRaw(t *testing.T, raw string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := request.RequestFromReader(conn); err == nil {
+			io.WriteString(conn, raw)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDo(t *testing.T) {
+	s, err := server.Serve(0, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/chunked" {
+			w.WriteStatusLine(response.OK)
+			w.WriteHeaders(headers.Headers{"transfer-encoding": "chunked", "trailer": "x-count"})
+			for i := 0; i < 100; i++ {
+				w.WriteChunkedBody([]byte(strings.Repeat("x", 1000)))
+			}
+			w.WriteChunkedBodyDone()
+			w.WriteTrailers(headers.Headers{"x-count": "100"})
+			return
+		}
+		body := []byte(fmt.Sprintf("%s %s %s", req.RequestLine.Method, req.RequestLine.RequestTarget, req.Body))
+		h := response.GetDefaultHeaders(len(body))
+		cookie.Set(h, &cookie.Cookie{Name: "a", Value: "1"})
+		cookie.Set(h, &cookie.Cookie{Name: "b", Value: "2"})
+		w.WriteEarlyHints("</style.css>; rel=preload")
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+	})
+	require.NoError(t, err)
+	defer s.Close()
+	base := fmt.Sprintf("http://%s", s.Listener.Addr())
+
+	// Test: Interim responses are skipped, and the body is complete
+	res, err := Post(base+"/echo?x=1", "text/plain", []byte("ping"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "POST /echo?x=1 ping", string(body))
+	assert.Equal(t, []string{"a=1", "b=2"}, res.Headers.Values("Set-Cookie"))
+
+	// Test: A chunked body larger than the read buffer, with trailers
+	res, err = Get(base + "/chunked")
+	require.NoError(t, err)
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Len(t, body, 100000)
+	assert.Equal(t, "100", res.Trailers.Get("X-Count"))
+
+	// Test: A path with a Host header is sent over plain HTTP
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: "HEAD", RequestTarget: "/head"},
+		Headers:     headers.Headers{"Host": s.Listener.Addr().String()},
+	}
+	res, err = DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Empty(t, body)
+	assert.Equal(t, "11", res.Headers.Get("Content-Length"), "HEAD /head ")
+
+	// Test: A body delimited by the end of the connection
+	addr := serveRaw(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nstreamed until close")
+	res, err = Get("http://" + addr + "/")
+	require.NoError(t, err)
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, "streamed until close", string(body))
+
+	// Test: The timeout covers reading the response
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	c := &Client{Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	_, err = c.Do(&request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/"},
+		Headers:     headers.Headers{"host": ln.Addr().String()},
+	})
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// Test: Requests without a destination
+	_, err = DefaultClient.Do(&request.Request{RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"bufio"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/response"
+	"io"
+	"net"
+)
+
+// Response is a response received by the client.
+type Response struct {
+	// StatusCode is the status code, e.g. 200.
+	StatusCode int
+	// Reason is the reason phrase, which may be empty and carries no
+	// meaning.
+	Reason string
+	// HttpVersion is the protocol version of the server, e.g. "1.1".
+	HttpVersion string
+	Headers     headers.Headers
+	// ContentLength is the length of the body: 0 for responses without a
+	// body, and -1 if it is chunked or delimited by the end of the
+	// connection.
+	ContentLength int64
+	// Body streams the body of the response. It is empty for responses
+	// without a body. For 101 Switching Protocols, it streams the
+	// connection instead.
+	Body io.ReadCloser
+	// Trailers holds the trailer fields of a chunked body once Body has
+	// been read to the end.
+	Trailers headers.Headers
+
+	conn net.Conn
+}
+
+// maxHeaderSize is the largest status line and header section ReadResponse
+// accepts.
+const maxHeaderSize = 1 << 20
+
+// ReadResponse reads a response to a request with method from r with
+// response.ResponseFromReader, skipping interim 1xx responses other than
+// 101 Switching Protocols. The body is not read: Body reads it from r as
+// framed by RFC 9112 section 6.3.
+//
+//   - Responses to HEAD and 204 and 304 responses have no body.
+//   - A chunked Transfer-Encoding is decoded, and any other transfer coding
+//     is read until the connection closes.
+//   - A valid Content-Length delimits the body.
+//   - Otherwise the body extends to the end of the connection.
+//
+// A response with both Transfer-Encoding and Content-Length is rejected, and
+// a header section larger than 1 MiB fails with response.ErrHeaderTooLarge.
+// A body ending before its framing says it should fails with
+// io.ErrUnexpectedEOF. Closing the body of a response returned by Do closes
+// the connection.
+func ReadResponse(r *bufio.Reader, method string) (*Response, error) {
+	parsed, err := response.ResponseFromReaderWithOptions(r, response.ParseOptions{
+		Method:        method,
+		MaxHeaderSize: maxHeaderSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Response{
+		StatusCode:    int(parsed.StatusCode),
+		Reason:        parsed.ReasonPhrase,
+		HttpVersion:   parsed.HttpVersion,
+		Headers:       parsed.Headers,
+		ContentLength: parsed.ContentLength,
+		Trailers:      parsed.Trailers,
+	}
+	res.Body = &body{res: res, r: parsed.Body}
+	return res, nil
+}
+
+// body is the Body of a Response, closing the connection on Close.
+type body struct {
+	res *Response
+	r   io.Reader
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+// Close closes the connection of a response returned by Do.
+func (b *body) Close() error {
+	if b.res.conn == nil {
+		return nil
+	}
+	return b.res.conn.Close()
+}
@@ -0,0 +1,343 @@
+// Package compress implements response compression middleware. It negotiates
+// a content coding with the Accept-Encoding request header and compresses
+// response bodies with gzip or deflate (RFC 9110 section 8.4.1).
+//
+// Compressed responses are sent with chunked encoding, since their final
+// length is unknown, so handlers keep writing uncompressed data with WriteBody
+// or WriteChunkedBody as usual:
+//
+//	s, err := server.Serve(8080, compress.Handler(handler, nil))
+//
+// Each chunk written with WriteChunkedBody is flushed to the client on its
+// own, so streamed responses such as server-sent events keep working.
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/negotiate"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMinSize is the default Options.MinSize.
+const DefaultMinSize = 1024
+
+// Options configures the compression middleware.
+type Options struct {
+	// Level is the compression level, from 1 (best speed) to 9 (best
+	// compression). Zero and invalid levels use the default level of
+	// compress/gzip.
+	Level int
+	// MinSize is the smallest Content-Length that is compressed; smaller
+	// bodies gain little and are sent as they are. Bodies of unknown length
+	// are always compressed. It defaults to DefaultMinSize if zero.
+	MinSize int
+}
+
+// compressor is the interface shared by gzip.Writer and zlib.Writer.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Handler returns a handler that runs next with a writer compressing its
+// response, when the client accepts gzip or deflate and the response is
+// worth compressing. opts may be nil.
+//
+// Responses are left unchanged if they cannot have a body, are 206 Partial
+// Content, already have a Content-Encoding, have a Content-Type that is
+// already compressed (images, audio, video, archives and fonts), or have a
+// Content-Length below MinSize. All other responses get a
+// "Vary: Accept-Encoding" header, as their coding depends on the request.
+//
+// Compressing drops Content-Length and Accept-Ranges, and weakens a strong
+// ETag, since the compressed body is a different representation. Trailers
+// are sent after the compressed body.
+func Handler(next server.Handler, opts *Options) server.Handler {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Level < gzip.BestSpeed || o.Level > gzip.BestCompression {
+		o.Level = gzip.DefaultCompression
+	}
+	if o.MinSize == 0 {
+		o.MinSize = DefaultMinSize
+	}
+
+	pools := map[string]*sync.Pool{
+		"gzip": {New: func() any {
+			w, _ := gzip.NewWriterLevel(nil, o.Level)
+			return w
+		}},
+		"deflate": {New: func() any {
+			w, _ := zlib.NewWriterLevel(nil, o.Level)
+			return w
+		}},
+	}
+	return handler(next, o.MinSize, pools)
+}
+
+// handler is Handler with the compressors taken from pools, keyed by content
+// coding.
+func handler(next server.Handler, minSize int, pools map[string]*sync.Pool) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		enc := &encoder{
+			coding:  negotiateCoding(req.Headers),
+			minSize: minSize,
+			pools:   pools,
+		}
+		err := w.WrapEncoder(func(inner response.Encoder) response.Encoder {
+			enc.inner = inner
+			return enc
+		})
+		if err != nil {
+			next(w, req)
+			return
+		}
+		// the compressed body is never completed for HEAD requests or
+		// handlers that stop early, so its compressor is released here
+		defer enc.release()
+
+		next(w, req)
+
+		// a body written with WriteBody has no end of its own, so the
+		// compressed stream and the chunked encoding are finished here
+		if enc.c != nil && w.State == response.Body {
+			if _, err := w.WriteChunkedBodyDone(); err != nil {
+				return
+			}
+			w.WriteTrailers(headers.Headers{})
+		}
+	}
+}
+
+// negotiateCoding returns the content coding to use for a response to a
+// request with headers h, or "" for none. Unlike negotiate.Encoding, a
+// request without an Accept-Encoding header gets an uncompressed response.
+func negotiateCoding(h headers.Headers) string {
+	if strings.TrimSpace(h.Get("Accept-Encoding")) == "" {
+		return ""
+	}
+	switch coding := negotiate.Encoding(h, []string{"gzip", "deflate", "identity"}); coding {
+	case "gzip", "deflate":
+		return coding
+	}
+	return ""
+}
+
+// encoder compresses the body written through it before passing it to the
+// inner encoder.
+type encoder struct {
+	inner   response.Encoder
+	coding  string
+	minSize int
+	pools   map[string]*sync.Pool
+	status  response.StatusCode
+	// c compresses the body while it is written, nil if the response is
+	// not compressed or the compressed body is complete.
+	c compressor
+}
+
+func (e *encoder) EncodeInterim(statusCode response.StatusCode, h headers.Headers) error {
+	return e.inner.EncodeInterim(statusCode, h)
+}
+
+func (e *encoder) EncodeStatusLine(statusCode response.StatusCode) error {
+	e.status = statusCode
+	return e.inner.EncodeStatusLine(statusCode)
+}
+
+// EncodeHeaders decides whether the response is compressed, and adjusts its
+// headers accordingly.
+func (e *encoder) EncodeHeaders(h headers.Headers) error {
+	if !e.compressible(h) {
+		return e.inner.EncodeHeaders(h)
+	}
+
+	h = h.LowerKeys()
+	if vary := h["vary"]; vary == "" {
+		h["vary"] = "Accept-Encoding"
+	} else if !hasToken(vary, "accept-encoding") && vary != "*" {
+		h["vary"] = vary + ", Accept-Encoding"
+	}
+	if e.coding == "" {
+		return e.inner.EncodeHeaders(h)
+	}
+
+	delete(h, "content-length")
+	delete(h, "accept-ranges")
+	if etag := h["etag"]; etag != "" && !strings.HasPrefix(etag, "W/") {
+		h["etag"] = "W/" + etag
+	}
+	h["content-encoding"] = e.coding
+	h["transfer-encoding"] = "chunked"
+
+	if err := e.inner.EncodeHeaders(h); err != nil {
+		return err
+	}
+	e.c = e.pools[e.coding].Get().(compressor)
+	e.c.Reset(chunkWriter{e.inner})
+	return nil
+}
+
+// EncodeBody compresses p. Compressed data is sent in chunks whenever the
+// compressor produces it.
+func (e *encoder) EncodeBody(p []byte) (int, error) {
+	if e.c == nil {
+		return e.inner.EncodeBody(p)
+	}
+	return e.c.Write(p)
+}
+
+// EncodeChunk compresses p and flushes it, so that the client can
+// decompress the chunk as soon as it arrives.
+func (e *encoder) EncodeChunk(p []byte) (int, error) {
+	if e.c == nil {
+		return e.inner.EncodeChunk(p)
+	}
+	n, err := e.c.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, e.c.Flush()
+}
+
+// EncodeChunksDone completes the compressed body before ending the chunked
+// encoding.
+func (e *encoder) EncodeChunksDone() (int, error) {
+	if e.c != nil {
+		err := e.c.Close()
+		e.release()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return e.inner.EncodeChunksDone()
+}
+
+// release returns the compressor to its pool, if it was not already.
+func (e *encoder) release() {
+	if e.c == nil {
+		return
+	}
+	e.c.Reset(nil)
+	e.pools[e.coding].Put(e.c)
+	e.c = nil
+}
+
+func (e *encoder) EncodeTrailers(h headers.Headers) error {
+	return e.inner.EncodeTrailers(h)
+}
+
+// SwitchProtocols implements response.ProtocolSwitcher by delegating to the
+// inner encoder.
+func (e *encoder) SwitchProtocols() (io.ReadWriter, error) {
+	switcher, ok := e.inner.(response.ProtocolSwitcher)
+	if !ok {
+		return nil, fmt.Errorf("Error: connection does not support switching protocols")
+	}
+	return switcher.SwitchProtocols()
+}
+
+// Hijack implements response.Hijacker by delegating to the inner encoder.
+func (e *encoder) Hijack() (net.Conn, []byte, error) {
+	hijacker, ok := e.inner.(response.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("Error: connection does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// compressible reports whether a response with headers h may be compressed,
+// regardless of what the client accepts.
+func (e *encoder) compressible(h headers.Headers) bool {
+	// 1xx, 204 and 304 responses have no body, see RFC 9110 section 6.4.1,
+	// and the parts of a 206 response are ranges of the uncompressed body
+	switch {
+	case e.status < 200, e.status == response.NO_CONTENT,
+		e.status == response.NOT_MODIFIED, e.status == response.PARTIAL_CONTENT:
+		return false
+	}
+
+	var contentType, contentLength string
+	for k, v := range h {
+		switch strings.ToLower(k) {
+		case "content-encoding":
+			if v != "" && !strings.EqualFold(v, "identity") {
+				return false
+			}
+		case "content-type":
+			contentType = v
+		case "content-length":
+			contentLength = v
+		}
+	}
+	if alreadyCompressed(contentType) {
+		return false
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(contentLength)); err == nil && n < e.minSize {
+		return false
+	}
+	return true
+}
+
+// alreadyCompressed reports whether the media type is compressed by its own
+// format, so that compressing it again only costs time.
+func alreadyCompressed(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	switch typ {
+	case "audio", "video":
+		return true
+	case "image":
+		// SVG is XML text, and BMP is uncompressed
+		return mediaType != "image/svg+xml" && mediaType != "image/bmp"
+	case "font":
+		return mediaType == "font/woff" || mediaType == "font/woff2"
+	}
+	switch mediaType {
+	case "application/gzip", "application/x-gzip", "application/zip",
+		"application/zstd", "application/x-bzip2", "application/x-xz",
+		"application/x-7z-compressed", "application/vnd.rar",
+		"application/x-rar-compressed", "application/pdf":
+		return true
+	}
+	return false
+}
+
+// chunkWriter writes compressed data as chunks of the response.
+type chunkWriter struct {
+	enc response.Encoder
+}
+
+func (w chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		// an empty chunk would end the body
+		return 0, nil
+	}
+	return w.enc.EncodeChunk(p)
+}
+
+// hasToken reports whether the comma-separated header value contains token,
+// compared case-insensitively.
+func hasToken(value, token string) bool {
+	for _, v := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/internal/handlertest"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var text = strings.Repeat("compressible text ", 200)
+
+// serve runs handler behind the middleware for a GET request with the given
+// Accept-Encoding header, and parses the response.
+func serve(t *testing.T, handler server.Handler, acceptEncoding string) (*response.Response, string) {
+	t.Helper()
+	var headerLines []string
+	if acceptEncoding != "" {
+		headerLines = append(headerLines, "Accept-Encoding: "+acceptEncoding)
+	}
+	return handlertest.Serve(t, Handler(handler, nil), "GET", "/", headerLines...)
+}
+
+// bodyHandler writes body with a Content-Length and the headers h, which
+// replace the default headers of the same name.
+func bodyHandler(body string, h headers.Headers) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.OK)
+		header := response.GetDefaultHeaders(len(body))
+		for k, v := range h {
+			header.OverrideValue(k, v)
+		}
+		w.WriteHeaders(header)
+		w.WriteBody([]byte(body))
+	}
+}
+
+// chunkedHandler writes text in several chunks followed by a trailer.
+func chunkedHandler(w *response.Writer, req *request.Request) {
+	w.WriteStatusLine(response.OK)
+	w.WriteHeaders(headers.Headers{
+		"content-type":      "text/plain",
+		"transfer-encoding": "chunked",
+		"trailer":           "x-checksum",
+	})
+	for i := 0; i < len(text); i += 1000 {
+		w.WriteChunkedBody([]byte(text[i:min(i+1000, len(text))]))
+	}
+	w.WriteChunkedBodyDone()
+	w.WriteTrailers(headers.Headers{"x-checksum": "abc"})
+}
+
+func TestCompress(t *testing.T) {
+	// Test: A body with a known length is gzipped and sent chunked
+	res, raw := serve(t, bodyHandler(text, headers.Headers{"etag": `"v1"`, "accept-ranges": "bytes"}), "gzip, deflate;q=0.5")
+	assert.Equal(t, "gzip", res.Headers.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Headers.Get("Vary"))
+	assert.Equal(t, "chunked", res.Headers.Get("Transfer-Encoding"))
+	assert.Empty(t, res.Headers.Get("Content-Length"))
+	assert.Empty(t, res.Headers.Get("Accept-Ranges"))
+	assert.Equal(t, `W/"v1"`, res.Headers.Get("ETag"))
+	zr, err := gzip.NewReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(body))
+
+	// Test: Chunks are deflated and the trailers follow the compressed body
+	res, raw = serve(t, chunkedHandler, "deflate")
+	assert.Equal(t, "deflate", res.Headers.Get("Content-Encoding"))
+	zr2, err := zlib.NewReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	body, err = io.ReadAll(zr2)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(body))
+	assert.Equal(t, "abc", res.Trailers.Get("X-Checksum"))
+
+	// Test: Without Accept-Encoding the body is sent as is, but varies
+	res, _ = serve(t, bodyHandler(text, headers.Headers{"Vary": "Origin"}), "")
+	assert.Empty(t, res.Headers.Get("Content-Encoding"))
+	assert.Equal(t, "Origin, Accept-Encoding", res.Headers.Get("Vary"))
+	assert.Equal(t, int64(len(text)), res.ContentLength)
+
+	// Test: identity only, or a coding the middleware does not support
+	for _, accept := range []string{"identity", "br", "gzip;q=0, deflate;q=0"} {
+		res, _ = serve(t, bodyHandler(text, nil), accept)
+		assert.Empty(t, res.Headers.Get("Content-Encoding"), accept)
+	}
+
+	// Test: Tiny bodies, compressed media types and encoded bodies are
+	// left alone
+	skipped := []server.Handler{
+		bodyHandler("tiny", nil),
+		bodyHandler(text, headers.Headers{"content-type": "image/png"}),
+		bodyHandler(text, headers.Headers{"Content-Type": "video/mp4; codecs=avc1"}),
+		bodyHandler(text, headers.Headers{"Content-Encoding": "br"}),
+	}
+	for i, handler := range skipped {
+		res, _ = serve(t, handler, "gzip")
+		assert.NotEqual(t, "gzip", res.Headers.Get("Content-Encoding"), i)
+		assert.Empty(t, res.Headers.Get("Vary"), i)
+		assert.NotEqual(t, int64(-1), res.ContentLength, i)
+	}
+
+	// Test: Partial content is not compressed
+	res, _ = serve(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.PARTIAL_CONTENT)
+		w.WriteHeaders(headers.Headers{"content-range": "bytes 0-1999/4000", "transfer-encoding": "chunked"})
+		w.WriteChunkedBody([]byte(text[:2000]))
+		w.WriteChunkedBodyDone()
+		w.WriteTrailers(nil)
+	}, "gzip")
+	assert.Equal(t, response.PARTIAL_CONTENT, res.StatusCode)
+	assert.Empty(t, res.Headers.Get("Content-Encoding"))
+
+	// Test: Responses without a body are not compressed
+	res, _ = serve(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.NOT_MODIFIED)
+		w.WriteHeaders(headers.Headers{"etag": `"v1"`})
+	}, "gzip")
+	assert.Equal(t, response.NOT_MODIFIED, res.StatusCode)
+	assert.Empty(t, res.Headers.Get("Content-Encoding"))
+	assert.Equal(t, `"v1"`, res.Headers.Get("ETag"))
+}
+
+func TestCompressServer(t *testing.T) {
+	s, err := server.Serve(0, Handler(chunkedHandler, nil))
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: net/http requests gzip and decompresses it transparently
+	res, err := http.Get(fmt.Sprintf("http://%s/", s.Listener.Addr()))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.True(t, res.Uncompressed)
+	assert.Equal(t, text, string(body))
+	assert.Equal(t, "abc", res.Trailer.Get("X-Checksum"))
+}
+
+// trackedCompressor counts the gzip writers that are in use, from the Reset
+// that hands one out to the Reset that releases it.
+type trackedCompressor struct {
+	*gzip.Writer
+	inUse *int
+}
+
+func (c trackedCompressor) Reset(w io.Writer) {
+	if w == nil {
+		*c.inUse--
+	} else {
+		*c.inUse++
+	}
+	c.Writer.Reset(w)
+}
+
+// failingWriter fails every write, like a closed connection.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("connection closed")
+}
+
+func TestCompressorRelease(t *testing.T) {
+	inUse := 0
+	pools := map[string]*sync.Pool{"gzip": {New: func() any {
+		return trackedCompressor{gzip.NewWriter(nil), &inUse}
+	}}}
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: gzip\r\n\r\n"))
+	require.NoError(t, err)
+
+	// Test: The compressor is released after a complete response
+	handler(bodyHandler(text, nil), DefaultMinSize, pools)(response.NewWriter(io.Discard), req)
+	assert.Equal(t, 0, inUse)
+
+	// Test: The compressor is released when the body is omitted
+	w := response.NewWriter(io.Discard)
+	w.OmitBody()
+	handler(chunkedHandler, DefaultMinSize, pools)(w, req)
+	assert.Equal(t, 0, inUse)
+
+	// Test: The compressor is released when the handler stops early
+	handler(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(headers.Headers{"transfer-encoding": "chunked"})
+		w.WriteChunkedBody([]byte(text))
+	}, DefaultMinSize, pools)(response.NewWriter(failingWriter{}), req)
+	assert.Equal(t, 0, inUse)
+}
@@ -0,0 +1,204 @@
+// Package conditional evaluates the preconditions of a request, as
+// described in RFC 9110 section 13, against the validators of the target
+// resource: its entity tag and its modification date.
+//
+// Handlers use it for caching, answering revalidation with 304 Not
+// Modified, and for optimistic concurrency, rejecting updates based on a
+// stale copy with 412 Precondition Failed:
+//
+//	func update(w *response.Writer, req *request.Request) {
+//		item := load()
+//		if conditional.Check(w, req, conditional.Validators{ETag: item.ETag()}) {
+//			return
+//		}
+//		...
+//	}
+package conditional
+
+import (
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"strings"
+	"time"
+)
+
+// Result is the outcome of evaluating the preconditions of a request.
+type Result int
+
+const (
+	// Proceed means the preconditions hold, or there are none, and the
+	// request should be processed as usual.
+	Proceed Result = iota
+	// NotModified means the client's cached copy is current.
+	NotModified
+	// PreconditionFailed means the request must not be applied.
+	PreconditionFailed
+)
+
+// Validators describe the current representation of the target resource.
+type Validators struct {
+	// ETag is the entity tag, e.g. `"v1"` or `W/"v1"`. It is empty if the
+	// resource has none.
+	ETag string
+	// LastModified is the modification date. It is zero if unknown.
+	LastModified time.Time
+	// Missing reports that the resource does not exist, e.g. for a PUT
+	// creating it. "If-Match: *" then fails and "If-None-Match: *" holds.
+	Missing bool
+}
+
+// Evaluate evaluates the preconditions of req against v in the order of RFC
+// 9110 section 13.2.2:
+//
+//  1. If-Match, or If-Unmodified-Since if If-Match is absent, failing with
+//     PreconditionFailed.
+//  2. If-None-Match, failing with NotModified for GET and HEAD and with
+//     PreconditionFailed otherwise.
+//  3. For GET and HEAD, If-Modified-Since if If-None-Match is absent,
+//     failing with NotModified.
+//
+// If-Match uses the strong comparison of entity tags, and If-None-Match the
+// weak comparison. Date conditions are ignored when the resource has no
+// modification date or the date is invalid. If-Range is left to range
+// handling, see package byterange.
+func Evaluate(req *request.Request, v Validators) Result {
+	h := req.Headers
+	method := req.RequestLine.Method
+	safe := method == "GET" || method == "HEAD"
+
+	if ifMatch, ok := h["if-match"]; ok {
+		if !matches(ifMatch, v, StrongMatch) {
+			return PreconditionFailed
+		}
+	} else if value, ok := h["if-unmodified-since"]; ok && !v.LastModified.IsZero() {
+		if t, err := ParseTime(value); err == nil && modifiedAfter(v.LastModified, t) {
+			return PreconditionFailed
+		}
+	}
+
+	if ifNoneMatch, ok := h["if-none-match"]; ok {
+		if matches(ifNoneMatch, v, WeakMatch) {
+			if safe {
+				return NotModified
+			}
+			return PreconditionFailed
+		}
+	} else if value, ok := h["if-modified-since"]; ok && safe && !v.LastModified.IsZero() {
+		if t, err := ParseTime(value); err == nil && !modifiedAfter(v.LastModified, t) {
+			return NotModified
+		}
+	}
+
+	return Proceed
+}
+
+// Check evaluates the preconditions of req like Evaluate and, unless the
+// request should proceed, writes the response: 304 Not Modified with the
+// validators, or 412 Precondition Failed. It reports whether a response was
+// written, in which case the handler is done.
+func Check(w *response.Writer, req *request.Request, v Validators) bool {
+	switch Evaluate(req, v) {
+	case NotModified:
+		h := headers.NewHeaders()
+		if v.ETag != "" {
+			h["etag"] = v.ETag
+		}
+		if !v.LastModified.IsZero() {
+			h["last-modified"] = v.LastModified.UTC().Format(response.TimeFormat)
+		}
+		w.WriteStatusLine(response.NOT_MODIFIED)
+		w.WriteHeaders(h)
+		return true
+	case PreconditionFailed:
+		response.WriteError(w, response.PRECONDITION_FAILED, "Precondition Failed")
+		return true
+	default:
+		return false
+	}
+}
+
+// StrongMatch reports whether the entity tags a and b match with the strong
+// comparison of RFC 9110 section 8.8.3.2: neither is weak and their opaque
+// tags are identical.
+func StrongMatch(a, b string) bool {
+	return !strings.HasPrefix(a, "W/") && !strings.HasPrefix(b, "W/") && a == b
+}
+
+// WeakMatch reports whether the entity tags a and b match with the weak
+// comparison: their opaque tags are identical, whether or not either is
+// weak.
+func WeakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// matches reports whether an If-Match or If-None-Match field value matches
+// the resource with the comparison match. "*" matches any existing
+// resource. A malformed list matches nothing.
+func matches(value string, v Validators, match func(a, b string) bool) bool {
+	if strings.TrimSpace(value) == "*" {
+		return !v.Missing
+	}
+	if v.Missing || v.ETag == "" {
+		return false
+	}
+	tags, ok := parseETags(value)
+	if !ok {
+		return false
+	}
+	for _, tag := range tags {
+		if match(tag, v.ETag) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETags splits a comma-separated list of entity tags. Commas may
+// appear inside the quoted opaque tags, so the list is scanned rather than
+// split.
+func parseETags(value string) ([]string, bool) {
+	var tags []string
+	for i := 0; i < len(value); {
+		switch value[i] {
+		case ' ', '\t', ',':
+			i++
+			continue
+		}
+
+		start := i
+		if strings.HasPrefix(value[i:], "W/") {
+			i += 2
+		}
+		if i >= len(value) || value[i] != '"' {
+			return nil, false
+		}
+		end := strings.IndexByte(value[i+1:], '"')
+		if end == -1 {
+			return nil, false
+		}
+		i += end + 2
+		tags = append(tags, value[start:i])
+	}
+	return tags, true
+}
+
+// ParseTime parses an HTTP date in the preferred IMF-fixdate format or one
+// of the obsolete RFC 850 and asctime formats recipients must accept, see
+// RFC 9110 section 5.6.7.
+func ParseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{response.TimeFormat, "Monday, 02-Jan-06 15:04:05 GMT", "Mon Jan _2 15:04:05 2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Error: invalid HTTP date %q", value)
+}
+
+// modifiedAfter reports whether lastModified is after t, at the resolution
+// of HTTP dates.
+func modifiedAfter(lastModified, t time.Time) bool {
+	return lastModified.Truncate(time.Second).After(t)
+}
@@ -0,0 +1,115 @@
+package conditional
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var lastModified = time.Date(2024, time.March, 1, 12, 0, 0, 500, time.UTC)
+
+// newRequest parses a request with the method and extra header lines.
+func newRequest(t *testing.T, method string, headerLines ...string) *request.Request {
+	t.Helper()
+	raw := method + " /item HTTP/1.1\r\nHost: localhost\r\n"
+	for _, line := range headerLines {
+		raw += line + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+	return req
+}
+
+func TestEvaluate(t *testing.T) {
+	v := Validators{ETag: `"v2"`, LastModified: lastModified}
+	tests := []struct {
+		name    string
+		method  string
+		headers []string
+		want    Result
+	}{
+		{"no preconditions", "GET", nil, Proceed},
+
+		// Test: If-Match uses the strong comparison
+		{"If-Match current", "PUT", []string{`If-Match: "v1", "v2"`}, Proceed},
+		{"If-Match stale", "PUT", []string{`If-Match: "v1"`}, PreconditionFailed},
+		{"If-Match weak", "PUT", []string{`If-Match: W/"v2"`}, PreconditionFailed},
+		{"If-Match any", "PUT", []string{"If-Match: *"}, Proceed},
+		{"If-Match malformed", "PUT", []string{"If-Match: v2"}, PreconditionFailed},
+
+		// Test: If-Unmodified-Since, ignored when If-Match is present
+		{"If-Unmodified-Since same second", "PUT", []string{"If-Unmodified-Since: Fri, 01 Mar 2024 12:00:00 GMT"}, Proceed},
+		{"If-Unmodified-Since earlier", "PUT", []string{"If-Unmodified-Since: Fri, 01 Mar 2024 11:59:59 GMT"}, PreconditionFailed},
+		{"If-Unmodified-Since invalid", "PUT", []string{"If-Unmodified-Since: yesterday"}, Proceed},
+		{"If-Match before If-Unmodified-Since", "PUT", []string{`If-Match: "v2"`, "If-Unmodified-Since: Fri, 01 Mar 2024 11:59:59 GMT"}, Proceed},
+
+		// Test: If-None-Match uses the weak comparison
+		{"If-None-Match GET", "GET", []string{`If-None-Match: W/"v2"`}, NotModified},
+		{"If-None-Match HEAD", "HEAD", []string{`If-None-Match: "v1", "v2"`}, NotModified},
+		{"If-None-Match changed", "GET", []string{`If-None-Match: "v1"`}, Proceed},
+		{"If-None-Match unsafe", "POST", []string{`If-None-Match: "v2"`}, PreconditionFailed},
+		{"If-None-Match any", "PUT", []string{"If-None-Match: *"}, PreconditionFailed},
+		{"If-None-Match comma in tag", "GET", []string{`If-None-Match: "a,b", "v2"`}, NotModified},
+
+		// Test: If-Modified-Since, ignored when If-None-Match is present
+		{"If-Modified-Since same", "GET", []string{"If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT"}, NotModified},
+		{"If-Modified-Since RFC 850", "GET", []string{"If-Modified-Since: Friday, 01-Mar-24 12:00:00 GMT"}, NotModified},
+		{"If-Modified-Since asctime", "GET", []string{"If-Modified-Since: Fri Mar  1 12:00:00 2024"}, NotModified},
+		{"If-Modified-Since earlier", "GET", []string{"If-Modified-Since: Fri, 01 Mar 2024 11:00:00 GMT"}, Proceed},
+		{"If-Modified-Since unsafe", "POST", []string{"If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT"}, Proceed},
+		{"If-None-Match before If-Modified-Since", "GET", []string{`If-None-Match: "v1"`, "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT"}, Proceed},
+
+		// Test: If-Match is evaluated before If-None-Match
+		{"If-Match before If-None-Match", "GET", []string{`If-Match: "v1"`, `If-None-Match: "v2"`}, PreconditionFailed},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Evaluate(newRequest(t, tt.method, tt.headers...), v), tt.name)
+	}
+
+	// Test: A missing resource fails "If-Match: *" and passes
+	// "If-None-Match: *", so PUT can create it exactly once
+	missing := Validators{Missing: true}
+	assert.Equal(t, PreconditionFailed, Evaluate(newRequest(t, "PUT", "If-Match: *"), missing))
+	assert.Equal(t, Proceed, Evaluate(newRequest(t, "PUT", "If-None-Match: *"), missing))
+
+	// Test: Date conditions are ignored without a modification date
+	assert.Equal(t, Proceed, Evaluate(newRequest(t, "GET", "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT"), Validators{ETag: `"v2"`}))
+}
+
+func TestCheck(t *testing.T) {
+	v := Validators{ETag: `"v2"`, LastModified: lastModified}
+	check := func(req *request.Request) (bool, *http.Response) {
+		var buf bytes.Buffer
+		done := Check(response.NewWriter(&buf), req, v)
+		if !done {
+			return false, nil
+		}
+		res, err := http.ReadResponse(bufio.NewReader(&buf), nil)
+		require.NoError(t, err)
+		return true, res
+	}
+
+	// Test: 304 carries the validators
+	done, res := check(newRequest(t, "GET", `If-None-Match: "v2"`))
+	assert.True(t, done)
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+	assert.Equal(t, `"v2"`, res.Header.Get("ETag"))
+	assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", res.Header.Get("Last-Modified"))
+
+	// Test: 412 for a stale update
+	done, res = check(newRequest(t, "PUT", `If-Match: "v1"`))
+	assert.True(t, done)
+	assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+
+	// Test: Nothing is written when the request proceeds
+	done, _ = check(newRequest(t, "PUT", `If-Match: "v2"`))
+	assert.False(t, done)
+}
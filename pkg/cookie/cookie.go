@@ -0,0 +1,232 @@
+// Package cookie implements HTTP cookies as described in RFC 6265bis: parsing
+// the Cookie header of a request and building Set-Cookie fields.
+//
+// Set adds a Set-Cookie field to the headers of a response. Each cookie is
+// written on its own field line:
+//
+//	h := response.GetDefaultHeaders(len(body))
+//	err := cookie.Set(h, &cookie.Cookie{
+//		Name:     "session",
+//		Value:    id,
+//		Path:     "/",
+//		MaxAge:   3600,
+//		Secure:   true,
+//		HttpOnly: true,
+//		SameSite: cookie.SameSiteLax,
+//	})
+//
+// Request.Cookies and Request.Cookie of package request parse the cookies a
+// client sends.
+package cookie
+
+import (
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/response"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SameSite is the value of the SameSite attribute, which controls whether a
+// cookie is sent with cross-site requests.
+type SameSite int
+
+const (
+	// SameSiteDefault omits the attribute, leaving the choice to the client.
+	SameSiteDefault SameSite = iota
+	// SameSiteLax sends the cookie with same-site requests and cross-site
+	// top-level navigations with a safe method.
+	SameSiteLax
+	// SameSiteStrict sends the cookie with same-site requests only.
+	SameSiteStrict
+	// SameSiteNone sends the cookie with all requests. It requires Secure.
+	SameSiteNone
+)
+
+// Cookie is an HTTP cookie. Parsed Cookie headers only set Name and Value;
+// the other fields are the attributes of a Set-Cookie field.
+type Cookie struct {
+	Name  string
+	Value string
+
+	// Path limits the cookie to request paths below it.
+	Path string
+	// Domain extends the cookie to subdomains of it. Without it, the cookie
+	// is only sent to the host that set it.
+	Domain string
+	// Expires is the date the cookie expires. It is omitted if zero.
+	Expires time.Time
+	// MaxAge is the lifetime of the cookie in seconds, taking precedence
+	// over Expires. It is omitted if zero; a negative value is sent as
+	// "Max-Age=0", deleting the cookie.
+	MaxAge int
+	// Secure limits the cookie to secure connections.
+	Secure bool
+	// HttpOnly hides the cookie from scripts.
+	HttpOnly bool
+	// SameSite is the SameSite attribute.
+	SameSite SameSite
+	// Partitioned keys the cookie by the top-level site, see CHIPS. It
+	// requires Secure.
+	Partitioned bool
+}
+
+// String returns the serialization of c as the value of a Set-Cookie field.
+// It does not validate c, see Valid.
+func (c *Cookie) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(c.Value)
+	if c.Path != "" {
+		b.WriteString("; Path=")
+		b.WriteString(c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=")
+		b.WriteString(strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=")
+		b.WriteString(c.Expires.UTC().Format(response.TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=")
+		b.WriteString(strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+// Valid reports whether c can be sent in a Set-Cookie field and would be
+// accepted by clients following RFC 6265bis:
+//
+//   - Name is a non-empty token and Value consists of cookie-octets,
+//     optionally in double quotes.
+//   - Path and Domain contain no control characters or ';'.
+//   - Expires is not before the year 1601.
+//   - SameSite=None and Partitioned come with Secure.
+//   - Names prefixed with "__Secure-" are Secure, and names prefixed with
+//     "__Host-" are also limited to Path "/" without a Domain.
+func (c *Cookie) Valid() error {
+	if c.Name == "" || !isToken(c.Name) {
+		return fmt.Errorf("Error: invalid cookie name %q", c.Name)
+	}
+	if !isValidValue(c.Value) {
+		return fmt.Errorf("Error: invalid value for cookie %q", c.Name)
+	}
+	if !isValidAttribute(c.Path) {
+		return fmt.Errorf("Error: invalid cookie path %q", c.Path)
+	}
+	if !isValidAttribute(c.Domain) {
+		return fmt.Errorf("Error: invalid cookie domain %q", c.Domain)
+	}
+	if !c.Expires.IsZero() && c.Expires.Year() < 1601 {
+		return fmt.Errorf("Error: cookie expiry %v is before 1601", c.Expires)
+	}
+	if c.SameSite == SameSiteNone && !c.Secure {
+		return fmt.Errorf("Error: a cookie with SameSite=None requires Secure")
+	}
+	if c.Partitioned && !c.Secure {
+		return fmt.Errorf("Error: a Partitioned cookie requires Secure")
+	}
+	if strings.HasPrefix(c.Name, "__Secure-") && !c.Secure {
+		return fmt.Errorf("Error: cookie %q requires Secure", c.Name)
+	}
+	if strings.HasPrefix(c.Name, "__Host-") && (!c.Secure || c.Path != "/" || c.Domain != "") {
+		return fmt.Errorf("Error: cookie %q requires Secure and Path=/ without a Domain", c.Name)
+	}
+	return nil
+}
+
+// Set validates c and adds it to h as a Set-Cookie field. Several cookies
+// set on the same headers are written as separate field lines, see
+// headers.Headers.Values.
+func Set(h headers.Headers, c *Cookie) error {
+	if err := c.Valid(); err != nil {
+		return err
+	}
+	return h.Add("set-cookie", c.String())
+}
+
+// Parse parses the value of a Cookie header, a list of name=value pairs
+// separated by "; ", in order. Pairs with an invalid name or value are
+// skipped, and double quotes around a value are removed.
+func Parse(value string) []*Cookie {
+	var cookies []*Cookie
+	for _, pair := range strings.Split(value, ";") {
+		pair = strings.Trim(pair, " \t")
+		name, val, ok := strings.Cut(pair, "=")
+		if !ok || !isToken(name) || !isValidValue(val) {
+			continue
+		}
+		if len(val) >= 2 && val[0] == '"' {
+			val = val[1 : len(val)-1]
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: val})
+	}
+	return cookies
+}
+
+// isToken reports whether s consists of RFC 9110 token characters.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidValue reports whether s is a cookie-value: cookie-octets, which
+// exclude whitespace, DQUOTE, ',', ';' and '\', optionally in double quotes.
+func isValidValue(s string) bool {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x21 || c > 0x7e || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidAttribute reports whether s can be an attribute value: it contains
+// no control characters or ';'.
+func isValidAttribute(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c == 0x7f || c == ';' {
+			return false
+		}
+	}
+	return true
+}
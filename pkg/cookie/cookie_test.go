@@ -0,0 +1,95 @@
+package cookie
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestString(t *testing.T) {
+	// Test: Only the name and value without attributes
+	assert.Equal(t, "id=42", (&Cookie{Name: "id", Value: "42"}).String())
+
+	// Test: All attributes, in a fixed order
+	c := &Cookie{
+		Name:        "__Host-session",
+		Value:       "abc",
+		Path:        "/",
+		Expires:     time.Date(2030, time.January, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteStrict,
+		Partitioned: true,
+	}
+	assert.Equal(t, "__Host-session=abc; Path=/; Expires=Wed, 02 Jan 2030 02:04:05 GMT; Max-Age=3600; Secure; HttpOnly; SameSite=Strict; Partitioned", c.String())
+	require.NoError(t, c.Valid())
+
+	// Test: A negative MaxAge deletes the cookie, and the leading dot of a
+	// domain is dropped
+	c = &Cookie{Name: "old", Domain: ".example.com", MaxAge: -1, SameSite: SameSiteLax}
+	assert.Equal(t, "old=; Domain=example.com; Max-Age=0; SameSite=Lax", c.String())
+	require.NoError(t, c.Valid())
+}
+
+func TestValid(t *testing.T) {
+	invalid := map[string]*Cookie{
+		"empty name":              {Value: "x"},
+		"name with space":         {Name: "a b"},
+		"name with separator":     {Name: "a=b"},
+		"value with space":        {Name: "a", Value: "x y"},
+		"value with semicolon":    {Name: "a", Value: "x;y"},
+		"value with comma":        {Name: "a", Value: "x,y"},
+		"value with stray quote":  {Name: "a", Value: `"x`},
+		"path with semicolon":     {Name: "a", Path: "/; Secure"},
+		"domain with control":     {Name: "a", Domain: "example.com\r\n"},
+		"ancient expiry":          {Name: "a", Expires: time.Date(1600, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		"SameSite=None insecure":  {Name: "a", SameSite: SameSiteNone},
+		"Partitioned insecure":    {Name: "a", Partitioned: true},
+		"__Secure- insecure":      {Name: "__Secure-a"},
+		"__Host- with domain":     {Name: "__Host-a", Secure: true, Path: "/", Domain: "example.com"},
+		"__Host- with other path": {Name: "__Host-a", Secure: true, Path: "/app"},
+	}
+	for name, c := range invalid {
+		assert.Error(t, c.Valid(), name)
+	}
+
+	// Test: Quoted values and SameSite=None with Secure are valid
+	require.NoError(t, (&Cookie{Name: "a", Value: `"x"`}).Valid())
+	require.NoError(t, (&Cookie{Name: "a", SameSite: SameSiteNone, Secure: true}).Valid())
+}
+
+func TestSet(t *testing.T) {
+	// Test: Cookies are added as separate Set-Cookie lines
+	h := headers.NewHeaders()
+	require.NoError(t, Set(h, &Cookie{Name: "a", Value: "1", Expires: time.Date(2030, time.January, 2, 3, 4, 5, 0, time.UTC)}))
+	require.NoError(t, Set(h, &Cookie{Name: "b", Value: "2"}))
+	assert.Equal(t, []string{"a=1; Expires=Wed, 02 Jan 2030 03:04:05 GMT", "b=2"}, h.Values("Set-Cookie"))
+
+	// Test: Invalid cookies are not added
+	require.Error(t, Set(h, &Cookie{Name: "c", Value: "x\ny"}))
+	assert.Len(t, h.Values("Set-Cookie"), 2)
+}
+
+func TestParse(t *testing.T) {
+	pairs := func(cookies []*Cookie) []string {
+		var s []string
+		for _, c := range cookies {
+			s = append(s, c.Name+"="+c.Value)
+		}
+		return s
+	}
+
+	// Test: Pairs are parsed in order, keeping duplicates
+	assert.Equal(t, []string{"a=1", "b=2", "a=3"}, pairs(Parse("a=1; b=2; a=3")))
+
+	// Test: Extra whitespace, empty values and quotes
+	assert.Equal(t, []string{"a=", "b=x", "c=q"}, pairs(Parse(" a= ;b=x;\tc=\"q\" ")))
+
+	// Test: Invalid pairs are skipped
+	assert.Equal(t, []string{"ok=1"}, pairs(Parse(`noequals; bad name=1; v=a,b; ok=1; q="x`)))
+	assert.Empty(t, Parse(""))
+}
@@ -0,0 +1,289 @@
+// Package fileserver serves static files from an fs.FS or a directory.
+//
+// Files are streamed to the client rather than read into memory, with a
+// Content-Type derived from the file extension or, failing that, from the
+// content. Responses carry Last-Modified and ETag headers, and the
+// preconditions of requests are evaluated with package conditional, so
+// revalidating an unchanged file gets 304 Not Modified. Files that implement
+// io.Seeker, such as those of a directory, are served with support for range
+// requests, see package byterange.
+//
+// Example:
+//
+//	handler, err := fileserver.Dir("./public", &fileserver.Options{Index: "index.html"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	s, err := server.Serve(8080, handler)
+package fileserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/byterange"
+	"github.com/sp41414/goHttp/pkg/conditional"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffLen is the number of bytes read to detect the type of a file without
+// a known extension.
+const sniffLen = 512
+
+// Options configures a file server.
+type Options struct {
+	// Index is the file served for a directory, e.g. "index.html". No index
+	// file is served if it is empty.
+	Index string
+	// Listing serves an HTML list of the entries of a directory without an
+	// index file. Such directories are not found otherwise.
+	Listing bool
+}
+
+// Dir returns a handler serving the files in the directory root. opts may
+// be nil.
+//
+// The directory is opened with os.OpenRoot, so nothing outside of it is
+// served, not even through a symbolic link pointing out of it. It stays open
+// for as long as the handler is in use.
+func Dir(root string, opts *Options) (server.Handler, error) {
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	return FS(r.FS(), opts), nil
+}
+
+// FS returns a handler serving the files of fsys. The request path, without
+// its query, names the file; "/" is the root of fsys. opts may be nil.
+//
+// Only GET and HEAD requests are served. Paths are cleaned before use, and
+// those that would escape the root, e.g. with "..", are rejected, as are
+// requests for directories not ending in a slash, which are redirected to
+// the path with the slash so relative links in their index work.
+func FS(fsys fs.FS, opts *Options) server.Handler {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+
+	return func(w *response.Writer, req *request.Request) {
+		method := req.RequestLine.Method
+		if method != "GET" && method != "HEAD" {
+			h := response.GetDefaultHeaders(0)
+			h["allow"] = "GET, HEAD"
+			w.WriteStatusLine(response.METHOD_NOT_ALLOWED)
+			w.WriteHeaders(h)
+			return
+		}
+
+		urlPath, ok := requestPath(req.RequestLine.RequestTarget)
+		if !ok {
+			response.WriteError(w, response.BAD_REQUEST, "invalid request path")
+			return
+		}
+		name := strings.TrimPrefix(path.Clean(urlPath), "/")
+		if name == "" {
+			name = "."
+		}
+		if !fs.ValidPath(name) || strings.ContainsAny(name, "\\\x00") {
+			response.WriteError(w, response.NOT_FOUND, "file not found")
+			return
+		}
+
+		serve(w, req, fsys, name, urlPath, o)
+	}
+}
+
+// requestPath returns the unescaped path of an origin-form request target.
+func requestPath(target string) (string, bool) {
+	target, _, _ = strings.Cut(target, "?")
+	if !strings.HasPrefix(target, "/") {
+		return "", false
+	}
+	p, err := url.PathUnescape(target)
+	if err != nil {
+		return "", false
+	}
+	return p, true
+}
+
+// serve answers req with the file or directory name of fsys, requested as
+// urlPath.
+func serve(w *response.Writer, req *request.Request, fsys fs.FS, name, urlPath string, o Options) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(urlPath, "/") {
+			redirect(w, url.PathEscape(path.Base(urlPath))+"/")
+			return
+		}
+		if o.Index != "" {
+			index, err := fsys.Open(path.Join(name, o.Index))
+			if err == nil {
+				defer index.Close()
+				if indexInfo, err := index.Stat(); err == nil && indexInfo.Mode().IsRegular() {
+					serveFile(w, req, index, indexInfo)
+					return
+				}
+			}
+		}
+		if o.Listing {
+			serveListing(w, fsys, name, urlPath)
+			return
+		}
+		response.WriteError(w, response.NOT_FOUND, "file not found")
+		return
+	}
+
+	if !info.Mode().IsRegular() {
+		response.WriteError(w, response.NOT_FOUND, "file not found")
+		return
+	}
+	serveFile(w, req, f, info)
+}
+
+// serveFile streams the regular file f to the client, unless a
+// precondition of the request fails.
+func serveFile(w *response.Writer, req *request.Request, f fs.File, info fs.FileInfo) {
+	h := headers.NewHeaders()
+	modTime := info.ModTime()
+	if !modTime.IsZero() && modTime.Unix() > 0 {
+		h["last-modified"] = modTime.UTC().Format(response.TimeFormat)
+		h["etag"] = fmt.Sprintf(`"%x-%x"`, modTime.UnixNano(), info.Size())
+	}
+
+	v := conditional.Validators{ETag: h["etag"]}
+	if h["last-modified"] != "" {
+		v.LastModified = modTime
+	}
+	if conditional.Check(w, req, v) {
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(info.Name()))
+	var head []byte
+	if contentType == "" {
+		head = make([]byte, sniffLen)
+		n, err := io.ReadFull(f, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			response.WriteError(w, response.INTERNAL_SERVER_ERROR, "could not read file")
+			return
+		}
+		head = head[:n]
+		contentType = detectContentType(head)
+	}
+	h["content-type"] = contentType
+
+	// files that can seek, such as those of os.DirFS, support range requests
+	if content, ok := f.(io.ReadSeeker); ok {
+		byterange.ServeContent(w, req, content, h)
+		return
+	}
+
+	// the sniffed bytes are sent first, so the file is read only once
+	h["content-length"] = strconv.FormatInt(info.Size(), 10)
+	w.WriteStatusLine(response.OK)
+	w.WriteHeaders(h)
+	if req.RequestLine.Method == "HEAD" {
+		return
+	}
+	io.CopyN(response.BodyWriter(w), io.MultiReader(bytes.NewReader(head), f), info.Size())
+}
+
+// detectContentType guesses the type of a file from its first bytes: text
+// if they are valid UTF-8 without control characters other than whitespace,
+// binary otherwise.
+func detectContentType(head []byte) string {
+	// a multi-byte character may be cut off at the end of head
+	for i := 0; i < utf8.UTFMax && len(head) > 0 && !utf8.Valid(head); i++ {
+		head = head[:len(head)-1]
+	}
+	if !utf8.Valid(head) {
+		return "application/octet-stream"
+	}
+	for _, c := range head {
+		if c < ' ' && c != '\t' && c != '\n' && c != '\r' && c != '\f' || c == 0x7f {
+			return "application/octet-stream"
+		}
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// serveListing writes an HTML page linking to the entries of the directory
+// name of fsys.
+func serveListing(w *response.Writer, fsys fs.FS, name, urlPath string) {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+
+	var b strings.Builder
+	title := html.EscapeString(urlPath)
+	fmt.Fprintf(&b, "<!doctype html>\n<meta charset=\"utf-8\">\n<title>Index of %s</title>\n<h1>Index of %s</h1>\n<ul>\n", title, title)
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		link := (&url.URL{Path: entryName}).EscapedPath()
+		if strings.Contains(entryName, ":") {
+			// keep names like "a:b" from being read as a URL scheme
+			link = "./" + link
+		}
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(link), html.EscapeString(entryName))
+	}
+	b.WriteString("</ul>\n")
+
+	body := []byte(b.String())
+	h := response.GetDefaultHeaders(len(body))
+	h["content-type"] = "text/html; charset=utf-8"
+	w.WriteStatusLine(response.OK)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+// redirect writes a 301 Moved Permanently response to location.
+func redirect(w *response.Writer, location string) {
+	h := response.GetDefaultHeaders(0)
+	h["location"] = location
+	w.WriteStatusLine(response.MOVED_PERMANENTLY)
+	w.WriteHeaders(h)
+}
+
+// writeFSError answers a request for a file that could not be opened.
+func writeFSError(w *response.Writer, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		response.WriteError(w, response.NOT_FOUND, "file not found")
+	case errors.Is(err, fs.ErrPermission):
+		response.WriteError(w, response.FORBIDDEN, "permission denied")
+	default:
+		response.WriteError(w, response.INTERNAL_SERVER_ERROR, "could not read file")
+	}
+}
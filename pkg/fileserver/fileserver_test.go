@@ -0,0 +1,194 @@
+package fileserver
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/sp41414/goHttp/pkg/client"
+	"github.com/sp41414/goHttp/pkg/internal/handlertest"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var modTime = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+var testFS = fstest.MapFS{
+	"hello.txt":         {Data: []byte("hello world"), ModTime: modTime},
+	"style.css":         {Data: []byte("body {}"), ModTime: modTime},
+	"README":            {Data: []byte("plain text without an extension"), ModTime: modTime},
+	"blob":              {Data: []byte{0x00, 0x01, 0x02}, ModTime: modTime},
+	"docs/index.html":   {Data: []byte("<h1>docs</h1>"), ModTime: modTime},
+	"files/a.txt":       {Data: []byte("a"), ModTime: modTime},
+	"files/<script>.md": {Data: []byte("b"), ModTime: modTime},
+	"files/sub/c.txt":   {Data: []byte("c"), ModTime: modTime},
+}
+
+func TestServeFiles(t *testing.T) {
+	handler := FS(testFS, &Options{Index: "index.html", Listing: true})
+
+	// Test: A file is served with its type, length and validators
+	res, body := handlertest.Serve(t, handler, "GET", "/hello.txt")
+	assert.Equal(t, response.OK, res.StatusCode)
+	assert.Equal(t, "hello world", body)
+	assert.Equal(t, "text/plain; charset=utf-8", res.Headers.Get("Content-Type"))
+	assert.Equal(t, int64(11), res.ContentLength)
+	assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", res.Headers.Get("Last-Modified"))
+	etag := res.Headers.Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]+-b"$`, etag)
+
+	// Test: Types come from the extension, or from the content
+	res, _ = handlertest.Serve(t, handler, "GET", "/style.css")
+	assert.Equal(t, "text/css; charset=utf-8", res.Headers.Get("Content-Type"))
+	res, body = handlertest.Serve(t, handler, "GET", "/README")
+	assert.Equal(t, "text/plain; charset=utf-8", res.Headers.Get("Content-Type"))
+	assert.Equal(t, "plain text without an extension", body)
+	res, _ = handlertest.Serve(t, handler, "GET", "/blob")
+	assert.Equal(t, "application/octet-stream", res.Headers.Get("Content-Type"))
+
+	// Test: Escaped paths and queries
+	res, body = handlertest.Serve(t, handler, "GET", "/hello%2Etxt?v=1")
+	assert.Equal(t, response.OK, res.StatusCode)
+	assert.Equal(t, "hello world", body)
+
+	// Test: HEAD has the headers of GET without the body
+	res, body = handlertest.Serve(t, handler, "HEAD", "/hello.txt")
+	assert.Equal(t, response.OK, res.StatusCode)
+	assert.Equal(t, "11", res.Headers.Get("Content-Length"))
+	assert.Empty(t, body)
+
+	// Test: Other methods are not allowed
+	res, _ = handlertest.Serve(t, handler, "POST", "/hello.txt")
+	assert.Equal(t, response.METHOD_NOT_ALLOWED, res.StatusCode)
+	assert.Equal(t, "GET, HEAD", res.Headers.Get("Allow"))
+
+	// Test: Unknown files are not found
+	res, _ = handlertest.Serve(t, handler, "GET", "/missing.txt")
+	assert.Equal(t, response.NOT_FOUND, res.StatusCode)
+
+	// Test: Revalidation with If-None-Match and If-Modified-Since
+	res, body = handlertest.Serve(t, handler, "GET", "/hello.txt", "If-None-Match: W/"+etag)
+	assert.Equal(t, response.NOT_MODIFIED, res.StatusCode)
+	assert.Empty(t, body)
+	assert.Equal(t, etag, res.Headers.Get("ETag"))
+	res, _ = handlertest.Serve(t, handler, "GET", "/hello.txt", `If-None-Match: "other"`)
+	assert.Equal(t, response.OK, res.StatusCode)
+	res, _ = handlertest.Serve(t, handler, "GET", "/hello.txt", "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT")
+	assert.Equal(t, response.NOT_MODIFIED, res.StatusCode)
+	res, _ = handlertest.Serve(t, handler, "GET", "/hello.txt", "If-Modified-Since: Fri, 01 Mar 2024 11:59:59 GMT")
+	assert.Equal(t, response.OK, res.StatusCode)
+	res, _ = handlertest.Serve(t, handler, "GET", "/hello.txt", `If-None-Match: "other"`, "If-Modified-Since: Fri, 01 Mar 2024 12:00:00 GMT")
+	assert.Equal(t, response.OK, res.StatusCode, "If-None-Match takes precedence")
+}
+
+func TestServeDirectories(t *testing.T) {
+	handler := FS(testFS, &Options{Index: "index.html", Listing: true})
+
+	// Test: Directories without a trailing slash are redirected
+	res, _ := handlertest.Serve(t, handler, "GET", "/docs")
+	assert.Equal(t, response.MOVED_PERMANENTLY, res.StatusCode)
+	assert.Equal(t, "docs/", res.Headers.Get("Location"))
+
+	// Test: The index file is served for a directory
+	res, body := handlertest.Serve(t, handler, "GET", "/docs/")
+	assert.Equal(t, "text/html; charset=utf-8", res.Headers.Get("Content-Type"))
+	assert.Equal(t, "<h1>docs</h1>", body)
+
+	// Test: Directories without an index are listed, escaping names
+	res, body = handlertest.Serve(t, handler, "GET", "/files/")
+	assert.Equal(t, response.OK, res.StatusCode)
+	assert.Contains(t, body, `<a href="a.txt">a.txt</a>`)
+	assert.Contains(t, body, `<a href="sub/">sub/</a>`)
+	assert.Contains(t, body, `<a href="%3Cscript%3E.md">&lt;script&gt;.md</a>`)
+	assert.NotContains(t, body, "<script>")
+
+	// Test: Without options there is no index or listing
+	res, _ = handlertest.Serve(t, FS(testFS, nil), "GET", "/docs/")
+	assert.Equal(t, response.NOT_FOUND, res.StatusCode)
+}
+
+func TestPathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "public")
+	require.NoError(t, os.Mkdir(root, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "ok.txt"), []byte("ok"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "link.txt")))
+	require.NoError(t, os.Symlink("..", filepath.Join(root, "parent")))
+	handler, err := Dir(root, nil)
+	require.NoError(t, err)
+
+	res, body := handlertest.Serve(t, handler, "GET", "/ok.txt")
+	assert.Equal(t, response.OK, res.StatusCode)
+	assert.Equal(t, "ok", body)
+
+	// Test: Paths cannot escape the root, however they are spelled
+	for _, target := range []string{
+		"/../secret.txt",
+		"/%2e%2e/secret.txt",
+		"/sub/../../secret.txt",
+		"/..%2fsecret.txt",
+		"/..%5csecret.txt",
+		"/ok.txt%00",
+		"/link.txt",
+		"/parent/secret.txt",
+	} {
+		res, body = handlertest.Serve(t, handler, "GET", target)
+		assert.NotEqual(t, response.OK, res.StatusCode, target)
+		assert.NotContains(t, body, "secret", target)
+	}
+
+	// Test: Targets that are not paths are rejected
+	res, _ = handlertest.Serve(t, handler, "GET", "http://localhost/ok.txt")
+	assert.Equal(t, response.BAD_REQUEST, res.StatusCode)
+	res, _ = handlertest.Serve(t, handler, "GET", "/bad%zz")
+	assert.Equal(t, response.BAD_REQUEST, res.StatusCode)
+}
+
+func TestServeLargeFile(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "large.bin"), data, 0o644))
+
+	handler, err := Dir(dir, nil)
+	require.NoError(t, err)
+	s, err := server.Serve(0, handler)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: A file larger than the read buffers is streamed completely
+	res, err := client.Get("http://" + s.Listener.Addr().String() + "/large.bin")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, int(response.OK), res.StatusCode)
+	assert.Equal(t, data, body)
+}
+
+func TestServeRanges(t *testing.T) {
+	handler := FS(testFS, nil)
+
+	// Test: Files support range requests
+	res, body := handlertest.Serve(t, handler, "GET", "/hello.txt", "Range: bytes=6-")
+	assert.Equal(t, response.PARTIAL_CONTENT, res.StatusCode)
+	assert.Equal(t, "world", body)
+	assert.Equal(t, "bytes 6-10/11", res.Headers.Get("Content-Range"))
+	assert.Equal(t, "text/plain; charset=utf-8", res.Headers.Get("Content-Type"))
+
+	// Test: Sniffing the type does not skip the start of the range
+	res, body = handlertest.Serve(t, handler, "GET", "/README", "Range: bytes=0-4")
+	assert.Equal(t, response.PARTIAL_CONTENT, res.StatusCode)
+	assert.Equal(t, "plain", body)
+
+	// Test: A stale If-Range gets the whole file
+	res, body = handlertest.Serve(t, handler, "GET", "/hello.txt", "Range: bytes=6-", `If-Range: "stale"`)
+	assert.Equal(t, response.OK, res.StatusCode)
+	assert.Equal(t, "hello world", body)
+}
@@ -0,0 +1,385 @@
+// Package form parses HTML form submissions: application/x-www-form-urlencoded
+// and multipart/form-data request bodies, merged with the query parameters
+// of the request target.
+//
+// Parse reads a whole form, keeping small file uploads in memory and
+// writing larger ones to temporary files:
+//
+//	func upload(w *response.Writer, req *request.Request) {
+//		f, err := form.Parse(req, nil)
+//		if err != nil {
+//			// answer 400 Bad Request
+//		}
+//		defer f.RemoveAll()
+//		title := f.Values.Get("title")
+//		for _, file := range f.Files["attachment"] {
+//			...
+//		}
+//	}
+//
+// NewPartReader reads the parts of a multipart body one by one instead,
+// without collecting them into a Form.
+//
+// A body deferred until the client receives 100 Continue, see
+// server.DeferExpectedBodies, is read straight from the connection: a
+// multipart body streams part by part, so large files go to temporary files
+// without the whole body being held in memory, and a urlencoded body larger
+// than Options.MaxPartSize is refused as soon as that is known.
+package form
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/request"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	// DefaultMaxMemory is the default Options.MaxMemory.
+	DefaultMaxMemory = 10 << 20
+	// DefaultMaxFields is the default Options.MaxFields.
+	DefaultMaxFields = 1000
+	// DefaultMaxPartSize is the default Options.MaxPartSize.
+	DefaultMaxPartSize = 32 << 20
+)
+
+var (
+	// ErrTooManyFields is returned for a form with more fields than
+	// Options.MaxFields.
+	ErrTooManyFields = errors.New("Error: too many fields")
+	// ErrPartTooLarge is returned for a form field or file larger than
+	// Options.MaxPartSize.
+	ErrPartTooLarge = errors.New("Error: part too large")
+	// ErrNotMultipart is returned by NewPartReader for a request without a
+	// multipart/form-data body.
+	ErrNotMultipart = errors.New("Error: request is not multipart/form-data")
+)
+
+// Options limits the resources a form may use. The zero value of each field
+// selects its default.
+type Options struct {
+	// MaxMemory is the number of bytes of uploaded files kept in memory.
+	// Files beyond it are written to temporary files.
+	MaxMemory int64
+	// MaxFields is the largest number of fields, counting query parameters,
+	// values and files.
+	MaxFields int
+	// MaxPartSize is the largest size of a single value or file of a
+	// multipart body, and of a whole urlencoded body.
+	MaxPartSize int64
+	// TempDir is the directory of temporary files, os.TempDir() if empty.
+	TempDir string
+}
+
+// withDefaults returns opts, which may be nil, with zero fields set to their
+// defaults.
+func withDefaults(opts *Options) Options {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxMemory <= 0 {
+		o.MaxMemory = DefaultMaxMemory
+	}
+	if o.MaxFields <= 0 {
+		o.MaxFields = DefaultMaxFields
+	}
+	if o.MaxPartSize <= 0 {
+		o.MaxPartSize = DefaultMaxPartSize
+	}
+	return o
+}
+
+// Form is a parsed form.
+type Form struct {
+	// Values holds the form values followed by the query parameters of the
+	// same name, so Values.Get prefers the body.
+	Values url.Values
+	// Files holds the uploaded files of a multipart form by field name.
+	Files map[string][]*File
+}
+
+// File is an uploaded file of a multipart form.
+type File struct {
+	// Filename is the name the client gave the file, without any directory.
+	Filename string
+	// Header holds the headers of the part, with lowercase names.
+	Header headers.Headers
+	// Size is the size of the file in bytes.
+	Size int64
+
+	content []byte
+	path    string
+}
+
+// Open returns the content of the file.
+func (f *File) Open() (io.ReadSeekCloser, error) {
+	if f.path != "" {
+		return os.Open(f.path)
+	}
+	return nopCloser{bytes.NewReader(f.content)}, nil
+}
+
+// RemoveAll removes the temporary files of the form.
+func (f *Form) RemoveAll() error {
+	var errs []error
+	for _, files := range f.Files {
+		for _, file := range files {
+			if file.path == "" {
+				continue
+			}
+			if err := os.Remove(file.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Parse parses the query parameters of req and, depending on its
+// Content-Type, a urlencoded or multipart form body. Bodies of other types
+// are ignored. opts may be nil.
+//
+// A body deferred by server.DeferExpectedBodies is read from the connection,
+// which sends 100 Continue.
+//
+// On error, temporary files already written are removed.
+func Parse(req *request.Request, opts *Options) (*Form, error) {
+	o := withDefaults(opts)
+	f := &Form{Values: url.Values{}, Files: map[string][]*File{}}
+
+	_, rawQuery, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	query, err := parseQuery(rawQuery, o.MaxFields)
+	if err != nil {
+		return nil, err
+	}
+	fields := countValues(query)
+
+	mediaType, _, _ := mime.ParseMediaType(req.Headers.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		body, err := req.ReadBodyLimit(o.MaxPartSize)
+		if errors.Is(err, request.ErrBodyTooLarge) {
+			return nil, ErrPartTooLarge
+		}
+		if err != nil {
+			return nil, err
+		}
+		values, err := parseQuery(string(body), o.MaxFields-fields)
+		if err != nil {
+			return nil, err
+		}
+		f.Values = values
+	case "multipart/form-data":
+		if err := f.readMultipart(req, o, o.MaxFields-fields); err != nil {
+			f.RemoveAll()
+			return nil, err
+		}
+	}
+
+	for name, values := range query {
+		f.Values[name] = append(f.Values[name], values...)
+	}
+	return f, nil
+}
+
+// readMultipart reads the parts of a multipart body into f, allowing at
+// most maxFields parts.
+func (f *Form) readMultipart(req *request.Request, o Options, maxFields int) error {
+	pr, err := NewPartReader(req, &o)
+	if err != nil {
+		return err
+	}
+
+	memory := o.MaxMemory
+	for n := 0; ; n++ {
+		part, err := pr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n >= maxFields {
+			return ErrTooManyFields
+		}
+
+		if part.Filename == "" {
+			value, err := io.ReadAll(part)
+			if err != nil {
+				return err
+			}
+			f.Values.Add(part.Name, string(value))
+			continue
+		}
+
+		file := &File{Filename: part.Filename, Header: part.Header}
+		f.Files[part.Name] = append(f.Files[part.Name], file)
+		// read one byte more than fits, to know whether the file does
+		content, err := io.ReadAll(io.LimitReader(part, memory+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(content)) <= memory {
+			file.content = content
+			file.Size = int64(len(content))
+			memory -= file.Size
+			continue
+		}
+		if err := file.spill(o.TempDir, content, part); err != nil {
+			return err
+		}
+	}
+}
+
+// spill writes the file to a temporary file: the content read so far,
+// followed by the rest of part.
+func (f *File) spill(dir string, content []byte, part io.Reader) error {
+	tmp, err := os.CreateTemp(dir, "form-*")
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+	f.path = tmp.Name()
+
+	n, err := io.Copy(tmp, io.MultiReader(bytes.NewReader(content), part))
+	if err != nil {
+		return err
+	}
+	f.Size = n
+	return tmp.Close()
+}
+
+// parseQuery parses urlencoded values, failing if there are more than
+// maxFields of them.
+func parseQuery(s string, maxFields int) (url.Values, error) {
+	if s == "" {
+		return url.Values{}, nil
+	}
+	if strings.Count(s, "&")+1 > maxFields {
+		return nil, ErrTooManyFields
+	}
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, fmt.Errorf("Error: invalid urlencoded data (%v)", err)
+	}
+	return values, nil
+}
+
+// countValues returns the number of values in values.
+func countValues(values url.Values) int {
+	n := 0
+	for _, v := range values {
+		n += len(v)
+	}
+	return n
+}
+
+// PartReader reads the parts of a multipart/form-data body one by one.
+type PartReader struct {
+	r           *multipart.Reader
+	maxPartSize int64
+}
+
+// NewPartReader returns a reader for the parts of the multipart/form-data
+// body of req. A deferred body is streamed from the connection as the parts
+// are read, see request.Request.BodyReader. Of opts, which may be nil, only
+// MaxPartSize applies.
+func NewPartReader(req *request.Request, opts *Options) (*PartReader, error) {
+	mediaType, params, err := mime.ParseMediaType(req.Headers.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, ErrNotMultipart
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, fmt.Errorf("Error: multipart/form-data without a boundary")
+	}
+
+	body, err := req.BodyReader()
+	if err != nil {
+		return nil, err
+	}
+
+	o := withDefaults(opts)
+	return &PartReader{
+		r:           multipart.NewReader(body, boundary),
+		maxPartSize: o.MaxPartSize,
+	}, nil
+}
+
+// Part is a single part of a multipart form. Reading it yields its content,
+// failing with ErrPartTooLarge beyond Options.MaxPartSize.
+type Part struct {
+	// Name is the name of the form field.
+	Name string
+	// Filename is the name of an uploaded file, without any directory. It
+	// is empty for other values.
+	Filename string
+	// Header holds the headers of the part, with lowercase names.
+	Header headers.Headers
+
+	r         io.Reader
+	remaining int64
+}
+
+func (p *Part) Read(b []byte) (int, error) {
+	if p.remaining < 0 {
+		return 0, ErrPartTooLarge
+	}
+	if int64(len(b)) > p.remaining+1 {
+		b = b[:p.remaining+1]
+	}
+	n, err := p.r.Read(b)
+	p.remaining -= int64(n)
+	if p.remaining < 0 {
+		return n + int(p.remaining), ErrPartTooLarge
+	}
+	return n, err
+}
+
+// NextPart returns the next part, or io.EOF after the last one. The
+// unread content of the previous part is skipped.
+func (pr *PartReader) NextPart() (*Part, error) {
+	for {
+		part, err := pr.r.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("Error: invalid multipart body (%v)", err)
+		}
+		name := part.FormName()
+		if name == "" {
+			// not a form field
+			continue
+		}
+
+		h := headers.NewHeaders()
+		for k, v := range part.Header {
+			h[strings.ToLower(k)] = strings.Join(v, ", ")
+		}
+		return &Part{
+			Name:      name,
+			Filename:  part.FileName(),
+			Header:    h,
+			r:         part,
+			remaining: pr.maxPartSize,
+		}, nil
+	}
+}
+
+// nopCloser adds a Close method that does nothing to a bytes.Reader.
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,272 @@
+package form
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRequest parses a POST request to target with the content type and
+// body.
+func newRequest(t *testing.T, target, contentType string, body []byte) *request.Request {
+	t.Helper()
+	raw := fmt.Sprintf("POST %s HTTP/1.1\r\nHost: localhost\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s", target, contentType, len(body), body)
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	return req
+}
+
+// multipartBody builds a multipart/form-data body with the values and
+// files, returning its content type.
+func multipartBody(t *testing.T, values map[string]string, files map[string]string) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for name, value := range values {
+		require.NoError(t, mw.WriteField(name, value))
+	}
+	for name, content := range files {
+		fw, err := mw.CreateFormFile(name, name+".txt")
+		require.NoError(t, err)
+		_, err = io.WriteString(fw, content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	return mw.FormDataContentType(), buf.Bytes()
+}
+
+func readFile(t *testing.T, file *File) string {
+	t.Helper()
+	r, err := file.Open()
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestParseURLEncoded(t *testing.T) {
+	// Test: Body values come before query parameters of the same name
+	req := newRequest(t, "/submit?name=query&page=2", "application/x-www-form-urlencoded", []byte("name=body&tags=a&tags=b+c%21"))
+	f, err := Parse(req, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"body", "query"}, f.Values["name"])
+	assert.Equal(t, []string{"a", "b c!"}, f.Values["tags"])
+	assert.Equal(t, "2", f.Values.Get("page"))
+
+	// Test: Other content types only give the query
+	req = newRequest(t, "/submit?a=1", "application/json", []byte(`{"b":2}`))
+	f, err = Parse(req, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1", f.Values.Get("a"))
+	assert.Len(t, f.Values, 1)
+
+	// Test: Invalid escapes are rejected
+	req = newRequest(t, "/submit", "application/x-www-form-urlencoded", []byte("a=%zz"))
+	_, err = Parse(req, nil)
+	require.Error(t, err)
+
+	// Test: The field limit counts the query and the body
+	req = newRequest(t, "/submit?a=1&b=2", "application/x-www-form-urlencoded", []byte("c=3&d=4"))
+	_, err = Parse(req, &Options{MaxFields: 3})
+	require.ErrorIs(t, err, ErrTooManyFields)
+	_, err = Parse(req, &Options{MaxFields: 4})
+	require.NoError(t, err)
+
+	// Test: The body size limit
+	req = newRequest(t, "/submit", "application/x-www-form-urlencoded", []byte("a="+strings.Repeat("x", 100)))
+	_, err = Parse(req, &Options{MaxPartSize: 50})
+	require.ErrorIs(t, err, ErrPartTooLarge)
+}
+
+func TestParseMultipart(t *testing.T) {
+	contentType, body := multipartBody(t,
+		map[string]string{"title": "report"},
+		map[string]string{"small": "tiny file", "large": strings.Repeat("x", 2000)},
+	)
+	req := newRequest(t, "/upload?title=query", contentType, body)
+
+	// Test: Small files stay in memory, large ones spill to temp files
+	dir := t.TempDir()
+	f, err := Parse(req, &Options{MaxMemory: 1000, TempDir: dir})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"report", "query"}, f.Values["title"])
+
+	small := f.Files["small"][0]
+	assert.Equal(t, "small.txt", small.Filename)
+	assert.Equal(t, int64(9), small.Size)
+	assert.Equal(t, "application/octet-stream", small.Header.Get("Content-Type"))
+	assert.Equal(t, "tiny file", readFile(t, small))
+	assert.Empty(t, small.path)
+
+	large := f.Files["large"][0]
+	assert.Equal(t, int64(2000), large.Size)
+	assert.Equal(t, strings.Repeat("x", 2000), readFile(t, large))
+	require.NotEmpty(t, large.path)
+	assert.Equal(t, dir, large.path[:len(dir)])
+
+	// Test: RemoveAll deletes the temporary files
+	require.NoError(t, f.RemoveAll())
+	_, err = os.Stat(large.path)
+	assert.True(t, os.IsNotExist(err))
+
+	// Test: Limits on the number of parts and their size, removing the
+	// temporary files on error
+	_, err = Parse(req, &Options{MaxFields: 2})
+	require.ErrorIs(t, err, ErrTooManyFields)
+	_, err = Parse(req, &Options{MaxPartSize: 1000, MaxMemory: 10, TempDir: dir})
+	require.ErrorIs(t, err, ErrPartTooLarge)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Test: A malformed body is an error
+	req = newRequest(t, "/upload", "multipart/form-data; boundary=xyz", []byte("garbage"))
+	_, err = Parse(req, nil)
+	require.Error(t, err)
+}
+
+func TestPartReader(t *testing.T) {
+	contentType, body := multipartBody(t, map[string]string{"a": "1"}, map[string]string{"doc": "content"})
+	req := newRequest(t, "/upload", contentType, body)
+
+	// Test: Parts are streamed in order with their headers
+	pr, err := NewPartReader(req, nil)
+	require.NoError(t, err)
+	var parts []string
+	for {
+		part, err := pr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Contains(t, part.Header.Get("Content-Disposition"), `name="`+part.Name+`"`)
+		parts = append(parts, fmt.Sprintf("%s %q %s", part.Name, part.Filename, data))
+	}
+	assert.Equal(t, []string{`a "" 1`, `doc "doc.txt" content`}, parts)
+
+	// Test: Reading beyond the part size limit fails
+	pr, err = NewPartReader(req, &Options{MaxPartSize: 3})
+	require.NoError(t, err)
+	_, err = pr.NextPart()
+	require.NoError(t, err)
+	part, err := pr.NextPart()
+	require.NoError(t, err)
+	data, err := io.ReadAll(part)
+	require.ErrorIs(t, err, ErrPartTooLarge)
+	assert.Equal(t, "con", string(data))
+
+	// Test: Other content types are rejected
+	_, err = NewPartReader(newRequest(t, "/upload", "text/plain", []byte("x")), nil)
+	require.ErrorIs(t, err, ErrNotMultipart)
+}
+
+func TestExpectContinue(t *testing.T) {
+	s, err := server.Serve(0, func(w *response.Writer, req *request.Request) {
+		f, err := Parse(req, nil)
+		if err != nil {
+			response.WriteError(w, response.BAD_REQUEST, err.Error())
+			return
+		}
+		defer f.RemoveAll()
+		body := f.Values.Get("title")
+		if files := f.Files["doc"]; len(files) > 0 {
+			body += " " + readFile(t, files[0])
+		}
+		response.WriteError(w, response.OK, body)
+	})
+	require.NoError(t, err)
+	defer s.Close()
+	s.DeferExpectedBodies()
+
+	send := func(contentType string, body []byte) string {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Type: %s\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n", contentType, len(body))
+		reader := bufio.NewReader(conn)
+		res, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusContinue, res.StatusCode)
+		_, err = conn.Write(body)
+		require.NoError(t, err)
+		res, err = http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		data, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return fmt.Sprintf("%d %s", res.StatusCode, data)
+	}
+
+	// Test: A deferred urlencoded body is read after 100 Continue
+	assert.Equal(t, "200 report", send("application/x-www-form-urlencoded", []byte("title=report")))
+
+	// Test: A deferred multipart body is read after 100 Continue
+	contentType, body := multipartBody(t, map[string]string{"title": "report"}, map[string]string{"doc": "content"})
+	assert.Equal(t, "200 report content", send(contentType, body))
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestDeferredBodyLimits(t *testing.T) {
+	deferred := request.Options{DeferExpectedBody: true}
+	head := "POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n"
+
+	// Test: A urlencoded body larger than MaxPartSize is refused unread
+	source := &countingReader{r: strings.NewReader(strings.Repeat("a", 2000))}
+	raw := io.MultiReader(strings.NewReader(fmt.Sprintf(head, "application/x-www-form-urlencoded", 2000)), source)
+	req, err := request.RequestFromReaderWithOptions(raw, deferred)
+	require.NoError(t, err)
+	_, err = Parse(req, &Options{MaxPartSize: 1000})
+	require.ErrorIs(t, err, ErrPartTooLarge)
+	assert.Zero(t, source.read)
+
+	// Test: A multipart body streams from the connection, so an oversized
+	// file is refused after reading little more than MaxPartSize
+	partHead := "--b\r\nContent-Disposition: form-data; name=\"doc\"; filename=\"doc.txt\"\r\n\r\n"
+	source = &countingReader{r: strings.NewReader(partHead + strings.Repeat("a", 1<<20))}
+	raw = io.MultiReader(strings.NewReader(fmt.Sprintf(head, "multipart/form-data; boundary=b", 1<<30)), source)
+	req, err = request.RequestFromReaderWithOptions(raw, deferred)
+	require.NoError(t, err)
+	_, err = Parse(req, &Options{MaxMemory: 100, MaxPartSize: 1000, TempDir: t.TempDir()})
+	require.ErrorIs(t, err, ErrPartTooLarge)
+	assert.Less(t, source.read, 64<<10)
+	assert.Empty(t, req.Body)
+
+	// Test: A streamed multipart body is parsed like any other
+	contentType, body := multipartBody(t, map[string]string{"title": "report"}, map[string]string{"doc": strings.Repeat("x", 500)})
+	raw = io.MultiReader(strings.NewReader(fmt.Sprintf(head, contentType, len(body))), bytes.NewReader(body))
+	req, err = request.RequestFromReaderWithOptions(raw, deferred)
+	require.NoError(t, err)
+	f, err := Parse(req, &Options{MaxMemory: 100, TempDir: t.TempDir()})
+	require.NoError(t, err)
+	defer f.RemoveAll()
+	assert.Equal(t, "report", f.Values.Get("title"))
+	require.Len(t, f.Files["doc"], 1)
+	assert.Equal(t, strings.Repeat("x", 500), readFile(t, f.Files["doc"][0]))
+	assert.Empty(t, req.Body)
+}
@@ -0,0 +1,31 @@
+package headers
+
+import "testing"
+
+var benchHeaders = []byte("Host: localhost:9000\r\n" +
+	"User-Agent: curl/7.81.0\r\n" +
+	"Accept: */*\r\n" +
+	"Accept-Encoding: gzip, deflate, br\r\n" +
+	"Content-Type: application/json\r\n" +
+	"Content-Length: 27\r\n" +
+	"X-Request-Id: 0b5d7c1e\r\n" +
+	"\r\n")
+
+func BenchmarkHeadersParse(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchHeaders)))
+	for b.Loop() {
+		h := NewHeaders()
+		data := benchHeaders
+		for {
+			n, done, err := h.Parse(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			data = data[n:]
+			if done {
+				break
+			}
+		}
+	}
+}
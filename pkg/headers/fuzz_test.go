@@ -0,0 +1,70 @@
+package headers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseAll parses a complete header section from data, feeding it to the
+// parser in pieces of the given size like a network read would.
+func parseAll(data []byte, mode ParseMode, size int) (Headers, int, bool, error) {
+	h := NewHeaders()
+	pending := []byte{}
+	consumed := 0
+	for pos := 0; pos < len(data); pos += size {
+		pending = append(pending, data[pos:min(pos+size, len(data))]...)
+		for {
+			n, done, err := h.ParseWithMode(pending, mode)
+			if err != nil {
+				return h, consumed, false, err
+			}
+			pending = pending[n:]
+			consumed += n
+			if done {
+				return h, consumed, true, nil
+			}
+			if n == 0 {
+				break
+			}
+		}
+	}
+	return h, consumed, false, nil
+}
+
+func FuzzHeadersParse(f *testing.F) {
+	f.Add([]byte("Host: localhost:9000\r\n\r\n"), uint8(3), false)
+	f.Add([]byte("Set-Language: python\r\nSet-Language: go\r\n\r\n"), uint8(1), false)
+	f.Add([]byte("X-Folded: first\r\n  second\r\n\r\n"), uint8(5), true)
+	f.Add([]byte("       Host : localhost:9000  \r\n\r\n"), uint8(2), true)
+
+	f.Fuzz(func(t *testing.T, data []byte, size uint8, lenient bool) {
+		mode := Strict
+		if lenient {
+			mode = Lenient
+		}
+
+		whole, wholeN, wholeDone, wholeErr := parseAll(data, mode, max(len(data), 1))
+		split, splitN, splitDone, splitErr := parseAll(data, mode, max(int(size), 1))
+
+		// the result must not depend on how the input was split
+		if wholeErr != nil {
+			require.Error(t, splitErr)
+			return
+		}
+		require.NoError(t, splitErr)
+		assert.Equal(t, whole, split)
+		assert.Equal(t, wholeN, splitN)
+		assert.Equal(t, wholeDone, splitDone)
+
+		// the parser must never claim more bytes than it was given, and the
+		// stored fields must have come from those bytes
+		assert.LessOrEqual(t, wholeN, len(data))
+		stored := 0
+		for k, v := range whole {
+			stored += len(k) + len(v)
+		}
+		assert.LessOrEqual(t, stored, wholeN)
+	})
+}
@@ -22,7 +22,19 @@ func (h Headers) Get(key string) string {
 	return h[strings.ToLower(key)]
 }
 
-// Parse reads a single header line from the provided data.
+// ParseMode controls how Parse treats input that RFC 9112 allows a recipient
+// to either reject or repair.
+type ParseMode int
+
+const (
+	// Strict rejects obsolete line folding (obs-fold) with an error.
+	Strict ParseMode = iota
+	// Lenient unfolds obs-fold continuation lines by replacing each fold
+	// with a single space, as permitted by RFC 9112 section 5.2.
+	Lenient
+)
+
+// Parse reads a single header line from the provided data in Strict mode.
 // Lines should be formatted as:
 //
 //	Key: Value\r\n
@@ -31,8 +43,27 @@ func (h Headers) Get(key string) string {
 // an empty line (\r\n) is encountered, and any validation errors.
 //
 // If a duplicate key is found, the value is appended to the existing
-// entry as a comma-separated list.
+// entry as a comma-separated list, except for Set-Cookie, see Values.
 func (h Headers) Parse(data []byte) (int, bool, error) {
+	return h.ParseWithMode(data, Strict)
+}
+
+// ParseWithMode is like Parse but lets the caller choose how obsolete line
+// folding is handled.
+//
+// A line that begins with whitespace is always rejected when it cannot be a
+// continuation of a previous field, e.g. whitespace between the start-line
+// and the first field. Field values must not contain control characters
+// other than horizontal tab.
+//
+// In Lenient mode, Parse needs to see the first byte of the following line
+// to know whether the current field continues, so it may return 0 bytes read
+// for a complete line until more data is available.
+func (h Headers) ParseWithMode(data []byte, mode ParseMode) (int, bool, error) {
+	if lf := bytes.IndexByte(data, '\n'); lf == 0 || lf > 0 && data[lf-1] != '\r' {
+		return 0, false, fmt.Errorf("invalid header: line must end with CRLF, found bare LF")
+	}
+
 	idx := bytes.Index(data, []byte("\r\n"))
 	switch idx {
 	case -1:
@@ -41,36 +72,73 @@ func (h Headers) Parse(data []byte) (int, bool, error) {
 		return 2, true, nil
 	}
 
-	parts := bytes.SplitN(data[:idx], []byte(":"), 2)
-	if len(parts) < 2 {
+	if isWhitespace(data[0]) {
+		if len(h) == 0 {
+			return 0, false, fmt.Errorf("invalid header: whitespace before the first field")
+		}
+		return 0, false, fmt.Errorf("invalid header: obsolete line folding is not allowed")
+	}
+
+	line := data[:idx]
+	read := idx + 2
+	if mode == Lenient {
+		// fold any continuation lines into this field, one at a time
+		for {
+			if read >= len(data) {
+				return 0, false, nil
+			}
+			if !isWhitespace(data[read]) {
+				break
+			}
+			next := bytes.Index(data[read:], []byte("\r\n"))
+			if next == -1 {
+				return 0, false, nil
+			}
+			folded := make([]byte, 0, len(line)+1+next)
+			folded = append(folded, bytes.TrimRight(line, " \t")...)
+			folded = append(folded, ' ')
+			folded = append(folded, bytes.TrimLeft(data[read:read+next], " \t")...)
+			line = folded
+			read += next + 2
+		}
+	}
+
+	colon := bytes.IndexByte(line, ':')
+	if colon == -1 {
 		return 0, false, fmt.Errorf("invalid header: missing ':'")
 	}
 
-	if len(parts[0]) == 0 {
+	name := line[:colon]
+	if len(name) == 0 {
 		return 0, false, fmt.Errorf("invalid header: empty key")
 	}
 
-	if parts[0][len(parts[0])-1] == ' ' {
+	if name[len(name)-1] == ' ' {
 		return 0, false, fmt.Errorf("invalid header: space before ':'")
 	}
 
-	for _, c := range parts[0] {
+	for _, c := range name {
 		r := rune(c)
 		if !isValidHeaderChar(r) {
 			return 0, false, fmt.Errorf("invalid header key character (%v): must only contain alphabetical characters, digits, and special characters", r)
 		}
 	}
 
-	key := bytes.ToLower(bytes.TrimSpace(parts[0]))
-	value := bytes.TrimSpace(parts[1])
+	value := bytes.Trim(line[colon+1:], " \t")
+	for _, c := range value {
+		if !isValidValueChar(c) {
+			return 0, false, fmt.Errorf("invalid header value character (%v): must not contain control characters", c)
+		}
+	}
 
-	if _, ok := h[string(key)]; ok {
-		h[string(key)] += fmt.Sprintf(", %s", string(value))
+	key := internKey(name)
+	if prev, ok := h[key]; ok {
+		h[key] = prev + separator(key) + string(value)
 	} else {
-		h[string(key)] = string(value)
+		h[key] = string(value)
 	}
 
-	return idx + 2, false, nil
+	return read, false, nil
 }
 
 // OverrideValue sets the value for a key, replacing any existing data. The key is stored in lowercase.
@@ -90,7 +158,11 @@ func (h Headers) Override(prevKey, newKey, value string) bool {
 	}
 }
 
-// Add appends a value to a key. It validates the key against RFC 9110 tokens.
+// Add appends a value to a key. It validates the key against RFC 9110 tokens,
+// and rejects values containing CR, LF or NUL, see ValidValue. Values of the
+// same key are combined into a comma-separated list, except for
+// Cookie, whose values are joined with "; " (RFC 9113 section 8.2.3), and
+// Set-Cookie, see Values.
 func (h Headers) Add(key, value string) error {
 	for _, c := range key {
 		r := rune(c)
@@ -99,10 +171,14 @@ func (h Headers) Add(key, value string) error {
 		}
 	}
 
+	if !ValidValue(value) {
+		return fmt.Errorf("invalid header value for %q: must not contain CR, LF or NUL", key)
+	}
+
 	key = strings.ToLower(strings.TrimSpace(key))
 	value = strings.TrimSpace(value)
 	if _, ok := h[string(key)]; ok {
-		h[string(key)] += fmt.Sprintf(", %s", string(value))
+		h[string(key)] += separator(key) + value
 	} else {
 		h[string(key)] = string(value)
 	}
@@ -110,6 +186,68 @@ func (h Headers) Add(key, value string) error {
 	return nil
 }
 
+// LowerKeys returns a copy of h with lowercase keys, so that fields of a map
+// built with other keys, such as "Content-Type", can be looked up directly.
+func (h Headers) LowerKeys() Headers {
+	lowered := make(Headers, len(h))
+	for k, v := range h {
+		lowered[strings.ToLower(k)] = v
+	}
+	return lowered
+}
+
+// Values returns the field lines of key using a case-insensitive lookup, or
+// nil if it is absent.
+//
+// Set-Cookie field lines cannot be combined into a comma-separated list,
+// since cookie dates contain commas (RFC 9110 section 5.3). Headers keeps
+// each Set-Cookie value on its own line, separated by '\n', and encoders
+// write one field line per value. Other fields have a single line.
+func (h Headers) Values(key string) []string {
+	value, ok := h[strings.ToLower(key)]
+	if !ok {
+		return nil
+	}
+	return SplitLines(key, value)
+}
+
+// SplitLines splits the value of the field key into the values of its field
+// lines, see Values. Encoders use it to write each value on its own line.
+// Only Set-Cookie values are split; the value of any other field is a single
+// line, so a newline in it is rejected by ValidValue instead.
+func SplitLines(key, value string) []string {
+	if !strings.EqualFold(strings.TrimSpace(key), "set-cookie") {
+		return []string{value}
+	}
+	return strings.Split(value, "\n")
+}
+
+// ValidValue reports whether value may be sent as the value of a field line.
+// CR, LF and NUL are never allowed (RFC 9110 section 5.5), since a CR or LF
+// would end the line early and let the value inject field lines of its own.
+func ValidValue(value string) bool {
+	return !strings.ContainsAny(value, "\r\n\x00")
+}
+
+// Join combines the values of repeated fields named key into a single value,
+// as adding them one by one with Add would, without copying the combined
+// value for every field.
+func Join(key string, values []string) string {
+	return strings.Join(values, separator(strings.ToLower(key)))
+}
+
+// separator returns the string joining the values of repeated fields with
+// the lowercase name key.
+func separator(key string) string {
+	switch key {
+	case "cookie":
+		return "; "
+	case "set-cookie":
+		return "\n"
+	}
+	return ", "
+}
+
 func isValidHeaderChar(c rune) bool {
 	if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' {
 		return true
@@ -123,3 +261,56 @@ func isValidHeaderChar(c rune) bool {
 	}
 	return false
 }
+
+// commonKeys holds the lowercased names of frequently used fields, so that
+// parsing them reuses a single string instead of allocating a new one.
+var commonKeys = map[string]string{}
+
+func init() {
+	for _, k := range []string{
+		"accept", "accept-charset", "accept-encoding", "accept-language", "accept-ranges",
+		"age", "allow", "authorization", "cache-control", "connection",
+		"content-encoding", "content-language", "content-length", "content-location",
+		"content-range", "content-type", "cookie", "date", "etag", "expect", "expires",
+		"forwarded", "from", "host", "if-match", "if-modified-since", "if-none-match",
+		"if-range", "if-unmodified-since", "keep-alive", "last-modified", "link",
+		"location", "origin", "pragma", "range", "referer", "retry-after", "server",
+		"set-cookie", "te", "trailer", "transfer-encoding", "upgrade", "user-agent",
+		"vary", "via", "www-authenticate", "x-forwarded-for", "x-forwarded-host",
+		"x-forwarded-proto", "x-request-id",
+	} {
+		commonKeys[k] = k
+	}
+}
+
+// internKey returns the lowercased form of a field name, without allocating
+// for names in commonKeys.
+func internKey(name []byte) string {
+	var buf [32]byte
+	if len(name) > len(buf) {
+		return string(bytes.ToLower(name))
+	}
+
+	lower := buf[:len(name)]
+	for i, c := range name {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	if k, ok := commonKeys[string(lower)]; ok {
+		return k
+	}
+	return string(lower)
+}
+
+// isValidValueChar reports whether c may appear in a field value: visible
+// characters, obs-text, space and horizontal tab.
+func isValidValueChar(c byte) bool {
+	return c == '\t' || (c >= ' ' && c != 0x7f)
+}
+
+// isWhitespace reports whether c is a space or horizontal tab.
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
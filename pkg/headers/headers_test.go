@@ -50,3 +50,93 @@ func TestHeaderParser(t *testing.T) {
 	assert.Equal(t, "python, go, typescript", headers.Get("Set-Language"))
 	assert.Equal(t, 26, n3)
 }
+
+func TestSetCookieLines(t *testing.T) {
+	// Test: Set-Cookie lines are kept apart, since cookie dates contain commas
+	headers := NewHeaders()
+	data := []byte("Set-Cookie: a=1; Expires=Sun, 06 Nov 1994 08:49:37 GMT\r\nSet-Cookie: b=2\r\n\r\n")
+	n, _, err := headers.Parse(data)
+	require.NoError(t, err)
+	_, _, err = headers.Parse(data[n:])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a=1; Expires=Sun, 06 Nov 1994 08:49:37 GMT", "b=2"}, headers.Values("set-cookie"))
+
+	// Test: Add keeps them apart too, and other fields form a list
+	headers = NewHeaders()
+	require.NoError(t, headers.Add("Set-Cookie", "a=1"))
+	require.NoError(t, headers.Add("set-cookie", "b=2"))
+	require.NoError(t, headers.Add("Vary", "Origin"))
+	require.NoError(t, headers.Add("Vary", "Accept"))
+	assert.Equal(t, []string{"a=1", "b=2"}, headers.Values("Set-Cookie"))
+	assert.Equal(t, []string{"Origin, Accept"}, headers.Values("vary"))
+	assert.Nil(t, headers.Values("cookie"))
+
+	// Test: Cookie values are joined into a single cookie list
+	require.NoError(t, headers.Add("Cookie", "a=1"))
+	require.NoError(t, headers.Add("cookie", "b=2"))
+	assert.Equal(t, "a=1; b=2", headers.Get("Cookie"))
+	assert.Equal(t, "a=1; b=2", Join("Cookie", []string{"a=1", "b=2"}))
+}
+
+func TestFieldLineValues(t *testing.T) {
+	// Test: Only Set-Cookie values are split into field lines
+	assert.Equal(t, []string{"a=1", "b=2"}, SplitLines("Set-Cookie", "a=1\nb=2"))
+	assert.Equal(t, []string{"a\nb"}, SplitLines("x-custom", "a\nb"))
+
+	// Test: Add rejects values that would break the field line
+	h := NewHeaders()
+	for _, value := range []string{"a\r\nX-Injected: 1", "a\nb", "a\rb", "a\x00b"} {
+		assert.Error(t, h.Add("X-Custom", value), "%q", value)
+	}
+	assert.Empty(t, h)
+	assert.False(t, ValidValue("a\rb"))
+	assert.True(t, ValidValue("a\tb"))
+}
+
+func TestLowerKeys(t *testing.T) {
+	// Test: Keys are lowercased in a copy, leaving the map alone
+	h := Headers{"Content-Type": "text/plain", "etag": `"v1"`}
+	lowered := h.LowerKeys()
+	assert.Equal(t, Headers{"content-type": "text/plain", "etag": `"v1"`}, lowered)
+	assert.Contains(t, h, "Content-Type")
+}
+
+func TestHeaderParserFolding(t *testing.T) {
+	// Test: Obsolete line folding is rejected in strict mode
+	headers := NewHeaders()
+	data := []byte("X-Folded: first\r\n  second\r\n\r\n")
+	n, _, err := headers.Parse(data)
+	require.NoError(t, err)
+	_, _, err = headers.Parse(data[n:])
+	require.Error(t, err)
+
+	// Test: Obsolete line folding is unfolded in lenient mode
+	headers = NewHeaders()
+	n, done, err := headers.ParseWithMode(data, Lenient)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, 27, n)
+	assert.Equal(t, "first second", headers.Get("X-Folded"))
+
+	// Test: Lenient mode waits for the next line before finishing a field
+	headers = NewHeaders()
+	n, _, err = headers.ParseWithMode([]byte("X-Folded: first\r\n"), Lenient)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// Test: Whitespace before the first field is rejected in both modes
+	headers = NewHeaders()
+	_, _, err = headers.ParseWithMode([]byte(" Host: localhost\r\n\r\n"), Lenient)
+	require.Error(t, err)
+
+	// Test: Control characters in values are rejected
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("Host: local\x00host\r\n\r\n"))
+	require.Error(t, err)
+
+	// Test: Horizontal tabs and obs-text in values are allowed
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Text: a\tb\xe9\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "a\tb\xe9", headers.Get("X-Text"))
+}
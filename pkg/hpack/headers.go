@@ -0,0 +1,59 @@
+package hpack
+
+import (
+	"github.com/sp41414/goHttp/pkg/headers"
+	"slices"
+	"strings"
+)
+
+// FieldsFromHeaders converts h into header fields with lowercase names, as
+// HTTP/2 requires, with a field for each Set-Cookie value. Keys starting with
+// ':' are pseudo-header fields and are placed first. Fields are sorted by
+// name so the result is deterministic.
+//
+// Fields named in sensitive, such as "authorization" or "cookie", are marked
+// Sensitive so that they are never indexed.
+func FieldsFromHeaders(h headers.Headers, sensitive ...string) []HeaderField {
+	fields := make([]HeaderField, 0, len(h))
+	for k, v := range h {
+		name := strings.ToLower(strings.TrimSpace(k))
+		for _, line := range headers.SplitLines(name, v) {
+			fields = append(fields, HeaderField{
+				Name:      name,
+				Value:     strings.TrimSpace(line),
+				Sensitive: slices.Contains(sensitive, name),
+			})
+		}
+	}
+
+	slices.SortFunc(fields, func(a, b HeaderField) int {
+		aPseudo, bPseudo := strings.HasPrefix(a.Name, ":"), strings.HasPrefix(b.Name, ":")
+		switch {
+		case aPseudo && !bPseudo:
+			return -1
+		case !aPseudo && bPseudo:
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return fields
+}
+
+// HeadersFromFields converts decoded header fields into Headers. Repeated
+// fields are combined like headers.Add does: "cookie" values are joined with
+// "; " as required by RFC 9113 section 8.2.3, "set-cookie" values are kept
+// on separate lines, see headers.Values, and others form a comma-separated
+// list.
+// Pseudo-header fields are kept under their names, e.g. ":status".
+func HeadersFromFields(fields []HeaderField) headers.Headers {
+	h := headers.NewHeaders()
+	for _, f := range fields {
+		name := strings.ToLower(f.Name)
+		if prev, ok := h[name]; ok {
+			h[name] = headers.Join(name, []string{prev, f.Value})
+		} else {
+			h[name] = f.Value
+		}
+	}
+	return h
+}
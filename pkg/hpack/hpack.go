@@ -0,0 +1,508 @@
+// Package hpack implements HPACK, the header compression format for HTTP/2
+// defined in RFC 7541: the static and dynamic tables, Huffman coding,
+// dynamic table size updates and never-indexed literals.
+//
+// Header blocks are represented as ordered lists of HeaderField, which can be
+// converted to and from headers.Headers.
+package hpack
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HeaderField is a single name-value pair in an HPACK header block.
+type HeaderField struct {
+	Name  string
+	Value string
+	// Sensitive fields are encoded as never-indexed literals so that no
+	// intermediary adds them to a compression table.
+	Sensitive bool
+}
+
+// size returns the size of the field as counted against a dynamic table,
+// defined in RFC 7541 section 4.1.
+func (f HeaderField) size() uint32 {
+	return uint32(len(f.Name) + len(f.Value) + 32)
+}
+
+// staticTable is the predefined HPACK table from RFC 7541 Appendix A.
+// Index 1 of the specification is element 0 here.
+var staticTable = []HeaderField{
+	{Name: ":authority"},
+	{Name: ":method", Value: "GET"},
+	{Name: ":method", Value: "POST"},
+	{Name: ":path", Value: "/"},
+	{Name: ":path", Value: "/index.html"},
+	{Name: ":scheme", Value: "http"},
+	{Name: ":scheme", Value: "https"},
+	{Name: ":status", Value: "200"},
+	{Name: ":status", Value: "204"},
+	{Name: ":status", Value: "206"},
+	{Name: ":status", Value: "304"},
+	{Name: ":status", Value: "400"},
+	{Name: ":status", Value: "404"},
+	{Name: ":status", Value: "500"},
+	{Name: "accept-charset"},
+	{Name: "accept-encoding", Value: "gzip, deflate"},
+	{Name: "accept-language"},
+	{Name: "accept-ranges"},
+	{Name: "accept"},
+	{Name: "access-control-allow-origin"},
+	{Name: "age"},
+	{Name: "allow"},
+	{Name: "authorization"},
+	{Name: "cache-control"},
+	{Name: "content-disposition"},
+	{Name: "content-encoding"},
+	{Name: "content-language"},
+	{Name: "content-length"},
+	{Name: "content-location"},
+	{Name: "content-range"},
+	{Name: "content-type"},
+	{Name: "cookie"},
+	{Name: "date"},
+	{Name: "etag"},
+	{Name: "expect"},
+	{Name: "expires"},
+	{Name: "from"},
+	{Name: "host"},
+	{Name: "if-match"},
+	{Name: "if-modified-since"},
+	{Name: "if-none-match"},
+	{Name: "if-range"},
+	{Name: "if-unmodified-since"},
+	{Name: "last-modified"},
+	{Name: "link"},
+	{Name: "location"},
+	{Name: "max-forwards"},
+	{Name: "proxy-authenticate"},
+	{Name: "proxy-authorization"},
+	{Name: "range"},
+	{Name: "referer"},
+	{Name: "refresh"},
+	{Name: "retry-after"},
+	{Name: "server"},
+	{Name: "set-cookie"},
+	{Name: "strict-transport-security"},
+	{Name: "transfer-encoding"},
+	{Name: "user-agent"},
+	{Name: "vary"},
+	{Name: "via"},
+	{Name: "www-authenticate"},
+}
+
+// dynamicTable is the FIFO table of recently coded fields shared by an
+// encoder and its peer's decoder. The newest entry is at the end of entries
+// and has the lowest index.
+type dynamicTable struct {
+	entries []HeaderField
+	size    uint32
+	maxSize uint32
+}
+
+// add inserts f as the newest entry, evicting old entries to make room.
+// A field larger than the whole table empties it without being added.
+func (t *dynamicTable) add(f HeaderField) {
+	t.evict(t.maxSize - min(f.size(), t.maxSize))
+	if f.size() > t.maxSize {
+		return
+	}
+	t.entries = append(t.entries, f)
+	t.size += f.size()
+}
+
+// setMaxSize changes the maximum size of the table, evicting entries that no
+// longer fit.
+func (t *dynamicTable) setMaxSize(n uint32) {
+	t.maxSize = n
+	t.evict(n)
+}
+
+// evict removes the oldest entries until the table size is at most n.
+func (t *dynamicTable) evict(n uint32) {
+	drop := 0
+	for t.size > n && drop < len(t.entries) {
+		t.size -= t.entries[drop].size()
+		drop++
+	}
+	t.entries = append(t.entries[:0], t.entries[drop:]...)
+}
+
+// field returns the field at a combined static and dynamic table index.
+func (t *dynamicTable) field(i uint64) (HeaderField, bool) {
+	switch {
+	case i == 0:
+		return HeaderField{}, false
+	case i <= uint64(len(staticTable)):
+		return staticTable[i-1], true
+	}
+	i -= uint64(len(staticTable))
+	if i > uint64(len(t.entries)) {
+		return HeaderField{}, false
+	}
+	return t.entries[len(t.entries)-int(i)], true
+}
+
+// search returns the index of a field matching both name and value, or
+// failing that the index of a field with the same name. It returns 0 if no
+// field has the name.
+func (t *dynamicTable) search(f HeaderField) (uint64, bool) {
+	nameIndex := uint64(0)
+	for i, sf := range staticTable {
+		if sf.Name != f.Name {
+			continue
+		}
+		if sf.Value == f.Value {
+			return uint64(i + 1), true
+		}
+		if nameIndex == 0 {
+			nameIndex = uint64(i + 1)
+		}
+	}
+	for i := len(t.entries) - 1; i >= 0; i-- {
+		df := t.entries[i]
+		if df.Name != f.Name {
+			continue
+		}
+		index := uint64(len(staticTable) + len(t.entries) - i)
+		if df.Value == f.Value {
+			return index, true
+		}
+		if nameIndex == 0 {
+			nameIndex = index
+		}
+	}
+	return nameIndex, false
+}
+
+// DefaultTableSize is the initial dynamic table size of an HTTP/2
+// connection, the default SETTINGS_HEADER_TABLE_SIZE.
+const DefaultTableSize = 4096
+
+// maxStringLength bounds the length of a single decoded name or value.
+const maxStringLength = 64 << 10
+
+// ErrHeaderListTooLarge is returned by Decode for a header block whose
+// decoded fields exceed the limit set with SetMaxHeaderListSize.
+var ErrHeaderListTooLarge = errors.New("hpack: header list too large")
+
+// Decoder decodes header blocks. A connection uses one Decoder for all
+// blocks it receives, since they share the dynamic table.
+type Decoder struct {
+	table dynamicTable
+	// maxAllowed is the table size limit advertised to the peer, which
+	// bounds the sizes it may select with a dynamic table size update.
+	maxAllowed uint32
+	// maxListSize bounds the size of a decoded header list, or 0.
+	maxListSize uint64
+}
+
+// NewDecoder creates a Decoder whose dynamic table may grow to maxTableSize.
+func NewDecoder(maxTableSize uint32) *Decoder {
+	return &Decoder{
+		table:      dynamicTable{maxSize: maxTableSize},
+		maxAllowed: maxTableSize,
+	}
+}
+
+// SetAllowedMaxTableSize changes the largest dynamic table size the encoder
+// may select, e.g. after sending a new SETTINGS_HEADER_TABLE_SIZE.
+func (d *Decoder) SetAllowedMaxTableSize(n uint32) {
+	d.maxAllowed = n
+}
+
+// SetMaxHeaderListSize limits the size of the header list Decode returns,
+// counted like SETTINGS_MAX_HEADER_LIST_SIZE: the length of every name and
+// value plus 32 bytes per field. Zero, the default, means no limit.
+//
+// A small block can reference the same table entry over and over, so
+// without a limit it can decode to a list thousands of times its size.
+func (d *Decoder) SetMaxHeaderListSize(n uint32) {
+	d.maxListSize = uint64(n)
+}
+
+// TableSize returns the current size of the dynamic table.
+func (d *Decoder) TableSize() uint32 {
+	return d.table.size
+}
+
+// Decode decodes a complete header block. A block exceeding the header list
+// size limit fails with ErrHeaderListTooLarge once it has been processed
+// entirely, so the dynamic table stays in sync with the encoder.
+func (d *Decoder) Decode(block []byte) ([]HeaderField, error) {
+	var fields []HeaderField
+	var listSize uint64
+	tooLarge := false
+	emit := func(f HeaderField) {
+		listSize += uint64(f.size())
+		if d.maxListSize > 0 && listSize > d.maxListSize {
+			tooLarge, fields = true, nil
+		}
+		if !tooLarge {
+			fields = append(fields, f)
+		}
+	}
+
+	sizeUpdateAllowed := true
+	for len(block) > 0 {
+		b := block[0]
+		switch {
+		case b&0x80 != 0:
+			// indexed header field
+			i, rest, err := readInt(block, 7)
+			if err != nil {
+				return nil, err
+			}
+			f, ok := d.table.field(i)
+			if !ok {
+				return nil, fmt.Errorf("hpack: invalid index %d", i)
+			}
+			emit(f)
+			block = rest
+		case b&0xc0 == 0x40:
+			// literal with incremental indexing
+			f, rest, err := d.readLiteral(block, 6)
+			if err != nil {
+				return nil, err
+			}
+			d.table.add(f)
+			emit(f)
+			block = rest
+		case b&0xe0 == 0x20:
+			// dynamic table size update
+			if !sizeUpdateAllowed {
+				return nil, fmt.Errorf("hpack: dynamic table size update after a header field")
+			}
+			n, rest, err := readInt(block, 5)
+			if err != nil {
+				return nil, err
+			}
+			if n > uint64(d.maxAllowed) {
+				return nil, fmt.Errorf("hpack: dynamic table size %d exceeds limit %d", n, d.maxAllowed)
+			}
+			d.table.setMaxSize(uint32(n))
+			block = rest
+			continue
+		default:
+			// literal without indexing (0000) or never indexed (0001)
+			f, rest, err := d.readLiteral(block, 4)
+			if err != nil {
+				return nil, err
+			}
+			f.Sensitive = b&0x10 != 0
+			emit(f)
+			block = rest
+		}
+		sizeUpdateAllowed = false
+	}
+	if tooLarge {
+		return nil, ErrHeaderListTooLarge
+	}
+	return fields, nil
+}
+
+// readLiteral reads a literal header field whose name index uses an n-bit
+// prefix.
+func (d *Decoder) readLiteral(block []byte, n uint8) (HeaderField, []byte, error) {
+	i, rest, err := readInt(block, n)
+	if err != nil {
+		return HeaderField{}, nil, err
+	}
+
+	var f HeaderField
+	if i == 0 {
+		f.Name, rest, err = readString(rest)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+	} else {
+		indexed, ok := d.table.field(i)
+		if !ok {
+			return HeaderField{}, nil, fmt.Errorf("hpack: invalid index %d", i)
+		}
+		f.Name = indexed.Name
+	}
+
+	f.Value, rest, err = readString(rest)
+	if err != nil {
+		return HeaderField{}, nil, err
+	}
+	return f, rest, nil
+}
+
+// Encoder encodes header blocks. A connection uses one Encoder for all
+// blocks it sends, since they share the dynamic table.
+//
+// Fields found in a table are sent as an index; other fields are added to
+// the dynamic table with incremental indexing, except Sensitive fields,
+// which are sent as never-indexed literals.
+type Encoder struct {
+	// DisableHuffman sends every string literal as raw octets. By default a
+	// literal is Huffman coded unless that would make it longer.
+	DisableHuffman bool
+
+	table dynamicTable
+	// maxAllowed is the table size limit set by the peer's decoder.
+	maxAllowed uint32
+	// sizeChanged reports whether the table size changed since the last
+	// header block. minSize is the smallest size it had in between, which
+	// must be announced before the current one (RFC 7541 section 4.2).
+	sizeChanged bool
+	minSize     uint32
+}
+
+// NewEncoder creates an Encoder whose dynamic table may grow to maxTableSize.
+func NewEncoder(maxTableSize uint32) *Encoder {
+	return &Encoder{
+		table:      dynamicTable{maxSize: maxTableSize},
+		maxAllowed: maxTableSize,
+	}
+}
+
+// SetMaxTableSize changes the size of the dynamic table, capped at the limit
+// set with SetMaxTableSizeLimit. The change is announced to the decoder with
+// a dynamic table size update at the start of the next header block.
+func (e *Encoder) SetMaxTableSize(n uint32) {
+	n = min(n, e.maxAllowed)
+	if n == e.table.maxSize {
+		return
+	}
+	if !e.sizeChanged || n < e.minSize {
+		e.minSize = min(n, e.table.maxSize)
+	}
+	e.sizeChanged = true
+	e.table.setMaxSize(n)
+}
+
+// SetMaxTableSizeLimit applies the table size limit advertised by the
+// decoder, such as the peer's SETTINGS_HEADER_TABLE_SIZE. The table shrinks
+// if it is larger than the new limit.
+func (e *Encoder) SetMaxTableSizeLimit(n uint32) {
+	e.maxAllowed = n
+	if e.table.maxSize > n {
+		e.SetMaxTableSize(n)
+	}
+}
+
+// TableSize returns the current size of the dynamic table.
+func (e *Encoder) TableSize() uint32 {
+	return e.table.size
+}
+
+// Encode appends the encoding of fields as one header block to dst.
+func (e *Encoder) Encode(dst []byte, fields []HeaderField) []byte {
+	if e.sizeChanged {
+		if e.minSize < e.table.maxSize {
+			dst = appendInt(dst, 0x20, 5, uint64(e.minSize))
+		}
+		dst = appendInt(dst, 0x20, 5, uint64(e.table.maxSize))
+		e.sizeChanged = false
+	}
+
+	for _, f := range fields {
+		i, exact := e.table.search(f)
+		switch {
+		case exact && !f.Sensitive:
+			dst = appendInt(dst, 0x80, 7, i)
+		case f.Sensitive:
+			dst = appendInt(dst, 0x10, 4, i)
+			if i == 0 {
+				dst = e.appendString(dst, f.Name)
+			}
+			dst = e.appendString(dst, f.Value)
+		default:
+			dst = appendInt(dst, 0x40, 6, i)
+			if i == 0 {
+				dst = e.appendString(dst, f.Name)
+			}
+			dst = e.appendString(dst, f.Value)
+			e.table.add(f)
+		}
+	}
+	return dst
+}
+
+// appendString appends s as a string literal, Huffman coded if enabled and
+// not longer than the raw octets.
+func (e *Encoder) appendString(dst []byte, s string) []byte {
+	if n := HuffmanEncodedLen(s); !e.DisableHuffman && n <= len(s) {
+		dst = appendInt(dst, 0x80, 7, uint64(n))
+		return HuffmanEncode(dst, s)
+	}
+	dst = appendInt(dst, 0, 7, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// readInt decodes an integer with an n-bit prefix, as described in RFC 7541
+// section 5.1.
+func readInt(block []byte, n uint8) (uint64, []byte, error) {
+	if len(block) == 0 {
+		return 0, nil, fmt.Errorf("hpack: truncated integer")
+	}
+	mask := uint64(1)<<n - 1
+	i := uint64(block[0]) & mask
+	block = block[1:]
+	if i < mask {
+		return i, block, nil
+	}
+
+	var shift uint
+	for len(block) > 0 {
+		b := block[0]
+		block = block[1:]
+		i += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return i, block, nil
+		}
+		shift += 7
+		if shift > 56 {
+			return 0, nil, fmt.Errorf("hpack: integer overflow")
+		}
+	}
+	return 0, nil, fmt.Errorf("hpack: truncated integer")
+}
+
+// appendInt appends i encoded with an n-bit prefix. flags holds the bits of
+// the first byte above the prefix.
+func appendInt(dst []byte, flags byte, n uint8, i uint64) []byte {
+	mask := uint64(1)<<n - 1
+	if i < mask {
+		return append(dst, flags|byte(i))
+	}
+	dst = append(dst, flags|byte(mask))
+	i -= mask
+	for i >= 0x80 {
+		dst = append(dst, byte(i&0x7f)|0x80)
+		i >>= 7
+	}
+	return append(dst, byte(i))
+}
+
+// readString decodes a string literal, which may be Huffman coded.
+func readString(block []byte) (string, []byte, error) {
+	if len(block) == 0 {
+		return "", nil, fmt.Errorf("hpack: truncated string")
+	}
+	huffman := block[0]&0x80 != 0
+	n, rest, err := readInt(block, 7)
+	if err != nil {
+		return "", nil, err
+	}
+	if n > uint64(len(rest)) {
+		return "", nil, fmt.Errorf("hpack: truncated string")
+	}
+	if n > maxStringLength {
+		return "", nil, fmt.Errorf("hpack: string length %d exceeds limit", n)
+	}
+
+	data := rest[:n]
+	if !huffman {
+		return string(data), rest[n:], nil
+	}
+	s, err := HuffmanDecode(data)
+	if err != nil {
+		return "", nil, err
+	}
+	return s, rest[n:], nil
+}
@@ -0,0 +1,324 @@
+package hpack
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeHex decodes a hex dump as printed in RFC 7541, ignoring whitespace.
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	require.NoError(t, err)
+	return b
+}
+
+func TestIntegers(t *testing.T) {
+	// Test: Examples from RFC 7541 Appendix C.1
+	tests := []struct {
+		value  uint64
+		prefix uint8
+		want   string
+	}{
+		{10, 5, "0a"},
+		{1337, 5, "1f9a0a"},
+		{42, 8, "2a"},
+	}
+	for _, tt := range tests {
+		encoded := appendInt(nil, 0, tt.prefix, tt.value)
+		assert.Equal(t, tt.want, hex.EncodeToString(encoded))
+
+		i, rest, err := readInt(encoded, tt.prefix)
+		require.NoError(t, err)
+		assert.Equal(t, tt.value, i)
+		assert.Empty(t, rest)
+	}
+
+	// Test: Truncated and overflowing integers
+	_, _, err := readInt([]byte{0x1f, 0x9a}, 5)
+	require.Error(t, err)
+	_, _, err = readInt([]byte{0x1f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, 5)
+	require.Error(t, err)
+}
+
+func TestLiteralFields(t *testing.T) {
+	// Test: Examples from RFC 7541 Appendix C.2
+	tests := []struct {
+		name      string
+		block     string
+		want      HeaderField
+		tableSize uint32
+	}{
+		{"with indexing", "400a 6375 7374 6f6d 2d6b 6579 0d63 7573 746f 6d2d 6865 6164 6572",
+			HeaderField{Name: "custom-key", Value: "custom-header"}, 55},
+		{"without indexing", "040c 2f73 616d 706c 652f 7061 7468",
+			HeaderField{Name: ":path", Value: "/sample/path"}, 0},
+		{"never indexed", "1008 7061 7373 776f 7264 0673 6563 7265 74",
+			HeaderField{Name: "password", Value: "secret", Sensitive: true}, 0},
+		{"indexed", "82",
+			HeaderField{Name: ":method", Value: "GET"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := NewDecoder(DefaultTableSize)
+			fields, err := dec.Decode(decodeHex(t, tt.block))
+			require.NoError(t, err)
+			assert.Equal(t, []HeaderField{tt.want}, fields)
+			assert.Equal(t, tt.tableSize, dec.TableSize())
+		})
+	}
+}
+
+// vectorStep is one header block of an RFC 7541 example sequence, decoded
+// and encoded with the same table.
+type vectorStep struct {
+	block     string
+	fields    []HeaderField
+	tableSize uint32
+}
+
+// testVectors decodes and encodes a sequence of header blocks, comparing the
+// fields, the encoding and the dynamic table size after each block.
+func testVectors(t *testing.T, tableSize uint32, huffman bool, steps []vectorStep) {
+	t.Helper()
+	dec := NewDecoder(tableSize)
+	enc := NewEncoder(tableSize)
+	enc.DisableHuffman = !huffman
+	for i, step := range steps {
+		block := decodeHex(t, step.block)
+		fields, err := dec.Decode(block)
+		require.NoError(t, err, "block %d", i)
+		assert.Equal(t, step.fields, fields, "block %d", i)
+		assert.Equal(t, step.tableSize, dec.TableSize(), "block %d", i)
+
+		assert.Equal(t, hex.EncodeToString(block), hex.EncodeToString(enc.Encode(nil, step.fields)), "block %d", i)
+		assert.Equal(t, step.tableSize, enc.TableSize(), "block %d", i)
+	}
+}
+
+var requestFields = [][]HeaderField{
+	{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":path", Value: "/"},
+		{Name: ":authority", Value: "www.example.com"},
+	},
+	{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":path", Value: "/"},
+		{Name: ":authority", Value: "www.example.com"},
+		{Name: "cache-control", Value: "no-cache"},
+	},
+	{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":path", Value: "/index.html"},
+		{Name: ":authority", Value: "www.example.com"},
+		{Name: "custom-key", Value: "custom-value"},
+	},
+}
+
+var responseFields = [][]HeaderField{
+	{
+		{Name: ":status", Value: "302"},
+		{Name: "cache-control", Value: "private"},
+		{Name: "date", Value: "Mon, 21 Oct 2013 20:13:21 GMT"},
+		{Name: "location", Value: "https://www.example.com"},
+	},
+	{
+		{Name: ":status", Value: "307"},
+		{Name: "cache-control", Value: "private"},
+		{Name: "date", Value: "Mon, 21 Oct 2013 20:13:21 GMT"},
+		{Name: "location", Value: "https://www.example.com"},
+	},
+	{
+		{Name: ":status", Value: "200"},
+		{Name: "cache-control", Value: "private"},
+		{Name: "date", Value: "Mon, 21 Oct 2013 20:13:22 GMT"},
+		{Name: "location", Value: "https://www.example.com"},
+		{Name: "content-encoding", Value: "gzip"},
+		{Name: "set-cookie", Value: "foo=ASDJKHQKBZXOQWEOPIUAXQWEOIU; max-age=3600; version=1"},
+	},
+}
+
+func TestRequestVectors(t *testing.T) {
+	// Test: Requests without Huffman coding, RFC 7541 Appendix C.3
+	testVectors(t, DefaultTableSize, false, []vectorStep{
+		{"8286 8441 0f77 7777 2e65 7861 6d70 6c65 2e63 6f6d", requestFields[0], 57},
+		{"8286 84be 5808 6e6f 2d63 6163 6865", requestFields[1], 110},
+		{"8287 85bf 400a 6375 7374 6f6d 2d6b 6579 0c63 7573 746f 6d2d 7661 6c75 65", requestFields[2], 164},
+	})
+
+	// Test: Requests with Huffman coding, RFC 7541 Appendix C.4
+	testVectors(t, DefaultTableSize, true, []vectorStep{
+		{"8286 8441 8cf1 e3c2 e5f2 3a6b a0ab 90f4 ff", requestFields[0], 57},
+		{"8286 84be 5886 a8eb 1064 9cbf", requestFields[1], 110},
+		{"8287 85bf 4088 25a8 49e9 5ba9 7d7f 8925 a849 e95b b8e8 b4bf", requestFields[2], 164},
+	})
+}
+
+func TestResponseVectors(t *testing.T) {
+	// Test: Responses without Huffman coding and evictions, RFC 7541 Appendix C.5
+	testVectors(t, 256, false, []vectorStep{
+		{"4803 3330 3258 0770 7269 7661 7465 611d 4d6f 6e2c 2032 3120 4f63 7420 3230 3133 2032 303a 3133 3a32 3120 474d " +
+			"546e 1768 7474 7073 3a2f 2f77 7777 2e65 7861 6d70 6c65 2e63 6f6d", responseFields[0], 222},
+		{"4803 3330 37c1 c0bf", responseFields[1], 222},
+		{"88c1 611d 4d6f 6e2c 2032 3120 4f63 7420 3230 3133 2032 303a 3133 3a32 3220 474d 54c0 5a04 677a 6970 7738 666f " +
+			"6f3d 4153 444a 4b48 514b 425a 584f 5157 454f 5049 5541 5851 5745 4f49 553b 206d 6178 2d61 6765 3d33 3630 303b " +
+			"2076 6572 7369 6f6e 3d31", responseFields[2], 215},
+	})
+
+	// Test: Responses with Huffman coding and evictions, RFC 7541 Appendix C.6
+	testVectors(t, 256, true, []vectorStep{
+		{"4882 6402 5885 aec3 771a 4b61 96d0 7abe 9410 54d4 44a8 2005 9504 0b81 66e0 82a6 2d1b ff6e 919d 29ad 1718 63c7 " +
+			"8f0b 97c8 e9ae 82ae 43d3", responseFields[0], 222},
+		{"4883 640e ffc1 c0bf", responseFields[1], 222},
+		{"88c1 6196 d07a be94 1054 d444 a820 0595 040b 8166 e084 a62d 1bff c05a 839b d9ab 77ad 94e7 821d d7f2 e6c7 b335 " +
+			"dfdf cd5b 3960 d5af 2708 7f36 72c1 ab27 0fb5 291f 9587 3160 65c0 03ed 4ee5 b106 3d50 07", responseFields[2], 215},
+	})
+}
+
+func TestHuffman(t *testing.T) {
+	// Test: Encoding from RFC 7541 Appendix C.4.1
+	encoded := HuffmanEncode(nil, "www.example.com")
+	assert.Equal(t, "f1e3c2e5f23a6ba0ab90f4ff", hex.EncodeToString(encoded))
+	assert.Equal(t, len(encoded), HuffmanEncodedLen("www.example.com"))
+
+	s, err := HuffmanDecode(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, "www.example.com", s)
+
+	// Test: Padding longer than 7 bits is rejected
+	_, err = HuffmanDecode([]byte{0xff, 0xff})
+	require.ErrorIs(t, err, ErrInvalidHuffman)
+
+	// Test: Padding that is not all ones is rejected
+	_, err = HuffmanDecode([]byte{0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xfe})
+	require.ErrorIs(t, err, ErrInvalidHuffman)
+}
+
+func TestTableSizeUpdates(t *testing.T) {
+	enc := NewEncoder(DefaultTableSize)
+	dec := NewDecoder(DefaultTableSize)
+	field := []HeaderField{{Name: "x-custom", Value: "first"}}
+
+	_, err := dec.Decode(enc.Encode(nil, field))
+	require.NoError(t, err)
+
+	// Test: A repeated field is sent as a single index
+	assert.Len(t, enc.Encode(nil, field), 1)
+
+	// Test: Table size updates are announced at the start of the next block
+	enc.SetMaxTableSize(0)
+	block := enc.Encode(nil, field)
+	assert.Equal(t, byte(0x20), block[0])
+	decoded, err := dec.Decode(block)
+	require.NoError(t, err)
+	assert.Equal(t, field, decoded)
+	assert.Zero(t, dec.TableSize())
+
+	// Test: A shrink followed by a growth announces both sizes
+	enc.SetMaxTableSize(1024)
+	enc.Encode(nil, nil)
+	enc.SetMaxTableSize(0)
+	enc.SetMaxTableSize(2048)
+	assert.Equal(t, "203fe10f", hex.EncodeToString(enc.Encode(nil, nil)))
+
+	// Test: The limit set by the peer caps the table size
+	enc.SetMaxTableSizeLimit(100)
+	assert.Equal(t, "3f45", hex.EncodeToString(enc.Encode(nil, nil)))
+
+	// Test: Size updates above the advertised limit are rejected
+	dec.SetAllowedMaxTableSize(100)
+	_, err = dec.Decode([]byte{0x3f, 0xe1, 0x0f})
+	require.Error(t, err)
+
+	// Test: Size updates after a field are rejected
+	_, err = dec.Decode([]byte{0x82, 0x20})
+	require.Error(t, err)
+
+	// Test: Invalid index
+	_, err = dec.Decode([]byte{0x80})
+	require.Error(t, err)
+	_, err = dec.Decode([]byte{0xff, 0x00})
+	require.Error(t, err)
+}
+
+func TestMaxHeaderListSize(t *testing.T) {
+	enc := NewEncoder(DefaultTableSize)
+	dec := NewDecoder(DefaultTableSize)
+	dec.SetMaxHeaderListSize(1000)
+	big := HeaderField{Name: "x-big", Value: strings.Repeat("a", 900)}
+
+	// Test: A list within the limit is decoded
+	fields, err := dec.Decode(enc.Encode(nil, []HeaderField{big}))
+	require.NoError(t, err)
+	assert.Equal(t, []HeaderField{big}, fields)
+
+	// Test: Repeated references to a table entry count every time
+	fresh := HeaderField{Name: "x-new", Value: "1"}
+	block := enc.Encode(nil, []HeaderField{big, big, big, fresh})
+	assert.Less(t, len(block), 20)
+	_, err = dec.Decode(block)
+	require.ErrorIs(t, err, ErrHeaderListTooLarge)
+
+	// Test: The rejected block still updated the dynamic table
+	block = enc.Encode(nil, []HeaderField{fresh})
+	assert.Len(t, block, 1)
+	fields, err = dec.Decode(block)
+	require.NoError(t, err)
+	assert.Equal(t, []HeaderField{fresh}, fields)
+}
+
+func TestHeadersConversion(t *testing.T) {
+	h := headers.Headers{
+		"content-type": "text/plain",
+		":status":      "200",
+		"Cookie":       "a=1",
+		"x-trace":      "abc",
+	}
+
+	// Test: Names are lowercased, pseudo-headers come first and sensitive
+	// fields are marked
+	fields := FieldsFromHeaders(h, "cookie")
+	assert.Equal(t, []HeaderField{
+		{Name: ":status", Value: "200"},
+		{Name: "content-type", Value: "text/plain"},
+		{Name: "cookie", Value: "a=1", Sensitive: true},
+		{Name: "x-trace", Value: "abc"},
+	}, fields)
+
+	// Test: Repeated fields are combined, cookies with "; "
+	h = HeadersFromFields([]HeaderField{
+		{Name: ":path", Value: "/"},
+		{Name: "cookie", Value: "a=1"},
+		{Name: "cookie", Value: "b=2"},
+		{Name: "Accept", Value: "text/html"},
+		{Name: "accept", Value: "*/*"},
+		{Name: "set-cookie", Value: "c=3"},
+		{Name: "set-cookie", Value: "d=4"},
+	})
+	assert.Equal(t, "/", h.Get(":path"))
+	assert.Equal(t, "a=1; b=2", h.Get("cookie"))
+	assert.Equal(t, "text/html, */*", h.Get("accept"))
+	assert.Equal(t, []string{"c=3", "d=4"}, h.Values("set-cookie"))
+
+	// Test: Each Set-Cookie value becomes a field
+	assert.Equal(t, []HeaderField{
+		{Name: "set-cookie", Value: "c=3"},
+		{Name: "set-cookie", Value: "d=4"},
+	}, FieldsFromHeaders(headers.Headers{"set-cookie": "c=3\nd=4"}))
+
+	// Test: Fields survive an encode and decode round trip
+	enc := NewEncoder(DefaultTableSize)
+	dec := NewDecoder(DefaultTableSize)
+	decoded, err := dec.Decode(enc.Encode(nil, FieldsFromHeaders(h)))
+	require.NoError(t, err)
+	assert.Equal(t, h, HeadersFromFields(decoded))
+}
@@ -0,0 +1,96 @@
+package hpack
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrInvalidHuffman is returned by HuffmanDecode for data that contains the
+// EOS symbol or invalid padding.
+var ErrInvalidHuffman = errors.New("hpack: invalid Huffman-encoded data")
+
+// huffmanNode is a node of the tree used to decode Huffman codes.
+type huffmanNode struct {
+	children [2]*huffmanNode
+	sym      byte
+	leaf     bool
+}
+
+// huffmanRoot is the root of the decoding tree built from huffmanCodes.
+var huffmanRoot = buildHuffmanTree()
+
+func buildHuffmanTree() *huffmanNode {
+	root := &huffmanNode{}
+	for sym, code := range huffmanCodes {
+		n := root
+		for bit := int(huffmanCodeLen[sym]) - 1; bit >= 0; bit-- {
+			b := (code >> bit) & 1
+			if n.children[b] == nil {
+				n.children[b] = &huffmanNode{}
+			}
+			n = n.children[b]
+		}
+		n.sym = byte(sym)
+		n.leaf = true
+	}
+	return root
+}
+
+// HuffmanDecode decodes Huffman coded data. The padding at the end must be
+// shorter than 8 bits and consist of the most significant bits of the EOS
+// symbol, i.e. all ones.
+func HuffmanDecode(data []byte) (string, error) {
+	var buf bytes.Buffer
+	n := huffmanRoot
+	depth, ones := 0, true
+	for _, b := range data {
+		for bit := 7; bit >= 0; bit-- {
+			v := (b >> bit) & 1
+			n = n.children[v]
+			if n == nil {
+				// the EOS symbol is the only code missing from the tree
+				return "", ErrInvalidHuffman
+			}
+			depth++
+			ones = ones && v == 1
+			if n.leaf {
+				buf.WriteByte(n.sym)
+				n = huffmanRoot
+				depth, ones = 0, true
+			}
+		}
+	}
+	if depth > 7 || !ones {
+		return "", ErrInvalidHuffman
+	}
+	return buf.String(), nil
+}
+
+// HuffmanEncodedLen returns the length of s once Huffman coded.
+func HuffmanEncodedLen(s string) int {
+	bits := 0
+	for i := 0; i < len(s); i++ {
+		bits += int(huffmanCodeLen[s[i]])
+	}
+	return (bits + 7) / 8
+}
+
+// HuffmanEncode appends the Huffman coding of s to dst, padded with the most
+// significant bits of the EOS symbol.
+func HuffmanEncode(dst []byte, s string) []byte {
+	var acc uint64
+	bits := uint(0)
+	for i := 0; i < len(s); i++ {
+		acc = acc<<huffmanCodeLen[s[i]] | uint64(huffmanCodes[s[i]])
+		bits += uint(huffmanCodeLen[s[i]])
+		for bits >= 8 {
+			bits -= 8
+			dst = append(dst, byte(acc>>bits))
+		}
+	}
+	if bits > 0 {
+		acc = acc<<(8-bits) | (1<<(8-bits) - 1)
+		dst = append(dst, byte(acc))
+	}
+	return dst
+}
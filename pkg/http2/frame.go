@@ -0,0 +1,191 @@
+package http2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// frameType identifies the type of an HTTP/2 frame, see RFC 9113 section 6.
+type frameType uint8
+
+const (
+	frameData         frameType = 0x0
+	frameHeaders      frameType = 0x1
+	framePriority     frameType = 0x2
+	frameRSTStream    frameType = 0x3
+	frameSettings     frameType = 0x4
+	framePushPromise  frameType = 0x5
+	framePing         frameType = 0x6
+	frameGoAway       frameType = 0x7
+	frameWindowUpdate frameType = 0x8
+	frameContinuation frameType = 0x9
+)
+
+// Frame flags. Their meaning depends on the frame type.
+const (
+	flagEndStream  = 0x1
+	flagAck        = 0x1
+	flagEndHeaders = 0x4
+	flagPadded     = 0x8
+	flagPriority   = 0x20
+)
+
+// ErrCode is an HTTP/2 error code carried by RST_STREAM and GOAWAY frames.
+type ErrCode uint32
+
+const (
+	ErrCodeNo                 ErrCode = 0x0
+	ErrCodeProtocol           ErrCode = 0x1
+	ErrCodeInternal           ErrCode = 0x2
+	ErrCodeFlowControl        ErrCode = 0x3
+	ErrCodeSettingsTimeout    ErrCode = 0x4
+	ErrCodeStreamClosed       ErrCode = 0x5
+	ErrCodeFrameSize          ErrCode = 0x6
+	ErrCodeRefusedStream      ErrCode = 0x7
+	ErrCodeCancel             ErrCode = 0x8
+	ErrCodeCompression        ErrCode = 0x9
+	ErrCodeConnect            ErrCode = 0xa
+	ErrCodeEnhanceYourCalm    ErrCode = 0xb
+	ErrCodeInadequateSecurity ErrCode = 0xc
+	ErrCodeHTTP11Required     ErrCode = 0xd
+)
+
+// Setting identifiers, see RFC 9113 section 6.5.2.
+const (
+	settingHeaderTableSize      = 0x1
+	settingEnablePush           = 0x2
+	settingMaxConcurrentStreams = 0x3
+	settingInitialWindowSize    = 0x4
+	settingMaxFrameSize         = 0x5
+	settingMaxHeaderListSize    = 0x6
+)
+
+const (
+	// frameHeaderLen is the length of the fixed frame header.
+	frameHeaderLen = 9
+	// defaultMaxFrameSize is the initial SETTINGS_MAX_FRAME_SIZE.
+	defaultMaxFrameSize = 16384
+	// maxFrameSizeLimit is the largest allowed SETTINGS_MAX_FRAME_SIZE.
+	maxFrameSizeLimit = 1<<24 - 1
+	// defaultWindowSize is the initial flow control window of a connection
+	// and of every stream.
+	defaultWindowSize = 65535
+	// maxWindowSize is the largest allowed flow control window.
+	maxWindowSize = 1<<31 - 1
+)
+
+// frame is a single HTTP/2 frame with its payload.
+type frame struct {
+	Type     frameType
+	Flags    uint8
+	StreamID uint32
+	Payload  []byte
+}
+
+// has reports whether the frame has flag set.
+func (f *frame) has(flag uint8) bool {
+	return f.Flags&flag != 0
+}
+
+// connError is a connection error that terminates the connection with a
+// GOAWAY frame.
+type connError struct {
+	Code   ErrCode
+	Reason string
+}
+
+func (e connError) Error() string {
+	return fmt.Sprintf("http2: connection error %d: %s", e.Code, e.Reason)
+}
+
+// streamError is a stream error that resets a single stream with a
+// RST_STREAM frame.
+type streamError struct {
+	StreamID uint32
+	Code     ErrCode
+	Reason   string
+}
+
+func (e streamError) Error() string {
+	return fmt.Sprintf("http2: stream %d error %d: %s", e.StreamID, e.Code, e.Reason)
+}
+
+// readFrame reads the next frame from r. Frames with a payload larger than
+// maxSize are rejected with a FRAME_SIZE_ERROR.
+func readFrame(r io.Reader, maxSize uint32) (*frame, error) {
+	var hdr [frameHeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	length := uint32(hdr[0])<<16 | uint32(hdr[1])<<8 | uint32(hdr[2])
+	if length > maxSize {
+		return nil, connError{ErrCodeFrameSize, fmt.Sprintf("frame of %d bytes exceeds limit %d", length, maxSize)}
+	}
+
+	f := &frame{
+		Type:     frameType(hdr[3]),
+		Flags:    hdr[4],
+		StreamID: binary.BigEndian.Uint32(hdr[5:]) & (1<<31 - 1),
+		Payload:  make([]byte, length),
+	}
+	if _, err := io.ReadFull(r, f.Payload); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// appendFrame appends a frame with the given header fields and payload to dst.
+func appendFrame(dst []byte, t frameType, flags uint8, streamID uint32, payload []byte) []byte {
+	n := len(payload)
+	dst = append(dst, byte(n>>16), byte(n>>8), byte(n), byte(t), flags)
+	dst = binary.BigEndian.AppendUint32(dst, streamID&(1<<31-1))
+	return append(dst, payload...)
+}
+
+// stripPadding removes the padding of a DATA or HEADERS frame payload.
+func stripPadding(f *frame) ([]byte, error) {
+	payload := f.Payload
+	if !f.has(flagPadded) {
+		return payload, nil
+	}
+	if len(payload) == 0 {
+		return nil, connError{ErrCodeProtocol, "padded frame without pad length"}
+	}
+	pad := int(payload[0])
+	if pad >= len(payload) {
+		return nil, connError{ErrCodeProtocol, "padding exceeds frame payload"}
+	}
+	return payload[1 : len(payload)-pad], nil
+}
+
+// setting is a single SETTINGS parameter.
+type setting struct {
+	ID    uint16
+	Value uint32
+}
+
+// parseSettings decodes the parameters of a SETTINGS frame payload.
+func parseSettings(payload []byte) ([]setting, error) {
+	if len(payload)%6 != 0 {
+		return nil, connError{ErrCodeFrameSize, "SETTINGS payload is not a multiple of 6 bytes"}
+	}
+	settings := make([]setting, 0, len(payload)/6)
+	for i := 0; i < len(payload); i += 6 {
+		settings = append(settings, setting{
+			ID:    binary.BigEndian.Uint16(payload[i:]),
+			Value: binary.BigEndian.Uint32(payload[i+2:]),
+		})
+	}
+	return settings, nil
+}
+
+// appendSettings appends the payload encoding of settings to dst.
+func appendSettings(dst []byte, settings ...setting) []byte {
+	for _, s := range settings {
+		dst = binary.BigEndian.AppendUint16(dst, s.ID)
+		dst = binary.BigEndian.AppendUint32(dst, s.Value)
+	}
+	return dst
+}
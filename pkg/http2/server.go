@@ -0,0 +1,1022 @@
+// Package http2 implements the server side of HTTP/2 (RFC 9113): framing,
+// HPACK header compression, stream multiplexing, flow control, SETTINGS and
+// GOAWAY.
+//
+// Requests are presented to handlers as a request.Request and answered
+// through a response.Writer, so the same handler serves HTTP/1.1 and HTTP/2
+// clients unchanged. Like the HTTP/1.1 parser, the whole request body is
+// received before the handler is invoked.
+//
+// Request bodies are limited to 10 MiB and header lists to the size of an
+// HTTP/1.1 header section, request.DefaultMaxHeaderSize. Larger requests are
+// answered with 413 Content Too Large and 431 Request Header Fields Too
+// Large.
+package http2
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/hpack"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ClientPreface is the sequence every HTTP/2 client sends first on a new
+// connection.
+const ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+const (
+	// maxConcurrentStreams is the SETTINGS_MAX_CONCURRENT_STREAMS we advertise.
+	maxConcurrentStreams = 100
+	// maxHeaderBlockSize bounds a header block, including CONTINUATION frames.
+	maxHeaderBlockSize = 1 << 20
+	// maxHeaderListSize is the SETTINGS_MAX_HEADER_LIST_SIZE we advertise
+	// and enforce on decoded header blocks.
+	maxHeaderListSize = request.DefaultMaxHeaderSize
+	// maxBodySize is the default limit of a request body.
+	maxBodySize = 10 << 20
+)
+
+// Handler processes an HTTP/2 request. It has the same signature as
+// server.Handler.
+type Handler func(w *response.Writer, req *request.Request)
+
+// streamState is the lifecycle state of a stream, see RFC 9113 section 5.1.
+type streamState int
+
+const (
+	// stateOpen streams are still receiving the request.
+	stateOpen streamState = iota
+	// stateHalfClosedRemote streams have received the whole request and are
+	// being answered by the handler.
+	stateHalfClosedRemote
+	// stateClosed streams have ended or been reset.
+	stateClosed
+)
+
+// conn is a single HTTP/2 server connection.
+type conn struct {
+	nc      net.Conn
+	reader  io.Reader
+	handler Handler
+	dec     *hpack.Decoder
+
+	// wmu serializes frame writes and guards enc, whose state must follow
+	// the order header blocks are written in.
+	wmu sync.Mutex
+	enc *hpack.Encoder
+
+	// mu guards the fields below and is the lock of cond, which is
+	// broadcast whenever a flow control window grows or a stream closes.
+	mu                sync.Mutex
+	cond              *sync.Cond
+	streams           map[uint32]*stream
+	maxStreamID       uint32
+	sendWindow        int64
+	peerInitialWindow int64
+	peerMaxFrameSize  uint32
+	closed            bool
+	// readDone is set once no more frames will be read, so no window
+	// updates can arrive for writers waiting on flow control.
+	readDone bool
+	handlers sync.WaitGroup
+
+	// recvWindow is the connection receive window, how much DATA the client
+	// may still send. Like the fields below, it is only used by the reading
+	// goroutine.
+	recvWindow int64
+	// maxBodySize limits the size of a request body.
+	maxBodySize int64
+
+	// headerStream is the stream whose header block is being continued with
+	// CONTINUATION frames, or 0.
+	headerStream    uint32
+	headerBlock     []byte
+	headerEndStream bool
+}
+
+// stream is a single request/response exchange on a connection.
+type stream struct {
+	id         uint32
+	conn       *conn
+	state      streamState
+	sendWindow int64
+	// recvWindow is the stream receive window, used by the reading
+	// goroutine only.
+	recvWindow int64
+	req        *request.Request
+	// contentLength is the declared length of the request body, or -1.
+	contentLength int64
+	// pendingStatus is the response status, sent with the response headers.
+	pendingStatus response.StatusCode
+	// endStreamSent reports whether the response has been completed.
+	endStreamSent bool
+}
+
+// ServeConn serves HTTP/2 on nc, reading from reader, which should be nc or
+// a buffered reader wrapping it. The client connection preface must not have
+// been consumed yet. ServeConn returns when the connection is closed.
+func ServeConn(nc net.Conn, reader io.Reader, handler Handler) error {
+	c := newConn(nc, reader, handler)
+	if err := c.writeSettings(); err != nil {
+		return err
+	}
+	return c.serve()
+}
+
+// ServeUpgrade serves HTTP/2 on nc after an HTTP/1.1 request asked to
+// upgrade to h2c and the 101 Switching Protocols response has been sent.
+// settings is the value of the request's HTTP2-Settings header. The upgrade
+// request itself is answered on stream 1.
+func ServeUpgrade(nc net.Conn, reader io.Reader, handler Handler, req *request.Request, settings string) error {
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(settings, "="))
+	if err != nil {
+		return fmt.Errorf("http2: invalid HTTP2-Settings header (%v)", err)
+	}
+	params, err := parseSettings(payload)
+	if err != nil {
+		return fmt.Errorf("http2: invalid HTTP2-Settings header (%v)", err)
+	}
+
+	c := newConn(nc, reader, handler)
+	if err := c.applySettings(params); err != nil {
+		return err
+	}
+	if err := c.writeSettings(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	st := c.newStream(1)
+	st.req = req
+	c.maxStreamID = 1
+	c.mu.Unlock()
+	c.dispatch(st)
+
+	return c.serve()
+}
+
+func newConn(nc net.Conn, reader io.Reader, handler Handler) *conn {
+	c := &conn{
+		nc:                nc,
+		reader:            reader,
+		handler:           handler,
+		dec:               hpack.NewDecoder(hpack.DefaultTableSize),
+		recvWindow:        defaultWindowSize,
+		maxBodySize:       maxBodySize,
+		enc:               hpack.NewEncoder(hpack.DefaultTableSize),
+		streams:           map[uint32]*stream{},
+		sendWindow:        defaultWindowSize,
+		peerInitialWindow: defaultWindowSize,
+		peerMaxFrameSize:  defaultMaxFrameSize,
+	}
+	c.cond = sync.NewCond(&c.mu)
+	c.dec.SetMaxHeaderListSize(maxHeaderListSize)
+	return c
+}
+
+// serve reads the client preface and processes frames until the connection
+// ends, then waits for running handlers and closes the connection.
+func (c *conn) serve() error {
+	defer c.close()
+
+	preface := make([]byte, len(ClientPreface))
+	if _, err := io.ReadFull(c.reader, preface); err != nil {
+		return err
+	}
+	if string(preface) != ClientPreface {
+		c.goAway(ErrCodeProtocol)
+		return fmt.Errorf("http2: invalid client preface")
+	}
+
+	first := true
+	for {
+		f, err := readFrame(c.reader, defaultMaxFrameSize)
+		if err == nil && first && f.Type != frameSettings {
+			err = connError{ErrCodeProtocol, "first frame is not SETTINGS"}
+		}
+		if err == nil {
+			err = c.processFrame(f)
+		}
+		first = false
+
+		switch e := err.(type) {
+		case nil:
+		case streamError:
+			c.resetStream(e.StreamID, e.Code)
+		case connError:
+			c.goAway(e.Code)
+			return e
+		default:
+			if err == io.EOF || err == errGoAway {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// errGoAway is returned by processFrame once the client sent GOAWAY.
+var errGoAway = fmt.Errorf("http2: client sent GOAWAY")
+
+// close waits for running handlers, then closes the connection. Handlers
+// waiting for flow control window fail, since no WINDOW_UPDATE can arrive
+// anymore.
+func (c *conn) close() {
+	c.mu.Lock()
+	c.readDone = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	c.handlers.Wait()
+
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.nc.Close()
+}
+
+// processFrame handles a single frame received from the client.
+func (c *conn) processFrame(f *frame) error {
+	if c.headerStream != 0 && (f.Type != frameContinuation || f.StreamID != c.headerStream) {
+		return connError{ErrCodeProtocol, "expected CONTINUATION frame"}
+	}
+
+	switch f.Type {
+	case frameData:
+		return c.processData(f)
+	case frameHeaders:
+		return c.processHeaders(f)
+	case frameContinuation:
+		return c.processContinuation(f)
+	case framePriority:
+		if f.StreamID == 0 {
+			return connError{ErrCodeProtocol, "PRIORITY on stream 0"}
+		}
+		if len(f.Payload) != 5 {
+			return streamError{f.StreamID, ErrCodeFrameSize, "PRIORITY payload is not 5 bytes"}
+		}
+		return nil
+	case frameRSTStream:
+		return c.processRSTStream(f)
+	case frameSettings:
+		return c.processSettings(f)
+	case framePushPromise:
+		return connError{ErrCodeProtocol, "client sent PUSH_PROMISE"}
+	case framePing:
+		if f.StreamID != 0 {
+			return connError{ErrCodeProtocol, "PING on a stream"}
+		}
+		if len(f.Payload) != 8 {
+			return connError{ErrCodeFrameSize, "PING payload is not 8 bytes"}
+		}
+		if f.has(flagAck) {
+			return nil
+		}
+		return c.writeFrame(framePing, flagAck, 0, f.Payload)
+	case frameGoAway:
+		if f.StreamID != 0 {
+			return connError{ErrCodeProtocol, "GOAWAY on a stream"}
+		}
+		return errGoAway
+	case frameWindowUpdate:
+		return c.processWindowUpdate(f)
+	default:
+		// unknown frame types must be ignored
+		return nil
+	}
+}
+
+// processData buffers request body data on a stream.
+//
+// The handler only runs once the body is complete, so data is consumed as
+// it is buffered: the connection window is replenished right away, since
+// every stream is bounded, while the window of a stream only grows as long
+// as its buffered body stays within maxBodySize. A client is never allowed
+// to send more than that, and one that ignores the windows is stopped with
+// FLOW_CONTROL_ERROR.
+func (c *conn) processData(f *frame) error {
+	if f.StreamID == 0 {
+		return connError{ErrCodeProtocol, "DATA on stream 0"}
+	}
+	data, err := stripPadding(f)
+	if err != nil {
+		return err
+	}
+
+	// the whole frame counts against flow control, padding included
+	n := int64(len(f.Payload))
+	if n > c.recvWindow {
+		return connError{ErrCodeFlowControl, "DATA exceeds the connection window"}
+	}
+	c.recvWindow -= n
+
+	c.mu.Lock()
+	st := c.streams[f.StreamID]
+	idle := f.StreamID > c.maxStreamID
+	open := st != nil && st.state == stateOpen
+	c.mu.Unlock()
+	if idle {
+		return connError{ErrCodeProtocol, "DATA on idle stream"}
+	}
+
+	// the data is buffered or discarded below, either way consumed
+	if n > 0 {
+		c.recvWindow += n
+		if err := c.writeWindowUpdate(0, uint32(n)); err != nil {
+			return err
+		}
+	}
+	if !open {
+		return streamError{f.StreamID, ErrCodeStreamClosed, "DATA on closed stream"}
+	}
+	if n > st.recvWindow {
+		return streamError{f.StreamID, ErrCodeFlowControl, "DATA exceeds the stream window"}
+	}
+	st.recvWindow -= n
+
+	if int64(len(st.req.Body)+len(data)) > c.maxBodySize {
+		return c.reject(st, response.CONTENT_TOO_LARGE, f.has(flagEndStream))
+	}
+	st.req.Body = append(st.req.Body, data...)
+	if st.contentLength >= 0 && int64(len(st.req.Body)) > st.contentLength {
+		return streamError{f.StreamID, ErrCodeProtocol, "body exceeds content-length"}
+	}
+	if f.has(flagEndStream) {
+		return c.endRequest(st)
+	}
+
+	if grant := min(n, c.maxBodySize-int64(len(st.req.Body))-st.recvWindow); grant > 0 {
+		st.recvWindow += grant
+		return c.writeWindowUpdate(f.StreamID, uint32(grant))
+	}
+	return nil
+}
+
+// reject answers the request on st with statusCode without running the
+// handler. A client still sending the request is told to stop with
+// RST_STREAM.
+func (c *conn) reject(st *stream, statusCode response.StatusCode, endStream bool) error {
+	c.closeStream(st)
+	fields := []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(int(statusCode))}}
+	if err := c.writeHeaders(st.id, fields, true); err != nil {
+		return err
+	}
+	if !endStream {
+		c.resetStream(st.id, ErrCodeNo)
+	}
+	return nil
+}
+
+// processHeaders starts a header block: a new request or request trailers.
+func (c *conn) processHeaders(f *frame) error {
+	if f.StreamID == 0 {
+		return connError{ErrCodeProtocol, "HEADERS on stream 0"}
+	}
+	block, err := stripPadding(f)
+	if err != nil {
+		return err
+	}
+	if f.has(flagPriority) {
+		if len(block) < 5 {
+			return connError{ErrCodeFrameSize, "HEADERS priority fields truncated"}
+		}
+		block = block[5:]
+	}
+
+	c.headerStream = f.StreamID
+	c.headerBlock = append(c.headerBlock[:0], block...)
+	c.headerEndStream = f.has(flagEndStream)
+	if f.has(flagEndHeaders) {
+		return c.endHeaders()
+	}
+	return nil
+}
+
+// processContinuation continues the current header block.
+func (c *conn) processContinuation(f *frame) error {
+	if c.headerStream == 0 {
+		return connError{ErrCodeProtocol, "unexpected CONTINUATION frame"}
+	}
+	if len(c.headerBlock)+len(f.Payload) > maxHeaderBlockSize {
+		return connError{ErrCodeEnhanceYourCalm, "header block too large"}
+	}
+	c.headerBlock = append(c.headerBlock, f.Payload...)
+	if f.has(flagEndHeaders) {
+		return c.endHeaders()
+	}
+	return nil
+}
+
+// endHeaders decodes a complete header block and applies it to its stream.
+func (c *conn) endHeaders() error {
+	id, endStream := c.headerStream, c.headerEndStream
+	c.headerStream = 0
+
+	// the block must be decoded even for refused streams to keep the
+	// decoder's dynamic table in sync with the client
+	fields, err := c.dec.Decode(c.headerBlock)
+	tooLarge := errors.Is(err, hpack.ErrHeaderListTooLarge)
+	if err != nil && !tooLarge {
+		return connError{ErrCodeCompression, err.Error()}
+	}
+
+	c.mu.Lock()
+	st := c.streams[id]
+	switch {
+	case st != nil:
+		open := st.state == stateOpen
+		c.mu.Unlock()
+		if !open {
+			return streamError{id, ErrCodeStreamClosed, "HEADERS on closed stream"}
+		}
+		if !endStream {
+			return streamError{id, ErrCodeProtocol, "trailers without END_STREAM"}
+		}
+		if tooLarge {
+			return c.reject(st, response.REQUEST_HEADER_FIELDS_TOO_LARGE, true)
+		}
+		trailers, err := trailerHeaders(fields)
+		if err != nil {
+			return streamError{id, ErrCodeProtocol, err.Error()}
+		}
+		st.req.Trailers = trailers
+		return c.endRequest(st)
+	case id%2 == 0 || id <= c.maxStreamID:
+		c.mu.Unlock()
+		return connError{ErrCodeProtocol, fmt.Sprintf("invalid stream id %d", id)}
+	}
+	c.maxStreamID = id
+	if len(c.streams) >= maxConcurrentStreams {
+		c.mu.Unlock()
+		return streamError{id, ErrCodeRefusedStream, "too many concurrent streams"}
+	}
+	st = c.newStream(id)
+	c.mu.Unlock()
+
+	if tooLarge {
+		return c.reject(st, response.REQUEST_HEADER_FIELDS_TOO_LARGE, endStream)
+	}
+	req, contentLength, err := requestFromFields(fields)
+	if err != nil {
+		c.closeStream(st)
+		return streamError{id, ErrCodeProtocol, err.Error()}
+	}
+	st.req = req
+	st.contentLength = contentLength
+	if contentLength > c.maxBodySize {
+		return c.reject(st, response.CONTENT_TOO_LARGE, endStream)
+	}
+
+	if endStream {
+		return c.endRequest(st)
+	}
+	// the handler only runs once the body is complete, so a client waiting
+	// for permission to send it is answered right away
+	if req.ExpectsContinue() {
+		return c.writeHeaders(id, []hpack.HeaderField{{Name: ":status", Value: "100"}}, false)
+	}
+	return nil
+}
+
+// endRequest is called once the whole request has been received on st.
+func (c *conn) endRequest(st *stream) error {
+	if st.contentLength >= 0 && int64(len(st.req.Body)) != st.contentLength {
+		c.closeStream(st)
+		return streamError{st.id, ErrCodeProtocol, "body does not match content-length"}
+	}
+
+	c.dispatch(st)
+	return nil
+}
+
+// dispatch runs the handler for a fully received request in its own goroutine.
+func (c *conn) dispatch(st *stream) {
+	c.mu.Lock()
+	st.state = stateHalfClosedRemote
+	c.mu.Unlock()
+
+	c.handlers.Add(1)
+	go func() {
+		defer c.handlers.Done()
+		w := response.NewWriterWithEncoder(&streamEncoder{stream: st})
+		if st.req.RequestLine.Method == "HEAD" {
+			w.OmitBody()
+		}
+		c.handler(w, st.req)
+		st.finish(w)
+	}()
+}
+
+// processRSTStream closes a stream reset by the client.
+func (c *conn) processRSTStream(f *frame) error {
+	if f.StreamID == 0 {
+		return connError{ErrCodeProtocol, "RST_STREAM on stream 0"}
+	}
+	if len(f.Payload) != 4 {
+		return connError{ErrCodeFrameSize, "RST_STREAM payload is not 4 bytes"}
+	}
+
+	c.mu.Lock()
+	idle := f.StreamID > c.maxStreamID
+	st := c.streams[f.StreamID]
+	c.mu.Unlock()
+	if idle {
+		return connError{ErrCodeProtocol, "RST_STREAM on idle stream"}
+	}
+	if st != nil {
+		c.closeStream(st)
+	}
+	return nil
+}
+
+// processSettings applies and acknowledges the client's settings.
+func (c *conn) processSettings(f *frame) error {
+	if f.StreamID != 0 {
+		return connError{ErrCodeProtocol, "SETTINGS on a stream"}
+	}
+	if f.has(flagAck) {
+		if len(f.Payload) != 0 {
+			return connError{ErrCodeFrameSize, "SETTINGS ACK with payload"}
+		}
+		return nil
+	}
+
+	params, err := parseSettings(f.Payload)
+	if err != nil {
+		return err
+	}
+	if err := c.applySettings(params); err != nil {
+		return err
+	}
+	return c.writeFrame(frameSettings, flagAck, 0, nil)
+}
+
+// applySettings updates the connection with settings sent by the client.
+func (c *conn) applySettings(params []setting) error {
+	for _, p := range params {
+		switch p.ID {
+		case settingHeaderTableSize:
+			c.wmu.Lock()
+			c.enc.SetMaxTableSizeLimit(p.Value)
+			c.wmu.Unlock()
+		case settingEnablePush:
+			if p.Value > 1 {
+				return connError{ErrCodeProtocol, "invalid SETTINGS_ENABLE_PUSH"}
+			}
+		case settingInitialWindowSize:
+			if p.Value > maxWindowSize {
+				return connError{ErrCodeFlowControl, "SETTINGS_INITIAL_WINDOW_SIZE too large"}
+			}
+			c.mu.Lock()
+			delta := int64(p.Value) - c.peerInitialWindow
+			c.peerInitialWindow = int64(p.Value)
+			for _, st := range c.streams {
+				st.sendWindow += delta
+				if st.sendWindow > maxWindowSize {
+					c.mu.Unlock()
+					return connError{ErrCodeFlowControl, "stream window overflow"}
+				}
+			}
+			c.cond.Broadcast()
+			c.mu.Unlock()
+		case settingMaxFrameSize:
+			if p.Value < defaultMaxFrameSize || p.Value > maxFrameSizeLimit {
+				return connError{ErrCodeProtocol, "invalid SETTINGS_MAX_FRAME_SIZE"}
+			}
+			c.mu.Lock()
+			c.peerMaxFrameSize = p.Value
+			c.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// processWindowUpdate grows the connection or a stream send window.
+func (c *conn) processWindowUpdate(f *frame) error {
+	if len(f.Payload) != 4 {
+		return connError{ErrCodeFrameSize, "WINDOW_UPDATE payload is not 4 bytes"}
+	}
+	incr := int64(uint32(f.Payload[0]&0x7f)<<24 | uint32(f.Payload[1])<<16 | uint32(f.Payload[2])<<8 | uint32(f.Payload[3]))
+	if incr == 0 {
+		if f.StreamID == 0 {
+			return connError{ErrCodeProtocol, "WINDOW_UPDATE with zero increment"}
+		}
+		return streamError{f.StreamID, ErrCodeProtocol, "WINDOW_UPDATE with zero increment"}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f.StreamID == 0 {
+		c.sendWindow += incr
+		if c.sendWindow > maxWindowSize {
+			return connError{ErrCodeFlowControl, "connection window overflow"}
+		}
+	} else if st := c.streams[f.StreamID]; st != nil {
+		st.sendWindow += incr
+		if st.sendWindow > maxWindowSize {
+			return streamError{f.StreamID, ErrCodeFlowControl, "stream window overflow"}
+		}
+	} else if f.StreamID > c.maxStreamID {
+		return connError{ErrCodeProtocol, "WINDOW_UPDATE on idle stream"}
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+// newStream registers a new stream. c.mu must be held.
+func (c *conn) newStream(id uint32) *stream {
+	st := &stream{
+		id:            id,
+		conn:          c,
+		state:         stateOpen,
+		sendWindow:    c.peerInitialWindow,
+		recvWindow:    defaultWindowSize,
+		contentLength: -1,
+	}
+	c.streams[id] = st
+	return st
+}
+
+// closeStream marks st closed and forgets it.
+func (c *conn) closeStream(st *stream) {
+	c.mu.Lock()
+	st.state = stateClosed
+	delete(c.streams, st.id)
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// resetStream closes a stream and sends RST_STREAM with code.
+func (c *conn) resetStream(id uint32, code ErrCode) {
+	c.mu.Lock()
+	if st := c.streams[id]; st != nil {
+		st.state = stateClosed
+		delete(c.streams, id)
+		c.cond.Broadcast()
+	}
+	c.mu.Unlock()
+
+	payload := []byte{byte(code >> 24), byte(code >> 16), byte(code >> 8), byte(code)}
+	if err := c.writeFrame(frameRSTStream, 0, id, payload); err != nil {
+		log.Println(err)
+	}
+}
+
+// goAway sends GOAWAY with the last processed stream and code.
+func (c *conn) goAway(code ErrCode) {
+	c.mu.Lock()
+	last := c.maxStreamID
+	c.mu.Unlock()
+
+	payload := []byte{
+		byte(last >> 24), byte(last >> 16), byte(last >> 8), byte(last),
+		byte(code >> 24), byte(code >> 16), byte(code >> 8), byte(code),
+	}
+	if err := c.writeFrame(frameGoAway, 0, 0, payload); err != nil {
+		log.Println(err)
+	}
+}
+
+// writeSettings sends the server's initial SETTINGS frame.
+func (c *conn) writeSettings() error {
+	payload := appendSettings(nil,
+		setting{settingMaxConcurrentStreams, maxConcurrentStreams},
+		setting{settingEnablePush, 0},
+		setting{settingMaxHeaderListSize, maxHeaderListSize},
+	)
+	return c.writeFrame(frameSettings, 0, 0, payload)
+}
+
+// writeWindowUpdate grants the client n more bytes on a stream, or on the
+// connection for stream 0.
+func (c *conn) writeWindowUpdate(streamID, n uint32) error {
+	payload := []byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	return c.writeFrame(frameWindowUpdate, 0, streamID, payload)
+}
+
+// writeFrame writes a single frame.
+func (c *conn) writeFrame(t frameType, flags uint8, streamID uint32, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.nc.Write(appendFrame(nil, t, flags, streamID, payload))
+	return err
+}
+
+// writeHeaders HPACK encodes fields and writes them as a HEADERS frame,
+// followed by CONTINUATION frames if the block does not fit in one frame.
+func (c *conn) writeHeaders(streamID uint32, fields []hpack.HeaderField, endStream bool) error {
+	c.mu.Lock()
+	maxSize := int(c.peerMaxFrameSize)
+	c.mu.Unlock()
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	block := c.enc.Encode(nil, fields)
+	var buf []byte
+	t, flags := frameHeaders, uint8(0)
+	if endStream {
+		flags |= flagEndStream
+	}
+	for {
+		n := min(len(block), maxSize)
+		if n == len(block) {
+			flags |= flagEndHeaders
+		}
+		buf = appendFrame(buf, t, flags, streamID, block[:n])
+		block = block[n:]
+		if len(block) == 0 {
+			break
+		}
+		t, flags = frameContinuation, 0
+	}
+	_, err := c.nc.Write(buf)
+	return err
+}
+
+// writeData writes p as DATA frames, waiting for flow control window as
+// needed. It returns the number of bytes of p that were written.
+func (st *stream) writeData(p []byte, endStream bool) (int, error) {
+	c := st.conn
+	written := 0
+	for len(p) > 0 || endStream {
+		c.mu.Lock()
+		blocked := len(p) > 0 && (st.sendWindow <= 0 || c.sendWindow <= 0)
+		for blocked && st.state != stateClosed && !c.readDone {
+			c.cond.Wait()
+			blocked = len(p) > 0 && (st.sendWindow <= 0 || c.sendWindow <= 0)
+		}
+		if st.state == stateClosed || c.closed || blocked {
+			c.mu.Unlock()
+			return written, fmt.Errorf("http2: stream %d closed", st.id)
+		}
+		n := min(int64(len(p)), st.sendWindow, c.sendWindow, int64(c.peerMaxFrameSize))
+		st.sendWindow -= n
+		c.sendWindow -= n
+		c.mu.Unlock()
+
+		flags := uint8(0)
+		last := int(n) == len(p)
+		if last && endStream {
+			flags = flagEndStream
+		}
+		if err := c.writeFrame(frameData, flags, st.id, p[:n]); err != nil {
+			return written, err
+		}
+		written += int(n)
+		p = p[n:]
+		if last {
+			break
+		}
+	}
+	if endStream {
+		st.endStreamSent = true
+		c.closeStream(st)
+	}
+	return written, nil
+}
+
+// finish completes the response after the handler returned, leaving w in
+// whatever state it reached.
+func (st *stream) finish(w *response.Writer) {
+	if st.endStreamSent {
+		return
+	}
+
+	var err error
+	switch w.State {
+	case response.StatusLine:
+		// the handler wrote nothing, which HTTP/1.1 clients would see as a
+		// closed connection
+		st.conn.resetStream(st.id, ErrCodeInternal)
+		return
+	case response.Header:
+		err = st.conn.writeHeaders(st.id, []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(int(st.pendingStatus))}}, true)
+		st.endStreamSent = true
+		st.conn.closeStream(st)
+	default:
+		_, err = st.writeData(nil, true)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// requestFromFields builds a request from a decoded request header block,
+// validating it per RFC 9113 section 8.3. It also returns the declared
+// content length, or -1.
+func requestFromFields(fields []hpack.HeaderField) (*request.Request, int64, error) {
+	req := &request.Request{
+		RequestLine: request.RequestLine{HttpVersion: "2"},
+		Headers:     headers.NewHeaders(),
+	}
+	var scheme, authority string
+	// values collects repeated fields, so each is combined once
+	values := map[string][]string{}
+	regular := false
+	for _, f := range fields {
+		if strings.HasPrefix(f.Name, ":") {
+			if regular {
+				return nil, 0, fmt.Errorf("pseudo-header %s after regular header", f.Name)
+			}
+			var dst *string
+			switch f.Name {
+			case ":method":
+				dst = &req.RequestLine.Method
+			case ":path":
+				dst = &req.RequestLine.RequestTarget
+			case ":scheme":
+				dst = &scheme
+			case ":authority":
+				dst = &authority
+			default:
+				return nil, 0, fmt.Errorf("unknown pseudo-header %s", f.Name)
+			}
+			if *dst != "" {
+				return nil, 0, fmt.Errorf("duplicate pseudo-header %s", f.Name)
+			}
+			*dst = f.Value
+			continue
+		}
+
+		regular = true
+		if err := validateField(f); err != nil {
+			return nil, 0, err
+		}
+		values[f.Name] = append(values[f.Name], strings.TrimSpace(f.Value))
+	}
+	for name, v := range values {
+		if err := req.Headers.Add(name, headers.Join(name, v)); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if req.RequestLine.Method == "CONNECT" {
+		if authority == "" || scheme != "" || req.RequestLine.RequestTarget != "" {
+			return nil, 0, fmt.Errorf("malformed CONNECT request")
+		}
+		req.RequestLine.RequestTarget = authority
+	} else if req.RequestLine.Method == "" || scheme == "" || req.RequestLine.RequestTarget == "" {
+		return nil, 0, fmt.Errorf("missing required pseudo-header")
+	}
+
+	if authority != "" && req.Headers.Get("Host") == "" {
+		req.Headers.OverrideValue("host", authority)
+	}
+
+	contentLength := int64(-1)
+	if cl := req.Headers.Get("Content-Length"); cl != "" {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("invalid content-length %q", cl)
+		}
+		contentLength = n
+	}
+	return req, contentLength, nil
+}
+
+// trailerHeaders converts a decoded trailer block into Headers.
+func trailerHeaders(fields []hpack.HeaderField) (headers.Headers, error) {
+	h := headers.NewHeaders()
+	values := map[string][]string{}
+	for _, f := range fields {
+		if strings.HasPrefix(f.Name, ":") {
+			return nil, fmt.Errorf("pseudo-header %s in trailers", f.Name)
+		}
+		if err := validateField(f); err != nil {
+			return nil, err
+		}
+		values[f.Name] = append(values[f.Name], strings.TrimSpace(f.Value))
+	}
+	for name, v := range values {
+		if err := h.Add(name, headers.Join(name, v)); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// validateField rejects fields that are malformed in HTTP/2: uppercase
+// names and connection-specific fields.
+func validateField(f hpack.HeaderField) error {
+	if strings.ToLower(f.Name) != f.Name {
+		return fmt.Errorf("uppercase header name %q", f.Name)
+	}
+	if isConnectionSpecific(f.Name) {
+		return fmt.Errorf("connection-specific header %q", f.Name)
+	}
+	if f.Name == "te" && f.Value != "trailers" {
+		return fmt.Errorf("invalid te header %q", f.Value)
+	}
+	if strings.ContainsAny(f.Value, "\r\n\x00") {
+		return fmt.Errorf("invalid value for header %q", f.Name)
+	}
+	return nil
+}
+
+// isConnectionSpecific reports whether name is a header that only applies
+// to a single HTTP/1.1 connection and must not appear in HTTP/2.
+func isConnectionSpecific(name string) bool {
+	switch name {
+	case "connection", "keep-alive", "proxy-connection", "transfer-encoding", "upgrade":
+		return true
+	}
+	return false
+}
+
+// streamEncoder serializes a response as HTTP/2 frames on a stream.
+type streamEncoder struct {
+	stream *stream
+}
+
+// EncodeInterim writes an informational response as a HEADERS frame that
+// does not end the stream.
+func (e *streamEncoder) EncodeInterim(statusCode response.StatusCode, h headers.Headers) error {
+	fields := []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(int(statusCode))}}
+	fields, err := appendFields(fields, h)
+	if err != nil {
+		return err
+	}
+	return e.stream.conn.writeHeaders(e.stream.id, fields, false)
+}
+
+// EncodeStatusLine records the status, which HTTP/2 sends as the :status
+// pseudo-header of the HEADERS frame.
+func (e *streamEncoder) EncodeStatusLine(statusCode response.StatusCode) error {
+	e.stream.pendingStatus = statusCode
+	return nil
+}
+
+// EncodeHeaders writes the response HEADERS frame. Connection-specific
+// headers such as Transfer-Encoding are dropped, since HTTP/2 frames the
+// body itself.
+func (e *streamEncoder) EncodeHeaders(h headers.Headers) error {
+	fields := []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(int(e.stream.pendingStatus))}}
+	fields, err := appendFields(fields, h)
+	if err != nil {
+		return err
+	}
+	return e.stream.conn.writeHeaders(e.stream.id, fields, false)
+}
+
+// EncodeBody writes p as DATA frames.
+func (e *streamEncoder) EncodeBody(p []byte) (int, error) {
+	return e.stream.writeData(p, false)
+}
+
+// EncodeChunk writes p as DATA frames.
+func (e *streamEncoder) EncodeChunk(p []byte) (int, error) {
+	return e.stream.writeData(p, false)
+}
+
+// EncodeChunksDone writes nothing; the stream ends with the trailers.
+func (e *streamEncoder) EncodeChunksDone() (int, error) {
+	return 0, nil
+}
+
+// EncodeTrailers ends the stream with a trailing HEADERS frame, or with an
+// empty DATA frame if there are no trailers.
+func (e *streamEncoder) EncodeTrailers(h headers.Headers) error {
+	st := e.stream
+	if len(h) == 0 {
+		_, err := st.writeData(nil, true)
+		return err
+	}
+
+	fields, err := appendFields(nil, h)
+	if err != nil {
+		return err
+	}
+	err = st.conn.writeHeaders(st.id, fields, true)
+	st.endStreamSent = true
+	st.conn.closeStream(st)
+	return err
+}
+
+// appendFields appends h to fields as lowercase HTTP/2 header fields, with
+// a field for each Set-Cookie value. Values containing CR, LF or NUL are
+// rejected, see RFC 9113 section 8.2.1.
+func appendFields(fields []hpack.HeaderField, h headers.Headers) ([]hpack.HeaderField, error) {
+	for k, v := range h {
+		name := strings.ToLower(strings.TrimSpace(k))
+		if isConnectionSpecific(name) {
+			continue
+		}
+		for _, line := range headers.SplitLines(name, v) {
+			if !headers.ValidValue(line) {
+				return nil, fmt.Errorf("Error: invalid value for header %q: must not contain CR, LF or NUL", k)
+			}
+			fields = append(fields, hpack.HeaderField{Name: name, Value: strings.TrimSpace(line)})
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,239 @@
+package http2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/hpack"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConn is the client side of a connection served over a pipe.
+type testConn struct {
+	t      *testing.T
+	nc     net.Conn
+	enc    *hpack.Encoder
+	dec    *hpack.Decoder
+	frames chan *frame
+}
+
+// newTestConn serves handler on a pipe with the given body limit and sends
+// the client preface.
+func newTestConn(t *testing.T, handler Handler, maxBodySize int64) *testConn {
+	client, server := net.Pipe()
+	tc := &testConn{
+		t:      t,
+		nc:     client,
+		enc:    hpack.NewEncoder(hpack.DefaultTableSize),
+		dec:    hpack.NewDecoder(hpack.DefaultTableSize),
+		frames: make(chan *frame, 1000),
+	}
+	go func() {
+		defer close(tc.frames)
+		for {
+			f, err := readFrame(client, maxFrameSizeLimit)
+			if err != nil {
+				return
+			}
+			tc.frames <- f
+		}
+	}()
+
+	c := newConn(server, server, handler)
+	c.maxBodySize = maxBodySize
+	go func() {
+		if err := c.writeSettings(); err == nil {
+			c.serve()
+		}
+	}()
+	t.Cleanup(func() { client.Close() })
+
+	_, err := client.Write(appendFrame([]byte(ClientPreface), frameSettings, 0, 0, nil))
+	require.NoError(t, err)
+	return tc
+}
+
+// write sends a frame.
+func (tc *testConn) write(t frameType, flags uint8, streamID uint32, payload []byte) {
+	_, err := tc.nc.Write(appendFrame(nil, t, flags, streamID, payload))
+	require.NoError(tc.t, err)
+}
+
+// writeData sends data on streamID in DATA frames of the largest size the
+// server accepts.
+func (tc *testConn) writeData(streamID uint32, data []byte) {
+	for len(data) > 0 {
+		n := min(len(data), defaultMaxFrameSize)
+		tc.write(frameData, 0, streamID, data[:n])
+		data = data[n:]
+	}
+}
+
+// writeRequest sends the request headers of a POST request on streamID.
+func (tc *testConn) writeRequest(streamID uint32, endStream bool, extra ...hpack.HeaderField) {
+	fields := append([]hpack.HeaderField{
+		{Name: ":method", Value: "POST"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":path", Value: "/"},
+		{Name: ":authority", Value: "localhost"},
+	}, extra...)
+	flags := uint8(flagEndHeaders)
+	if endStream {
+		flags |= flagEndStream
+	}
+	tc.write(frameHeaders, flags, streamID, tc.enc.Encode(nil, fields))
+}
+
+// read returns the next frame from the server.
+func (tc *testConn) read() *frame {
+	select {
+	case f, ok := <-tc.frames:
+		require.True(tc.t, ok, "connection closed")
+		return f
+	case <-time.After(5 * time.Second):
+		require.FailNow(tc.t, "timed out waiting for a frame")
+		return nil
+	}
+}
+
+// readStatus skips frames until the response HEADERS of streamID and returns
+// its status.
+func (tc *testConn) readStatus(streamID uint32) string {
+	for {
+		f := tc.read()
+		if f.Type != frameHeaders || f.StreamID != streamID {
+			continue
+		}
+		fields, err := tc.dec.Decode(f.Payload)
+		require.NoError(tc.t, err)
+		for _, field := range fields {
+			if field.Name == ":status" {
+				return field.Value
+			}
+		}
+	}
+}
+
+// readReset skips frames until a RST_STREAM of streamID and returns its error
+// code, failing if the stream window grows in between.
+func (tc *testConn) readReset(streamID uint32) ErrCode {
+	for {
+		f := tc.read()
+		if f.Type == frameWindowUpdate && f.StreamID == streamID {
+			require.FailNow(tc.t, "unexpected WINDOW_UPDATE")
+		}
+		if f.Type == frameRSTStream && f.StreamID == streamID {
+			return ErrCode(binary.BigEndian.Uint32(f.Payload))
+		}
+	}
+}
+
+// lengthHandler answers with the length of the request body.
+func lengthHandler(w *response.Writer, req *request.Request) {
+	body := []byte(fmt.Sprint(len(req.Body)))
+	w.WriteStatusLine(response.OK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func TestSettings(t *testing.T) {
+	tc := newTestConn(t, lengthHandler, maxBodySize)
+
+	// Test: The header list size limit is advertised
+	f := tc.read()
+	require.Equal(t, frameSettings, f.Type)
+	params, err := parseSettings(f.Payload)
+	require.NoError(t, err)
+	assert.Contains(t, params, setting{settingMaxHeaderListSize, maxHeaderListSize})
+}
+
+func TestFlowControl(t *testing.T) {
+	const limit = 100000
+	tc := newTestConn(t, lengthHandler, limit)
+	tc.writeRequest(1, false)
+
+	// Test: The initial window is used up without waiting
+	tc.writeData(1, make([]byte, defaultWindowSize))
+
+	// Test: The stream window grows only up to the body limit
+	granted := 0
+	for granted < limit-defaultWindowSize {
+		f := tc.read()
+		if f.Type == frameWindowUpdate && f.StreamID == 1 {
+			granted += int(binary.BigEndian.Uint32(f.Payload))
+		}
+	}
+	assert.Equal(t, limit-defaultWindowSize, granted)
+	tc.writeData(1, make([]byte, granted))
+
+	// Test: Data beyond the window is a flow control error
+	tc.write(frameData, flagEndStream, 1, []byte("x"))
+	assert.Equal(t, ErrCodeFlowControl, tc.readReset(1))
+
+	// Test: The connection window was replenished for other streams
+	tc.writeRequest(3, false)
+	tc.write(frameData, flagEndStream, 3, []byte("hello"))
+	assert.Equal(t, "200", tc.readStatus(3))
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	tc := newTestConn(t, lengthHandler, 10)
+
+	// Test: A declared length above the limit is rejected at once
+	tc.writeRequest(1, false, hpack.HeaderField{Name: "content-length", Value: "11"})
+	assert.Equal(t, "413", tc.readStatus(1))
+	assert.Equal(t, ErrCodeNo, tc.readReset(1))
+
+	// Test: A body growing above the limit is rejected
+	tc.writeRequest(3, false)
+	tc.write(frameData, 0, 3, []byte("hello"))
+	tc.write(frameData, 0, 3, []byte("world!"))
+	assert.Equal(t, "413", tc.readStatus(3))
+	assert.Equal(t, ErrCodeNo, tc.readReset(3))
+
+	// Test: A body within the limit is accepted
+	tc.writeRequest(5, false)
+	tc.write(frameData, flagEndStream, 5, []byte("hello"))
+	assert.Equal(t, "200", tc.readStatus(5))
+}
+
+func TestHeaderListTooLarge(t *testing.T) {
+	tc := newTestConn(t, lengthHandler, maxBodySize)
+
+	// Test: A small block referencing a large table entry over and over is
+	// answered with 431
+	big := hpack.HeaderField{Name: "x-big", Value: strings.Repeat("a", 4000)}
+	tc.writeRequest(1, true, big)
+	assert.Equal(t, "200", tc.readStatus(1))
+	bomb := make([]hpack.HeaderField, 20)
+	for i := range bomb {
+		bomb[i] = big
+	}
+	tc.writeRequest(3, true, bomb...)
+	assert.Equal(t, "431", tc.readStatus(3))
+
+	// Test: The connection stays usable, with the tables in sync
+	tc.writeRequest(5, true, big)
+	assert.Equal(t, "200", tc.readStatus(5))
+}
+
+func TestAppendFields(t *testing.T) {
+	// Test: Each Set-Cookie value gets a field
+	fields, err := appendFields(nil, headers.Headers{"Set-Cookie": "a=1\nb=2"})
+	require.NoError(t, err)
+	assert.Equal(t, []hpack.HeaderField{{Name: "set-cookie", Value: "a=1"}, {Name: "set-cookie", Value: "b=2"}}, fields)
+
+	// Test: Values with CR, LF or NUL are rejected
+	for _, value := range []string{"a\nb", "a\rb", "a\x00b"} {
+		_, err := appendFields(nil, headers.Headers{"x-custom": value})
+		assert.Error(t, err, "%q", value)
+	}
+}
@@ -0,0 +1,41 @@
+// Package handlertest runs handlers on requests parsed from raw HTTP/1.1 and
+// parses the responses they write, for the tests of handler packages.
+package handlertest
+
+import (
+	"bytes"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Serve runs handler for a request with the method, target and extra header
+// lines, and parses the response with response.ResponseFromReader. The body
+// of a response to HEAD is omitted, as the server does. The body is returned
+// read to the end, so the trailers of the response are complete.
+func Serve(t *testing.T, handler server.Handler, method, target string, headerLines ...string) (*response.Response, string) {
+	t.Helper()
+	raw := method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n"
+	for _, line := range headerLines {
+		raw += line + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	if method == "HEAD" {
+		w.OmitBody()
+	}
+	handler(w, req)
+
+	res, err := response.ResponseFromReaderWithOptions(&buf, response.ParseOptions{Method: method})
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(body)
+}
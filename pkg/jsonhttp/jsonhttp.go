@@ -0,0 +1,245 @@
+// Package jsonhttp provides helpers for handlers exchanging JSON: decoding
+// request bodies strictly, writing values as JSON, and reporting errors as
+// RFC 9457 problem details.
+//
+// Decode returns a *server.HandlerError carrying the status code for the
+// client, which WriteError turns into an application/problem+json response:
+//
+//	func create(w *response.Writer, req *request.Request) {
+//		var item Item
+//		if err := jsonhttp.Decode(req, &item, nil); err != nil {
+//			jsonhttp.WriteError(w, err)
+//			return
+//		}
+//		...
+//		jsonhttp.Write(w, response.OK, item)
+//	}
+package jsonhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"io"
+	"mime"
+	"strings"
+)
+
+// DefaultMaxSize is the default Options.MaxSize.
+const DefaultMaxSize = 1 << 20
+
+// Options controls how Decode reads a request body.
+type Options struct {
+	// MaxSize is the largest body in bytes, DefaultMaxSize if zero.
+	MaxSize int64
+	// AllowUnknownFields accepts object keys that do not match a field of
+	// the destination struct instead of rejecting the body.
+	AllowUnknownFields bool
+}
+
+// Decode decodes the JSON body of req into v, which must be a pointer. The
+// body must be a single JSON value. opts may be nil.
+//
+// Failures are returned as a *server.HandlerError with the status code to
+// answer:
+//
+//   - 415 Unsupported Media Type if the Content-Type is not
+//     application/json or a +json type, or names a charset other than
+//     UTF-8.
+//   - 413 Content Too Large if the body is larger than Options.MaxSize.
+//   - 400 Bad Request if the body is empty, malformed, has a value of the
+//     wrong type, an unknown field or data after the value.
+//
+// The media type and Content-Length are checked before a deferred body is
+// read, so on a server deferring them, see server.DeferExpectedBodies, a
+// request with "Expect: 100-continue" is rejected without the client sending
+// the body. A deferred body without a Content-Length, such as a chunked one,
+// is read only until it exceeds Options.MaxSize.
+func Decode(req *request.Request, v any, opts *Options) error {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxSize <= 0 {
+		o.MaxSize = DefaultMaxSize
+	}
+
+	if err := checkContentType(req.Headers.Get("Content-Type")); err != nil {
+		return err
+	}
+	body, err := req.ReadBodyLimit(o.MaxSize)
+	if errors.Is(err, request.ErrBodyTooLarge) {
+		return tooLarge(o.MaxSize)
+	}
+	if err != nil {
+		return badRequest("could not read body (%v)", err)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return badRequest("body must not be empty")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if !o.AllowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return badRequest("body must contain a single JSON value")
+	}
+	return nil
+}
+
+// checkContentType accepts application/json and types with the +json
+// suffix, e.g. application/merge-patch+json, in UTF-8.
+func checkContentType(contentType string) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "application/json" || strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")) {
+		if charset, ok := params["charset"]; !ok || strings.EqualFold(charset, "utf-8") {
+			return nil
+		}
+	}
+	return &server.HandlerError{
+		StatusCode: int(response.UNSUPPORTED_MEDIA_TYPE),
+		Message:    "Content-Type must be application/json",
+	}
+}
+
+// decodeError describes a failure of json.Decoder.Decode for the client.
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return badRequest("malformed JSON at offset %d", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return badRequest("malformed JSON: unexpected end of body")
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return badRequest("field %q must be of type %s", typeErr.Field, typeErr.Type)
+		}
+		return badRequest("body must be of type %s", typeErr.Type)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		return badRequest("unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	default:
+		return badRequest("invalid JSON (%v)", err)
+	}
+}
+
+// badRequest returns a 400 Bad Request error with a formatted message.
+func badRequest(format string, args ...any) error {
+	return &server.HandlerError{
+		StatusCode: int(response.BAD_REQUEST),
+		Message:    fmt.Sprintf(format, args...),
+	}
+}
+
+// tooLarge returns a 413 Content Too Large error for the limit.
+func tooLarge(limit int64) error {
+	return &server.HandlerError{
+		StatusCode: int(response.CONTENT_TOO_LARGE),
+		Message:    fmt.Sprintf("body must not be larger than %d bytes", limit),
+	}
+}
+
+// Write writes a complete response with status code statusCode and v
+// encoded as an application/json body, with its Content-Length.
+func Write(w *response.Writer, statusCode response.StatusCode, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeBody(w, statusCode, "application/json", body)
+}
+
+// writeBody writes a complete response with the body of contentType.
+func writeBody(w *response.Writer, statusCode response.StatusCode, contentType string, body []byte) error {
+	h := response.GetDefaultHeaders(len(body))
+	h["content-type"] = contentType
+
+	err := w.WriteStatusLine(statusCode)
+	if err != nil {
+		return err
+	}
+
+	err = w.WriteHeaders(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.WriteBody(body)
+	return err
+}
+
+// Problem is a problem details object of RFC 9457, describing an error in
+// an HTTP API.
+type Problem struct {
+	// Type is a URI identifying the problem type. Empty means
+	// "about:blank": the problem is described by the status code alone.
+	Type string `json:"type,omitempty"`
+	// Title is a short summary of the problem type, the reason phrase of
+	// Status if empty and Type is "about:blank".
+	Title string `json:"title,omitempty"`
+	// Status is the status code of the response, 500 if zero.
+	Status int `json:"status,omitempty"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is a URI identifying this occurrence of the problem.
+	Instance string `json:"instance,omitempty"`
+	// Extensions holds additional members. They cannot replace the members
+	// above.
+	Extensions map[string]any `json:"-"`
+}
+
+// MarshalJSON encodes the members of p followed by its extensions.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type members Problem
+	body, err := json.Marshal((*members)(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return body, err
+	}
+
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// WriteProblem writes p as a complete application/problem+json response
+// with the status code p.Status.
+func WriteProblem(w *response.Writer, p *Problem) error {
+	problem := *p
+	if problem.Status == 0 {
+		problem.Status = int(response.INTERNAL_SERVER_ERROR)
+	}
+	if problem.Title == "" && (problem.Type == "" || problem.Type == "about:blank") {
+		problem.Title = response.StatusText(response.StatusCode(problem.Status))
+	}
+
+	body, err := json.Marshal(&problem)
+	if err != nil {
+		return err
+	}
+	return writeBody(w, response.StatusCode(problem.Status), "application/problem+json", body)
+}
+
+// WriteError writes err as a problem details response. A *server.HandlerError
+// gives the status code and detail; any other error is answered with 500
+// Internal Server Error without revealing its message.
+func WriteError(w *response.Writer, err error) error {
+	var handlerErr *server.HandlerError
+	if errors.As(err, &handlerErr) {
+		return WriteProblem(w, &Problem{Status: handlerErr.StatusCode, Detail: handlerErr.Message})
+	}
+	return WriteProblem(w, &Problem{Status: int(response.INTERNAL_SERVER_ERROR)})
+}
@@ -0,0 +1,189 @@
+package jsonhttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+// newRequest parses a POST request with the content type and body.
+func newRequest(t *testing.T, contentType, body string) *request.Request {
+	t.Helper()
+	raw := fmt.Sprintf("POST /items HTTP/1.1\r\nHost: localhost\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s", contentType, len(body), body)
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	return req
+}
+
+// statusOf returns the status code of a *server.HandlerError.
+func statusOf(t *testing.T, err error) int {
+	t.Helper()
+	var handlerErr *server.HandlerError
+	require.True(t, errors.As(err, &handlerErr), "%v", err)
+	return handlerErr.StatusCode
+}
+
+// record runs write against a Writer and parses the response.
+func record(t *testing.T, write func(w *response.Writer) error) (*http.Response, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, write(response.NewWriter(&buf)))
+	res, err := http.ReadResponse(bufio.NewReader(&buf), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, body
+}
+
+func TestDecode(t *testing.T) {
+	// Test: A valid body, with JSON and +json media types
+	for _, contentType := range []string{"application/json", "application/json; charset=UTF-8", "application/merge-patch+json"} {
+		var v item
+		require.NoError(t, Decode(newRequest(t, contentType, `{"name":"a","count":2,"tags":["x"]}`), &v, nil), contentType)
+		assert.Equal(t, item{Name: "a", Count: 2, Tags: []string{"x"}}, v)
+	}
+
+	// Test: Other media types get 415
+	for _, contentType := range []string{"text/plain", "application/json; charset=latin1", "application/jsonp", ""} {
+		var v item
+		err := Decode(newRequest(t, contentType, `{}`), &v, nil)
+		assert.Equal(t, http.StatusUnsupportedMediaType, statusOf(t, err), contentType)
+	}
+
+	// Test: Invalid bodies get 400 with a description
+	tests := []struct {
+		body    string
+		message string
+	}{
+		{"", "body must not be empty"},
+		{`{"name":"a",}`, "malformed JSON at offset 13"},
+		{`{"name":"a"`, "malformed JSON: unexpected end of body"},
+		{`{"count":"two"}`, `field "count" must be of type int`},
+		{`[1]`, "body must be of type jsonhttp.item"},
+		{`{"name":"a","extra":1}`, `unknown field "extra"`},
+		{`{"name":"a"} {"name":"b"}`, "body must contain a single JSON value"},
+	}
+	for _, tt := range tests {
+		var v item
+		err := Decode(newRequest(t, "application/json", tt.body), &v, nil)
+		assert.Equal(t, http.StatusBadRequest, statusOf(t, err), tt.body)
+		assert.EqualError(t, err, tt.message, tt.body)
+	}
+
+	// Test: Unknown fields can be allowed
+	var v item
+	require.NoError(t, Decode(newRequest(t, "application/json", `{"name":"a","extra":1}`), &v, &Options{AllowUnknownFields: true}))
+	assert.Equal(t, "a", v.Name)
+
+	// Test: Bodies above the size limit get 413
+	err := Decode(newRequest(t, "application/json", `{"name":"`+strings.Repeat("x", 100)+`"}`), &v, &Options{MaxSize: 50})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusOf(t, err))
+}
+
+func TestDecodeDeferredBody(t *testing.T) {
+	raw := "POST /items HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\nContent-Length: 12\r\nExpect: 100-continue\r\n\r\n{\"name\":\"a\"}"
+
+	// Test: A deferred body is read
+	req, err := request.RequestFromReaderWithOptions(strings.NewReader(raw), request.Options{DeferExpectedBody: true})
+	require.NoError(t, err)
+	var v item
+	require.NoError(t, Decode(req, &v, nil))
+	assert.Equal(t, "a", v.Name)
+
+	// Test: A body that is too large is rejected before it is read
+	req, err = request.RequestFromReaderWithOptions(strings.NewReader(raw), request.Options{DeferExpectedBody: true})
+	require.NoError(t, err)
+	err = Decode(req, &v, &Options{MaxSize: 5})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusOf(t, err))
+	assert.True(t, req.ExpectsContinue())
+
+	// Test: A chunked body is read only until it exceeds the limit
+	chunk := `{"name":"` + strings.Repeat("x", 1000) + `"}`
+	source := strings.NewReader(fmt.Sprintf("POST /items HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\nTransfer-Encoding: chunked\r\nExpect: 100-continue\r\n\r\n%x\r\n%s\r\n", len(chunk), chunk) +
+		strings.Repeat(fmt.Sprintf("%x\r\n%s\r\n", len(chunk), chunk), 1000) + "0\r\n\r\n")
+	req, err = request.RequestFromReaderWithOptions(source, request.Options{DeferExpectedBody: true})
+	require.NoError(t, err)
+	err = Decode(req, &v, &Options{MaxSize: 5000})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, statusOf(t, err))
+	assert.Greater(t, source.Len(), 900*len(chunk))
+}
+
+func TestWrite(t *testing.T) {
+	// Test: Values are written with their exact length
+	res, body := record(t, func(w *response.Writer) error {
+		return Write(w, response.OK, item{Name: "ü", Count: 1})
+	})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.Equal(t, int64(len(body)), res.ContentLength)
+	assert.JSONEq(t, `{"name":"ü","count":1,"tags":null}`, string(body))
+
+	// Test: Values that cannot be encoded write nothing
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	require.Error(t, Write(w, response.OK, func() {}))
+	assert.Empty(t, buf.String())
+}
+
+func TestProblem(t *testing.T) {
+	// Test: The title defaults to the reason phrase, extensions are added
+	res, body := record(t, func(w *response.Writer) error {
+		return WriteProblem(w, &Problem{
+			Status:     http.StatusForbidden,
+			Detail:     "Your balance is 30, but that costs 50.",
+			Instance:   "/account/12345/msgs/abc",
+			Extensions: map[string]any{"balance": 30, "status": "ignored"},
+		})
+	})
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+	assert.Equal(t, int64(len(body)), res.ContentLength)
+	assert.JSONEq(t, `{
+		"title": "Forbidden",
+		"status": 403,
+		"detail": "Your balance is 30, but that costs 50.",
+		"instance": "/account/12345/msgs/abc",
+		"balance": 30
+	}`, string(body))
+
+	// Test: A problem type keeps its own title
+	_, body = record(t, func(w *response.Writer) error {
+		return WriteProblem(w, &Problem{Type: "https://example.com/probs/out-of-credit", Status: http.StatusForbidden})
+	})
+	assert.JSONEq(t, `{"type":"https://example.com/probs/out-of-credit","status":403}`, string(body))
+
+	// Test: Handler errors become problems, other errors a plain 500
+	var v item
+	decodeErr := Decode(newRequest(t, "text/plain", "x"), &v, nil)
+	res, body = record(t, func(w *response.Writer) error {
+		return WriteError(w, fmt.Errorf("creating item: %w", decodeErr))
+	})
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+	var p Problem
+	require.NoError(t, json.Unmarshal(body, &p))
+	assert.Equal(t, Problem{Title: "Unsupported Media Type", Status: 415, Detail: "Content-Type must be application/json"}, p)
+
+	res, body = record(t, func(w *response.Writer) error {
+		return WriteError(w, errors.New("database password expired"))
+	})
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	assert.NotContains(t, string(body), "password")
+}
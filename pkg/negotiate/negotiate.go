@@ -0,0 +1,289 @@
+// Package negotiate implements proactive content negotiation as described in
+// RFC 9110 section 12. It selects the best representation offered by the server
+// based on the Accept, Accept-Language and Accept-Encoding request headers.
+package negotiate
+
+import (
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/response"
+	"strconv"
+	"strings"
+)
+
+// acceptRange is a single element of an Accept-style header, e.g.
+// "text/html;level=1;q=0.5".
+type acceptRange struct {
+	value  string
+	params map[string]string
+	q      float64
+}
+
+// ContentType returns the media type from offers that best matches the Accept
+// header of h. Offers are listed in order of server preference and may carry
+// parameters, e.g. "text/html;charset=utf-8".
+//
+// Ranges are matched by specificity ("text/html;level=1" over "text/html" over
+// "text/*" over "*/*"), and the q-value of the most specific matching range is
+// used as the quality of an offer. Ties are broken by the order of offers.
+//
+// If the request has no Accept header, the first offer is returned. An empty
+// string is returned if no offer is acceptable.
+func ContentType(h headers.Headers, offers []string) string {
+	header := h.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return first(offers)
+	}
+	ranges := parseHeader(header)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		typ, subtype, params, ok := parseMediaType(offer)
+		if !ok {
+			continue
+		}
+
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			rtyp, rsubtype, _, ok := parseMediaType(r.value)
+			if !ok {
+				continue
+			}
+			s := mediaSpecificity(rtyp, rsubtype, r.params, typ, subtype, params)
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// Language returns the language tag from offers that best matches the
+// Accept-Language header of h, using the basic filtering scheme of RFC 4647:
+// the range "en" matches both "en" and "en-US", and "*" matches any tag.
+//
+// If the request has no Accept-Language header, the first offer is returned.
+// An empty string is returned if no offer is acceptable.
+func Language(h headers.Headers, offers []string) string {
+	header := h.Get("Accept-Language")
+	if strings.TrimSpace(header) == "" {
+		return first(offers)
+	}
+	ranges := parseHeader(header)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		tag := strings.ToLower(offer)
+
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			s := -1
+			switch {
+			case r.value == "*":
+				s = 0
+			case r.value == tag || strings.HasPrefix(tag, r.value+"-"):
+				s = len(r.value)
+			}
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// Encoding returns the content coding from offers that best matches the
+// Accept-Encoding header of h. The "identity" coding is acceptable unless it
+// is explicitly excluded with "identity;q=0" or "*;q=0".
+//
+// If the request has no Accept-Encoding header, the first offer is returned.
+// An empty string is returned if no offer is acceptable.
+func Encoding(h headers.Headers, offers []string) string {
+	if _, ok := h["accept-encoding"]; !ok {
+		return first(offers)
+	}
+	ranges := parseHeader(h.Get("Accept-Encoding"))
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		coding := strings.ToLower(offer)
+
+		q, specificity := 0.0, -1
+		if coding == "identity" {
+			q = 1.0
+		}
+		for _, r := range ranges {
+			s := -1
+			switch r.value {
+			case coding:
+				s = 1
+			case "*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// NotAcceptable writes a complete 406 Not Acceptable response to w, listing
+// the available representations in a plain text body.
+func NotAcceptable(w *response.Writer, offers []string) error {
+	message := fmt.Sprintf("Not Acceptable\nAvailable representations: %s\n", strings.Join(offers, ", "))
+	return response.WriteError(w, response.NOT_ACCEPTABLE, message)
+}
+
+// first returns the first offer, or an empty string if there are none.
+func first(offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	return offers[0]
+}
+
+// parseHeader splits a comma-separated Accept-style header into its ranges.
+// Values and parameter names are lowercased. Elements with an invalid
+// q-value are ignored.
+func parseHeader(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, element := range splitQuoted(header, ',') {
+		parts := splitQuoted(element, ';')
+		value := strings.ToLower(strings.TrimSpace(parts[0]))
+		if value == "" {
+			continue
+		}
+
+		r := acceptRange{value: value, q: 1.0}
+		valid := true
+		for _, p := range parts[1:] {
+			name, val, _ := strings.Cut(p, "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			val = strings.Trim(strings.TrimSpace(val), `"`)
+			if name == "q" {
+				q, ok := parseQuality(val)
+				if !ok {
+					valid = false
+					break
+				}
+				r.q = q
+				// parameters after q are accept-ext, not media type parameters
+				break
+			}
+			if r.params == nil {
+				r.params = map[string]string{}
+			}
+			r.params[name] = val
+		}
+
+		if valid {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+// parseQuality parses a qvalue as defined in RFC 9110 section 12.4.2.
+// The grammar is exactly "0" [ "." 0*3DIGIT ] or "1" [ "." 0*3("0") ], so
+// other float syntax such as "1e0" or "0x1p0" is rejected.
+func parseQuality(s string) (float64, bool) {
+	if s == "" || len(s) > 5 || (s[0] != '0' && s[0] != '1') {
+		return 0, false
+	}
+	if len(s) > 1 {
+		if s[1] != '.' {
+			return 0, false
+		}
+		for _, c := range s[2:] {
+			if c < '0' || c > '9' || (s[0] == '1' && c != '0') {
+				return 0, false
+			}
+		}
+	}
+	q, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return q, true
+}
+
+// parseMediaType splits a media type into its lowercased type, subtype and
+// parameters.
+func parseMediaType(s string) (string, string, map[string]string, bool) {
+	parts := splitQuoted(s, ';')
+	typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(parts[0])), "/")
+	if !ok || typ == "" || subtype == "" {
+		return "", "", nil, false
+	}
+	if typ == "*" && subtype != "*" {
+		return "", "", nil, false
+	}
+
+	var params map[string]string
+	for _, p := range parts[1:] {
+		name, val, _ := strings.Cut(p, "=")
+		if params == nil {
+			params = map[string]string{}
+		}
+		params[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(val), `"`)
+	}
+	return typ, subtype, params, true
+}
+
+// mediaSpecificity reports how specifically a media range matches a media
+// type, or -1 if it does not match at all. Higher values are more specific.
+func mediaSpecificity(rtyp, rsubtype string, rparams map[string]string, typ, subtype string, params map[string]string) int {
+	switch {
+	case rtyp == "*":
+		return 0
+	case rtyp != typ:
+		return -1
+	case rsubtype == "*":
+		return 1
+	case rsubtype != subtype:
+		return -1
+	}
+
+	for k, v := range rparams {
+		if !strings.EqualFold(params[k], v) {
+			return -1
+		}
+	}
+	return 2 + len(rparams)
+}
+
+// splitQuoted splits s around sep, ignoring separators that appear inside
+// double-quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
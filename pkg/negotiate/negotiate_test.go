@@ -0,0 +1,116 @@
+package negotiate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentType(t *testing.T) {
+	offers := []string{"application/json", "text/html", "text/plain"}
+
+	// Test: No Accept header picks the first offer
+	h := headers.NewHeaders()
+	assert.Equal(t, "application/json", ContentType(h, offers))
+
+	// Test: Exact match
+	h = headers.Headers{"accept": "text/html"}
+	assert.Equal(t, "text/html", ContentType(h, offers))
+
+	// Test: q-values
+	h = headers.Headers{"accept": "application/json;q=0.5, text/plain;q=0.9, */*;q=0.1"}
+	assert.Equal(t, "text/plain", ContentType(h, offers))
+
+	// Test: More specific range overrides wildcard
+	h = headers.Headers{"accept": "text/*;q=0.8, text/html;q=0, */*;q=0.1"}
+	assert.Equal(t, "text/plain", ContentType(h, offers))
+
+	// Test: Ties are broken by server preference
+	h = headers.Headers{"accept": "text/plain, text/html"}
+	assert.Equal(t, "text/html", ContentType(h, offers))
+
+	// Test: Media type parameters
+	h = headers.Headers{"accept": "text/html;level=1, text/html;q=0.2, text/plain;q=0.5"}
+	assert.Equal(t, "text/html;level=1", ContentType(h, []string{"text/plain", "text/html;level=1"}))
+	assert.Equal(t, "text/plain", ContentType(h, []string{"text/plain", "text/html;level=2"}))
+
+	// Test: Nothing acceptable
+	h = headers.Headers{"accept": "image/png"}
+	assert.Equal(t, "", ContentType(h, offers))
+
+	// Test: Invalid q-value is ignored
+	h = headers.Headers{"accept": "text/html;q=2, text/plain"}
+	assert.Equal(t, "text/plain", ContentType(h, offers))
+}
+
+func TestParseQuality(t *testing.T) {
+	// Test: Values allowed by the qvalue grammar
+	for s, want := range map[string]float64{"0": 0, "0.": 0, "0.5": 0.5, "0.123": 0.123, "1": 1, "1.0": 1, "1.000": 1} {
+		q, ok := parseQuality(s)
+		assert.True(t, ok, s)
+		assert.Equal(t, want, q, s)
+	}
+
+	// Test: Other float syntax and out of range values are rejected
+	for _, s := range []string{"", "1e0", "0e1", "0x1p0", "1.5", "1.001", "0.1234", "2", ".5", "0,5", "01", "0.-1", "1.0e"} {
+		_, ok := parseQuality(s)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	offers := []string{"en-US", "fr", "de-DE"}
+
+	// Test: Prefix match
+	h := headers.Headers{"accept-language": "de, en;q=0.5"}
+	assert.Equal(t, "de-DE", Language(h, offers))
+
+	// Test: Longer range is more specific
+	h = headers.Headers{"accept-language": "en-us;q=0.1, en;q=0.9, fr;q=0.5"}
+	assert.Equal(t, "fr", Language(h, offers))
+
+	// Test: Wildcard
+	h = headers.Headers{"accept-language": "ja, *;q=0.1"}
+	assert.Equal(t, "en-US", Language(h, offers))
+
+	// Test: Nothing acceptable
+	h = headers.Headers{"accept-language": "ja"}
+	assert.Equal(t, "", Language(h, offers))
+}
+
+func TestEncoding(t *testing.T) {
+	offers := []string{"gzip", "deflate", "identity"}
+
+	// Test: No Accept-Encoding header
+	h := headers.NewHeaders()
+	assert.Equal(t, "gzip", Encoding(h, offers))
+
+	// Test: Empty Accept-Encoding header only allows identity
+	h = headers.Headers{"accept-encoding": ""}
+	assert.Equal(t, "identity", Encoding(h, offers))
+
+	// Test: q-values
+	h = headers.Headers{"accept-encoding": "gzip;q=0.5, deflate"}
+	assert.Equal(t, "deflate", Encoding(h, offers))
+
+	// Test: Identity excluded by wildcard
+	h = headers.Headers{"accept-encoding": "br, *;q=0"}
+	assert.Equal(t, "", Encoding(h, offers))
+
+	// Test: Identity excluded explicitly
+	h = headers.Headers{"accept-encoding": "identity;q=0"}
+	assert.Equal(t, "", Encoding(h, []string{"identity"}))
+}
+
+func TestNotAcceptable(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	err := NotAcceptable(w, []string{"application/json", "text/html"})
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "HTTP/1.1 406 Not Acceptable\r\n")
+	assert.Contains(t, buf.String(), "application/json, text/html")
+}
@@ -0,0 +1,46 @@
+package request
+
+import (
+	"bytes"
+	"testing"
+)
+
+var benchGET = []byte("GET /index.html HTTP/1.1\r\n" +
+	"Host: localhost:9000\r\n" +
+	"User-Agent: Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0\r\n" +
+	"Accept: text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8\r\n" +
+	"Accept-Language: en-US,en;q=0.5\r\n" +
+	"Accept-Encoding: gzip, deflate, br\r\n" +
+	"Connection: keep-alive\r\n" +
+	"Cache-Control: max-age=0\r\n" +
+	"\r\n")
+
+var benchPOST = []byte("POST /submit HTTP/1.1\r\n" +
+	"Host: localhost:9000\r\n" +
+	"User-Agent: curl/7.81.0\r\n" +
+	"Accept: */*\r\n" +
+	"Content-Type: application/json\r\n" +
+	"Content-Length: 27\r\n" +
+	"\r\n" +
+	`{"name":"gopher","age":13}` + "\n")
+
+func BenchmarkRequestFromReaderGET(b *testing.B) {
+	benchmarkRequestFromReader(b, benchGET)
+}
+
+func BenchmarkRequestFromReaderPOST(b *testing.B) {
+	benchmarkRequestFromReader(b, benchPOST)
+}
+
+func benchmarkRequestFromReader(b *testing.B, data []byte) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	reader := bytes.NewReader(data)
+	for b.Loop() {
+		reader.Reset(data)
+		_, err := RequestFromReader(reader)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package request
+
+import (
+	"errors"
+	"github.com/sp41414/goHttp/pkg/cookie"
+)
+
+// ErrNoCookie is returned by Cookie when the request has no cookie of the
+// given name.
+var ErrNoCookie = errors.New("Error: named cookie not present")
+
+// Cookies returns the cookies sent in the Cookie header of the request, in
+// order. The header may have been sent as several field lines, over HTTP/2
+// in particular, which are joined with "; " while parsing the request.
+func (r *Request) Cookies() []*cookie.Cookie {
+	return cookie.Parse(r.Headers.Get("Cookie"))
+}
+
+// Cookie returns the first cookie named name, or ErrNoCookie.
+func (r *Request) Cookie(name string) (*cookie.Cookie, error) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, ErrNoCookie
+}
@@ -0,0 +1,37 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookies(t *testing.T) {
+	req, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\nCookie: session=abc; theme=dark; session=old\r\n\r\n"))
+	require.NoError(t, err)
+
+	// Test: All cookies are returned in order
+	cookies := req.Cookies()
+	require.Len(t, cookies, 3)
+	assert.Equal(t, "theme", cookies[1].Name)
+	assert.Equal(t, "dark", cookies[1].Value)
+
+	// Test: The first cookie of a name is returned
+	c, err := req.Cookie("session")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", c.Value)
+
+	// Test: Missing cookies
+	_, err = req.Cookie("missing")
+	require.ErrorIs(t, err, ErrNoCookie)
+
+	// Test: Cookies of several field lines are all returned
+	req, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\nCookie: session=abc\r\nCookie: theme=dark\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "session=abc; theme=dark", req.Headers.Get("Cookie"))
+	c, err = req.Cookie("theme")
+	require.NoError(t, err)
+	assert.Equal(t, "dark", c.Value)
+}
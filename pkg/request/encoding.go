@@ -0,0 +1,125 @@
+package request
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxDecodedBodySize is the default Options.MaxDecodedBodySize.
+const DefaultMaxDecodedBodySize = 10 << 20
+
+// ErrDecodedBodyTooLarge is returned when a compressed body inflates beyond
+// the allowed size, as a zip bomb would.
+var ErrDecodedBodyTooLarge = errors.New("Error: decoded request body is too large")
+
+// UnsupportedEncodingError is returned for a body with a content coding that
+// cannot be decoded. Servers answer it with 415 Unsupported Media Type.
+type UnsupportedEncodingError struct {
+	Coding string
+}
+
+func (e *UnsupportedEncodingError) Error() string {
+	return fmt.Sprintf("Error: unsupported Content-Encoding %q", e.Coding)
+}
+
+// DecodeError is returned for a body that is not valid data of its content
+// coding, e.g. truncated or corrupt gzip. Servers answer it with 400 Bad
+// Request.
+type DecodeError struct {
+	Coding string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Error: could not decode %s body (%v)", e.Coding, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeBody decodes a body compressed with the codings listed in its
+// Content-Encoding header: gzip (or x-gzip), deflate and identity. Codings
+// are removed in the reverse order they were applied.
+//
+// Afterwards Body holds the decoded body and RawBody the body as received.
+// The Content-Encoding header is removed and Content-Length, if present,
+// updated to the decoded length, so the request reads like it was sent
+// uncompressed. A body decoding to more than limit bytes fails with
+// ErrDecodedBodyTooLarge; a limit of zero or less means
+// DefaultMaxDecodedBodySize.
+func (r *Request) DecodeBody(limit int64) error {
+	value := strings.TrimSpace(r.Headers.Get("Content-Encoding"))
+	if value == "" {
+		return nil
+	}
+	if limit <= 0 {
+		limit = DefaultMaxDecodedBodySize
+	}
+
+	var codings []string
+	for _, coding := range strings.Split(value, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		switch coding {
+		case "identity":
+		case "gzip", "x-gzip", "deflate":
+			codings = append(codings, coding)
+		default:
+			return &UnsupportedEncodingError{Coding: coding}
+		}
+	}
+
+	body := r.Body
+	for i := len(codings) - 1; i >= 0 && len(body) > 0; i-- {
+		var err error
+		body, err = decode(codings[i], body, limit)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.RawBody = r.Body
+	r.Body = body
+	delete(r.Headers, "content-encoding")
+	if _, ok := r.Headers["content-length"]; ok {
+		r.Headers["content-length"] = strconv.Itoa(len(body))
+	}
+	return nil
+}
+
+// decode removes a single content coding from body.
+func decode(coding string, body []byte, limit int64) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch coding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		// deflate is the zlib format (RFC 9110 section 8.4.1.2), but some
+		// clients send raw deflate data
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			reader, err = flate.NewReader(bytes.NewReader(body)), nil
+		}
+	}
+	if err != nil {
+		return nil, &DecodeError{Coding: coding, Err: err}
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, &DecodeError{Coding: coding, Err: err}
+	}
+	if int64(len(decoded)) > limit {
+		return nil, ErrDecodedBodyTooLarge
+	}
+	return decoded, nil
+}
@@ -0,0 +1,100 @@
+package request
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// encodedRequest builds a POST request with body and the Content-Encoding
+// header.
+func encodedRequest(coding string, body []byte) string {
+	return fmt.Sprintf("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Encoding: %s\r\nContent-Length: %d\r\n\r\n%s", coding, len(body), body)
+}
+
+func TestDecodeBody(t *testing.T) {
+	opts := Options{DecodeBody: true}
+
+	// Test: A gzip body is decoded, and the raw body kept
+	raw := gzipped(t, []byte("hello world"))
+	reader := &chunkReader{
+		data:            encodedRequest("gzip", raw),
+		numBytesPerRead: 5,
+	}
+	r, err := RequestFromReaderWithOptions(reader, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(r.Body))
+	assert.Equal(t, raw, r.RawBody)
+	assert.Equal(t, "", r.Headers.Get("Content-Encoding"))
+	assert.Equal(t, "11", r.Headers.Get("Content-Length"))
+
+	// Test: deflate accepts the zlib format and raw deflate data
+	var zbuf, fbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write([]byte("zlib data"))
+	zw.Close()
+	fw, _ := flate.NewWriter(&fbuf, flate.BestSpeed)
+	fw.Write([]byte("raw deflate data"))
+	fw.Close()
+	r, err = RequestFromReaderWithOptions(strings.NewReader(encodedRequest("deflate", zbuf.Bytes())), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "zlib data", string(r.Body))
+	r, err = RequestFromReaderWithOptions(strings.NewReader(encodedRequest("Deflate", fbuf.Bytes())), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "raw deflate data", string(r.Body))
+
+	// Test: Several codings are removed in reverse order
+	r, err = RequestFromReaderWithOptions(strings.NewReader(encodedRequest("gzip, identity, x-gzip", gzipped(t, gzipped(t, []byte("twice"))))), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "twice", string(r.Body))
+
+	// Test: Unknown codings are reported
+	_, err = RequestFromReaderWithOptions(strings.NewReader(encodedRequest("br", []byte("data"))), opts)
+	var unsupported *UnsupportedEncodingError
+	require.ErrorAs(t, err, &unsupported)
+	assert.Equal(t, "br", unsupported.Coding)
+
+	// Test: Bodies inflating beyond the limit are rejected
+	bomb := gzipped(t, make([]byte, 1<<20))
+	_, err = RequestFromReaderWithOptions(strings.NewReader(encodedRequest("gzip", bomb)), Options{DecodeBody: true, MaxDecodedBodySize: 1 << 10})
+	require.ErrorIs(t, err, ErrDecodedBodyTooLarge)
+
+	// Test: Corrupt data fails with a DecodeError
+	_, err = RequestFromReaderWithOptions(strings.NewReader(encodedRequest("gzip", []byte("not gzip"))), opts)
+	var invalid *DecodeError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "gzip", invalid.Coding)
+
+	// Test: Without the option the body is left alone
+	r, err = RequestFromReader(strings.NewReader(encodedRequest("gzip", raw)))
+	require.NoError(t, err)
+	assert.Equal(t, raw, r.Body)
+	assert.Nil(t, r.RawBody)
+	assert.Equal(t, "gzip", r.Headers.Get("Content-Encoding"))
+
+	// Test: A deferred body is decoded by ReadBody
+	deferred := strings.Replace(encodedRequest("gzip", raw), "Host: localhost\r\n", "Host: localhost\r\nExpect: 100-continue\r\n", 1)
+	r, err = RequestFromReaderWithOptions(strings.NewReader(deferred), Options{DecodeBody: true, DeferExpectedBody: true})
+	require.NoError(t, err)
+	assert.Empty(t, r.Body)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+}
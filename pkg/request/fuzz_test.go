@@ -0,0 +1,68 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// patternReader generalizes chunkReader: instead of a fixed read size, it
+// cycles through the read sizes in pattern, so the fuzzer controls exactly
+// how the input is split across reads.
+type patternReader struct {
+	data    []byte
+	pattern []byte
+	pos     int
+	reads   int
+}
+
+func (pr *patternReader) Read(p []byte) (int, error) {
+	if pr.pos >= len(pr.data) {
+		return 0, io.EOF
+	}
+	size := 1
+	if len(pr.pattern) > 0 {
+		size = max(int(pr.pattern[pr.reads%len(pr.pattern)]), 1)
+	}
+	pr.reads++
+	end := min(pr.pos+size, len(pr.data))
+	n := copy(p, pr.data[pr.pos:end])
+	pr.pos += n
+	return n, nil
+}
+
+func FuzzRequestFromReader(f *testing.F) {
+	f.Add([]byte("GET / HTTP/1.1\r\nHost: localhost:9000\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n"), []byte{3})
+	f.Add([]byte("POST /submit HTTP/1.1\r\nHost: localhost:9000\r\nContent-Length: 13\r\n\r\nhello world!\n"), []byte{1, 7})
+	f.Add([]byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;a=b\r\nhello\r\n0\r\nX-Sum: 1\r\n\r\n"), []byte{2, 5, 11})
+	f.Add([]byte("POST / HTTP/1.1\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"), []byte{4})
+
+	f.Fuzz(func(t *testing.T, data []byte, pattern []byte) {
+		whole, wholeErr := RequestFromReader(bytes.NewReader(data))
+		split, splitErr := RequestFromReader(&patternReader{data: data, pattern: pattern})
+
+		// the result must not depend on how the input was split across reads
+		if wholeErr != nil {
+			require.Error(t, splitErr)
+			return
+		}
+		require.NoError(t, splitErr)
+		assert.Equal(t, whole.RequestLine, split.RequestLine)
+		assert.Equal(t, whole.Headers, split.Headers)
+		assert.Equal(t, whole.Body, split.Body)
+		assert.Equal(t, whole.Trailers, split.Trailers)
+
+		// everything parsed must have come from the input
+		size := len(whole.Body)
+		for k, v := range whole.Headers {
+			size += len(k) + len(v)
+		}
+		for k, v := range whole.Trailers {
+			size += len(k) + len(v)
+		}
+		assert.LessOrEqual(t, size, len(data))
+	})
+}
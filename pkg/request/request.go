@@ -1,16 +1,24 @@
 // Package request provides a streaming parser for HTTP/1.1 requests.
 // It handles the transition from the initial request line through headers
 // and into the message body.
+//
+// Message framing is validated strictly to prevent request smuggling:
+// conflicting or malformed Content-Length values, Transfer-Encoding values
+// other than "chunked", requests carrying both, bare LF line endings and
+// invalid chunk sizes are all rejected.
 package request
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"github.com/sp41414/goHttp/pkg/chunked"
 	"github.com/sp41414/goHttp/pkg/headers"
 	"io"
 	"strconv"
 	"strings"
-	"unicode"
+	"sync"
 )
 
 // parserState represents the current phase of the HTTP request parsing process.
@@ -21,6 +29,7 @@ const (
 	StateInit parserState = iota
 	requestStateParsingHeaders
 	requestStateParsingBody
+	requestStateParsingChunkedBody
 	// StateDone indicates the request has been fully parsed, including the body.
 	StateDone
 )
@@ -30,8 +39,93 @@ type Request struct {
 	RequestLine RequestLine
 	Headers     headers.Headers
 	Body        []byte
+	// RawBody holds the body as received when it was decoded, see
+	// DecodeBody. It is nil otherwise.
+	RawBody []byte
+	// Trailers holds the trailer fields of a chunked request body, if any.
+	Trailers headers.Headers
 	// state tracks the internal progress of the parser.
 	state parserState
+	// contentLength is the validated length of a Content-Length delimited body.
+	contentLength int64
+	// decoder decodes the body when Transfer-Encoding is chunked.
+	decoder *chunked.Decoder
+	// opts holds the parser configuration the request was read with.
+	opts Options
+	// headerSize counts the bytes of the request line and header section
+	// consumed so far.
+	headerSize int
+	// unread holds data read past the end of the request, or past the
+	// header section while the body is deferred.
+	unread []byte
+	// deferBody is set while the body of an Expect: 100-continue request is
+	// left for ReadBody, which reads it from source.
+	deferBody bool
+	source    io.Reader
+	// maxBodySize limits the body while ReadBodyLimit reads it, if positive.
+	maxBodySize int64
+}
+
+// Options configures the behavior of RequestFromReaderWithOptions.
+// The zero value is the configuration used by RequestFromReader.
+type Options struct {
+	// HeaderMode selects how obsolete line folding in the header section is
+	// handled. Defaults to headers.Strict.
+	HeaderMode headers.ParseMode
+	// DeferExpectedBody returns a request carrying "Expect: 100-continue" as
+	// soon as its header section is parsed. Its Body stays empty until
+	// ReadBody is called, so the server can decide whether the client
+	// should send it at all.
+	DeferExpectedBody bool
+	// DecodeBody decodes a body with a Content-Encoding once it is read,
+	// see Request.DecodeBody. Parsing fails with an
+	// *UnsupportedEncodingError for codings other than gzip and deflate.
+	DecodeBody bool
+	// MaxDecodedBodySize limits the size of a decoded body. Defaults to
+	// DefaultMaxDecodedBodySize.
+	MaxDecodedBodySize int64
+	// MaxLineLength limits the length of the request line and of each
+	// header field line, without CRLF. A field folded over several lines
+	// counts as one line. Defaults to DefaultMaxLineLength.
+	MaxLineLength int
+	// MaxHeaderSize limits the size of the request line and header section
+	// together. Defaults to DefaultMaxHeaderSize.
+	MaxHeaderSize int
+}
+
+// DefaultMaxLineLength is the default Options.MaxLineLength.
+const DefaultMaxLineLength = 8 << 10
+
+// DefaultMaxHeaderSize is the default Options.MaxHeaderSize.
+const DefaultMaxHeaderSize = 64 << 10
+
+// ErrLineTooLong is returned for a request line or header field line longer
+// than Options.MaxLineLength. The parser stops reading as soon as it is
+// exceeded, so an endless line cannot grow its buffer without bound.
+var ErrLineTooLong = errors.New("line too long")
+
+// ErrHeaderTooLarge is returned for a header section larger than
+// Options.MaxHeaderSize.
+var ErrHeaderTooLarge = errors.New("header section too large")
+
+// ErrBodyTooLarge is returned by ReadBodyLimit for a body larger than its
+// limit.
+var ErrBodyTooLarge = errors.New("body too large")
+
+// ParseError is returned for a request that is not valid HTTP/1.1, such as a
+// malformed request line or header, or invalid body framing. Servers answer
+// it with 400 Bad Request, or 431 Request Header Fields Too Large if Err is
+// ErrLineTooLong or ErrHeaderTooLarge.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Error: could not parse request (%v)", e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
 }
 
 // RequestLine contains the metadata parsed from the first line of an HTTP request.
@@ -41,6 +135,19 @@ type RequestLine struct {
 	Method        string // e.g., "GET"
 }
 
+// bufPool holds read buffers for RequestFromReader, so that parsing a request
+// does not allocate a new buffer every time.
+var bufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 4096)
+		return &buf
+	},
+}
+
+// maxPooledBufferSize is the largest buffer returned to bufPool. Buffers that
+// grew beyond it for an unusually large request are left to the GC.
+const maxPooledBufferSize = 64 << 10
+
 // RequestFromReader reads from an io.Reader and returns a fully parsed Request.
 // It manages the internal buffer and continues reading until the request is
 // complete or an error occurs.
@@ -48,58 +155,240 @@ type RequestLine struct {
 // If a Content-Length header is present, it ensures the body matches that length
 // before returning successfully.
 func RequestFromReader(reader io.Reader) (*Request, error) {
+	return RequestFromReaderWithOptions(reader, Options{})
+}
+
+// RequestFromReaderWithOptions is like RequestFromReader but parses the
+// request according to opts.
+func RequestFromReaderWithOptions(reader io.Reader, opts Options) (*Request, error) {
+	if opts.MaxLineLength <= 0 {
+		opts.MaxLineLength = DefaultMaxLineLength
+	}
+	if opts.MaxHeaderSize <= 0 {
+		opts.MaxHeaderSize = DefaultMaxHeaderSize
+	}
 	request := &Request{
 		state: StateInit,
+		opts:  opts,
+	}
+	if err := request.readFrom(reader); err != nil {
+		return nil, err
+	}
+	if err := request.decode(); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// ReadBody reads the body of a request returned with a deferred body, see
+// Options.DeferExpectedBody, and returns it. For any other request it
+// returns Body.
+func (r *Request) ReadBody() ([]byte, error) {
+	if !r.deferBody {
+		return r.Body, nil
 	}
 
-	buf := make([]byte, 8)
-	readToIndex := 0
-	for {
-		if request.state == StateDone {
-			break
-		}
-		if readToIndex >= len(buf) {
-			dt := make([]byte, len(buf)*2)
-			copy(dt, buf)
-			buf = dt
+	reader := r.source
+	if len(r.unread) > 0 {
+		reader = io.MultiReader(bytes.NewReader(r.unread), reader)
+	}
+	r.deferBody, r.source, r.unread = false, nil, nil
+	if err := r.readFrom(reader); err != nil {
+		return nil, err
+	}
+	if err := r.decode(); err != nil {
+		return nil, err
+	}
+	return r.Body, nil
+}
+
+// ReadBodyLimit is like ReadBody, but fails with ErrBodyTooLarge for a body
+// larger than limit bytes. A deferred body is read only until it exceeds
+// limit, and not at all if its Content-Length does, so an oversized body
+// costs no more memory than the limit. A decoded body must fit in limit
+// too.
+func (r *Request) ReadBodyLimit(limit int64) ([]byte, error) {
+	if r.deferBody {
+		if r.state == requestStateParsingBody && r.contentLength > limit {
+			return nil, ErrBodyTooLarge
 		}
+		r.maxBodySize = limit
+		defer func() { r.maxBodySize = 0 }()
+	}
+	body, err := r.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
+}
 
-		n, err := reader.Read(buf[readToIndex:])
+// BodyReader returns a reader for the body. The body of a request returned
+// with a deferred body, see Options.DeferExpectedBody, is streamed from its
+// source as it is read instead of being collected into Body, so a large
+// upload can be processed without holding it in memory. Trailers holds the
+// trailer fields of a chunked body once it has been read to the end, and
+// Unread the data read past it.
+//
+// A deferred body that Options.DecodeBody must decode is read whole with
+// ReadBody instead, as is the body of any other request.
+func (r *Request) BodyReader() (io.Reader, error) {
+	if !r.deferBody || (r.opts.DecodeBody && r.Headers.Get("Content-Encoding") != "") {
+		body, err := r.ReadBody()
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, fmt.Errorf("Error: could not read request (%v)", err)
+			return nil, err
 		}
+		return bytes.NewReader(body), nil
+	}
 
-		readToIndex += n
+	source := r.source
+	if len(r.unread) > 0 {
+		source = io.MultiReader(bytes.NewReader(r.unread), source)
+	}
+	state := r.state
+	r.deferBody, r.source, r.unread = false, nil, nil
+	r.state = StateDone
 
-		read, err := request.parse(buf[:readToIndex])
-		if err != nil {
-			return nil, fmt.Errorf("Error: could not parse request (%v)", err)
+	if state == requestStateParsingChunkedBody {
+		// the decoder has not consumed anything yet, since the body was
+		// deferred as soon as the header section was parsed
+		r.Trailers = headers.NewHeaders()
+		src := bufio.NewReader(source)
+		return &streamedChunks{r: r, src: src, body: chunked.NewReader(src, r.Trailers)}, nil
+	}
+	return &streamedLength{r: source, remaining: r.contentLength}, nil
+}
+
+// streamedLength streams a deferred body of a known length.
+type streamedLength struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *streamedLength) Read(p []byte) (int, error) {
+	if l.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if err == io.EOF {
+		if l.remaining > 0 {
+			return n, io.ErrUnexpectedEOF
 		}
+		err = nil
+	}
+	return n, err
+}
+
+// streamedChunks streams a deferred chunked body, keeping the data buffered
+// past its end in the Unread data of the request.
+type streamedChunks struct {
+	r    *Request
+	src  *bufio.Reader
+	body *chunked.Reader
+}
 
-		copy(buf, buf[read:readToIndex])
-		readToIndex -= read
+func (c *streamedChunks) Read(p []byte) (int, error) {
+	n, err := c.body.Read(p)
+	if err == io.EOF && c.src.Buffered() > 0 && c.r.unread == nil {
+		rest, _ := c.src.Peek(c.src.Buffered())
+		c.r.unread = bytes.Clone(rest)
 	}
+	return n, err
+}
 
-	if request.state == StateInit {
-		return nil, fmt.Errorf("Error: found EOF before end of request line")
+// decode decodes the body if it is complete and Options.DecodeBody is set.
+func (r *Request) decode() error {
+	if !r.opts.DecodeBody || r.deferBody {
+		return nil
 	}
+	return r.DecodeBody(r.opts.MaxDecodedBodySize)
+}
 
-	contentLengthHeaders := request.Headers.Get("Content-Length")
-	if contentLengthHeaders != "" {
-		clh, err := strconv.Atoi(contentLengthHeaders)
-		if err != nil {
-			return nil, fmt.Errorf("Error: could not parse Content-Length")
+// ExpectsContinue reports whether the client sent "Expect: 100-continue" and
+// is waiting for an interim 100 Continue response before sending the body.
+func (r *Request) ExpectsContinue() bool {
+	return strings.EqualFold(strings.TrimSpace(r.Headers.Get("Expect")), "100-continue")
+}
+
+// readFrom parses the request from reader until it is complete, or until
+// its body is deferred.
+func (r *Request) readFrom(reader io.Reader) error {
+	bufp := bufPool.Get().(*[]byte)
+	buf := *bufp
+	defer func() {
+		if len(buf) <= maxPooledBufferSize {
+			*bufp = buf
+			bufPool.Put(bufp)
+		}
+	}()
+
+	// buf[start:end] holds data that has been read but not yet consumed
+	start, end := 0, 0
+	for r.state != StateDone && !r.deferBody {
+		if end == len(buf) {
+			if start > 0 {
+				end = copy(buf, buf[start:end])
+				start = 0
+			} else {
+				dt := make([]byte, len(buf)*2)
+				copy(dt, buf)
+				buf = dt
+			}
+		}
+
+		n, readErr := reader.Read(buf[end:])
+		end += n
+
+		if n > 0 {
+			read, err := r.parse(buf[start:end])
+			if err != nil {
+				return &ParseError{Err: err}
+			}
+			start += read
+			if start == end {
+				start, end = 0, 0
+			}
 		}
-		cl := len(request.Body)
-		if clh != cl {
-			return nil, fmt.Errorf("Error: found EOF before length body %d is the same as Content-Length %d\n", cl, clh)
+
+		if readErr != nil {
+			if readErr == io.EOF {
+				break
+			}
+			return fmt.Errorf("Error: could not read request (%v)", readErr)
 		}
 	}
 
-	return request, nil
+	switch {
+	case r.deferBody:
+		r.source = reader
+	case r.state == StateInit:
+		return fmt.Errorf("Error: found EOF before end of request line")
+	case r.state == requestStateParsingHeaders:
+		return fmt.Errorf("Error: found EOF before end of headers")
+	case r.state == requestStateParsingBody:
+		return fmt.Errorf("Error: found EOF before length body %d is the same as Content-Length %d", len(r.Body), r.contentLength)
+	case r.state == requestStateParsingChunkedBody:
+		return fmt.Errorf("Error: found EOF before end of chunked body")
+	}
+
+	if start < end {
+		r.unread = bytes.Clone(buf[start:end])
+	}
+	return nil
+}
+
+// Unread returns the data read from the reader past the end of the request,
+// such as the start of a pipelined request or of another protocol after an
+// upgrade. It is nil if the request ended exactly where reading stopped.
+// While the body is deferred, it holds the part of the body already read.
+func (r *Request) Unread() []byte {
+	return r.unread
 }
 
 // parse processes a slice of bytes and updates the request state.
@@ -114,10 +403,13 @@ func (r *Request) parse(data []byte) (int, error) {
 			if err != nil {
 				return 0, err
 			}
+			if err := r.checkHeaderSize(n, len(data)-consumed); err != nil {
+				return 0, err
+			}
 			if n == 0 {
 				return 0, nil
 			}
-			r.RequestLine = *rl
+			r.RequestLine = rl
 			consumed += n
 			r.state = requestStateParsingHeaders
 		case requestStateParsingHeaders:
@@ -125,33 +417,48 @@ func (r *Request) parse(data []byte) (int, error) {
 				h := headers.NewHeaders()
 				r.Headers = h
 			}
-			n, done, err := r.Headers.Parse(data[consumed:])
+			n, done, err := r.Headers.ParseWithMode(data[consumed:], r.opts.HeaderMode)
 			if err != nil {
 				return consumed, err
 			}
+			if err := r.checkHeaderSize(n, len(data)-consumed); err != nil {
+				return consumed, err
+			}
 			if !done && n == 0 {
 				return consumed, nil
 			}
 			consumed += n
 			if done {
-				r.state = requestStateParsingBody
+				state, err := r.bodyState()
+				if err != nil {
+					return consumed, err
+				}
+				r.state = state
+				if state != StateDone && r.opts.DeferExpectedBody && r.ExpectsContinue() {
+					r.deferBody = true
+					return consumed, nil
+				}
 			}
 		case requestStateParsingBody:
-			clHeader := r.Headers.Get("Content-Length")
-			if clHeader == "" {
+			n := min(int64(len(data[consumed:])), r.contentLength-int64(len(r.Body)))
+			r.Body = append(r.Body, data[consumed:consumed+int(n)]...)
+			consumed += int(n)
+			if int64(len(r.Body)) == r.contentLength {
 				r.state = StateDone
-				return consumed, nil
 			}
-
-			contentLength, err := strconv.Atoi(clHeader)
+			return consumed, nil
+		case requestStateParsingChunkedBody:
+			body, n, err := r.decoder.Decode(r.Body, data[consumed:])
+			r.Body = body
 			if err != nil {
-				return consumed, fmt.Errorf("invalid body: content-length is not a number (%v)", err)
+				return consumed, fmt.Errorf("invalid body: %v", err)
+			}
+			if r.maxBodySize > 0 && int64(len(r.Body)) > r.maxBodySize {
+				return consumed, ErrBodyTooLarge
 			}
-
-			n := len(data[consumed:])
-			r.Body = append(r.Body, data[consumed:consumed+n]...)
 			consumed += n
-			if contentLength == len(r.Body) {
+			if r.decoder.Done() {
+				r.Trailers = r.decoder.Trailers
 				r.state = StateDone
 			}
 			return consumed, nil
@@ -161,45 +468,177 @@ func (r *Request) parse(data []byte) (int, error) {
 	}
 }
 
+// checkHeaderSize accounts for a line of n bytes consumed from the request
+// line or header section, or for pending bytes without a complete line if n
+// is 0, and returns an error once they exceed the configured limits.
+func (r *Request) checkHeaderSize(n, pending int) error {
+	if n == 0 {
+		if pending > r.opts.MaxLineLength+len("\r\n") {
+			return ErrLineTooLong
+		}
+		if r.headerSize+pending > r.opts.MaxHeaderSize {
+			return ErrHeaderTooLarge
+		}
+		return nil
+	}
+	if n > r.opts.MaxLineLength+len("\r\n") {
+		return ErrLineTooLong
+	}
+	r.headerSize += n
+	if r.headerSize > r.opts.MaxHeaderSize {
+		return ErrHeaderTooLarge
+	}
+	return nil
+}
+
+// bodyState validates the message framing headers once the header section is
+// complete and returns the state that parses the body they describe.
+//
+// Following RFC 9112 section 6, a request with both Transfer-Encoding and
+// Content-Length is rejected rather than guessing which one an intermediary
+// used, since that disagreement is the basis of CL.TE and TE.CL smuggling.
+func (r *Request) bodyState() (parserState, error) {
+	te, hasTE := r.Headers["transfer-encoding"]
+	cl, hasCL := r.Headers["content-length"]
+
+	switch {
+	case hasTE && hasCL:
+		return 0, fmt.Errorf("invalid framing: both Transfer-Encoding and Content-Length are present")
+	case hasTE:
+		if !strings.EqualFold(strings.TrimSpace(te), "chunked") {
+			return 0, fmt.Errorf("invalid framing: unsupported Transfer-Encoding %q", te)
+		}
+		r.decoder = chunked.NewDecoder()
+		return requestStateParsingChunkedBody, nil
+	case hasCL:
+		n, err := parseContentLength(cl)
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return StateDone, nil
+		}
+		r.contentLength = n
+		r.Body = make([]byte, 0, min(n, maxPooledBufferSize))
+		return requestStateParsingBody, nil
+	default:
+		return StateDone, nil
+	}
+}
+
+// parseContentLength parses a Content-Length field value. Repeated fields
+// are merged into a comma-separated list by the header parser, which is only
+// accepted if every member is the same valid length.
+//
+// Each length must be plain decimal digits: signs, whitespace inside the
+// number and leading zeros are rejected, since recipients disagree on how
+// to interpret them.
+func parseContentLength(value string) (int64, error) {
+	var length int64 = -1
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return 0, fmt.Errorf("invalid framing: empty Content-Length")
+		}
+		if len(part) > 1 && part[0] == '0' {
+			return 0, fmt.Errorf("invalid framing: Content-Length %q has leading zeros", part)
+		}
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, fmt.Errorf("invalid framing: Content-Length %q is not a number", part)
+			}
+		}
+
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid framing: Content-Length %q is out of range", part)
+		}
+		if length != -1 && n != length {
+			return 0, fmt.Errorf("invalid framing: conflicting Content-Length values %q", value)
+		}
+		length = n
+	}
+	return length, nil
+}
+
 // parseRequestLine extracts the Method, RequestTarget, and HttpVersion from the
 // first line of a request. It expects the line to end with \r\n.
-func parseRequestLine(data []byte) (*RequestLine, int, error) {
+func parseRequestLine(data []byte) (RequestLine, int, error) {
+	if lf := bytes.IndexByte(data, '\n'); lf == 0 || lf > 0 && data[lf-1] != '\r' {
+		return RequestLine{}, 0, fmt.Errorf("invalid request line, line must end with CRLF, found bare LF")
+	}
+
 	idx := bytes.Index(data, []byte("\r\n"))
 	if idx == -1 {
-		return nil, 0, nil
+		return RequestLine{}, 0, nil
 	}
 	read := idx + len("\r\n")
+	line := data[:idx]
 
-	splitRequestLine := bytes.Split(data[:idx], []byte(" "))
-
-	if len(splitRequestLine) != 3 {
-		return nil, 0, fmt.Errorf("invalid request line, request line must be in Method RequestTarget HttpVersion format")
+	for _, c := range line {
+		if c < ' ' || c == 0x7f {
+			return RequestLine{}, 0, fmt.Errorf("invalid request line, must not contain control characters")
+		}
 	}
 
-	method, requestTarget, httpVersion := string(splitRequestLine[0]), string(splitRequestLine[1]), string(splitRequestLine[2])
-
-	if strings.ToUpper(method) != method {
-		return nil, 0, fmt.Errorf("invalid request line, method name must be in full capital letters")
+	sp1 := bytes.IndexByte(line, ' ')
+	sp2 := -1
+	if sp1 != -1 {
+		sp2 = bytes.IndexByte(line[sp1+1:], ' ')
 	}
-	for _, l := range method {
-		if !unicode.IsLetter(l) {
-			return nil, 0, fmt.Errorf("invalid request line, method name must be alphabetical")
-		}
+	if sp2 == -1 {
+		return RequestLine{}, 0, fmt.Errorf("invalid request line, request line must be in Method RequestTarget HttpVersion format")
+	}
+	sp2 += sp1 + 1
+
+	method, requestTarget, httpVersion := line[:sp1], line[sp1+1:sp2], line[sp2+1:]
+	if len(method) == 0 || len(requestTarget) == 0 || bytes.IndexByte(httpVersion, ' ') != -1 {
+		return RequestLine{}, 0, fmt.Errorf("invalid request line, request line must be in Method RequestTarget HttpVersion format")
 	}
 
-	versionParts := strings.Split(httpVersion, "/")
-	if len(versionParts) != 2 || versionParts[0] != "HTTP" {
-		return nil, 0, fmt.Errorf("invalid request line, please ensure http version is HTTP/1.1")
+	for _, c := range method {
+		if 'a' <= c && c <= 'z' {
+			return RequestLine{}, 0, fmt.Errorf("invalid request line, method name must be in full capital letters")
+		}
+		if c < 'A' || c > 'Z' {
+			return RequestLine{}, 0, fmt.Errorf("invalid request line, method name must be alphabetical")
+		}
 	}
 
-	version := versionParts[1]
-	if version != "1.1" {
-		return nil, 0, fmt.Errorf("invalid request line, please ensure http version is HTTP/1.1")
+	if string(httpVersion) != "HTTP/1.1" {
+		return RequestLine{}, 0, fmt.Errorf("invalid request line, please ensure http version is HTTP/1.1")
 	}
 
-	return &RequestLine{
-		Method:        method,
-		RequestTarget: requestTarget,
-		HttpVersion:   version,
+	return RequestLine{
+		Method:        internMethod(method),
+		RequestTarget: string(requestTarget),
+		HttpVersion:   "1.1",
 	}, read, nil
 }
+
+// internMethod returns method as a string, without allocating for the
+// methods defined in RFC 9110.
+func internMethod(method []byte) string {
+	switch string(method) {
+	case "GET":
+		return "GET"
+	case "HEAD":
+		return "HEAD"
+	case "POST":
+		return "POST"
+	case "PUT":
+		return "PUT"
+	case "DELETE":
+		return "DELETE"
+	case "CONNECT":
+		return "CONNECT"
+	case "OPTIONS":
+		return "OPTIONS"
+	case "TRACE":
+		return "TRACE"
+	case "PATCH":
+		return "PATCH"
+	default:
+		return string(method)
+	}
+}
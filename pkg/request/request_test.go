@@ -1,11 +1,14 @@
 package request
 
 import (
+	"errors"
 	"io"
 	"testing"
+	"testing/iotest"
 
 	"strings"
 
+	"github.com/sp41414/goHttp/pkg/headers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -66,6 +69,32 @@ func TestHeadersParse(t *testing.T) {
 	}
 	r, err = RequestFromReader(reader)
 	require.Error(t, err)
+
+	// Test: Whitespace between the request line and the first header
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\n Host: localhost:9000\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Folded header is rejected by default
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:9000\r\nX-Folded: a\r\n\tb\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Folded header is unfolded in lenient mode
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:9000\r\nX-Folded: a\r\n\tb\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReaderWithOptions(reader, Options{HeaderMode: headers.Lenient})
+	require.NoError(t, err)
+	assert.Equal(t, "a b", r.Headers.Get("X-Folded"))
+	assert.Equal(t, "localhost:9000", r.Headers.Get("Host"))
 }
 
 func TestBodyParse(t *testing.T) {
@@ -106,3 +135,202 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 
 	return n, nil
 }
+
+func TestUnread(t *testing.T) {
+	// Test: Data after the body is kept
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\n\r\nbodyGET /next HTTP/1.1\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "body", string(r.Body))
+	assert.Equal(t, "GET /next HTTP/1.1\r\n", string(r.Unread()))
+
+	// Test: Nothing is left when reading stops at the end of the request
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Nil(t, r.Unread())
+}
+
+func TestDeferredBody(t *testing.T) {
+	opts := Options{DeferExpectedBody: true}
+
+	// Test: The body of a request expecting 100-continue is read on demand
+	reader := &chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 11\r\n\r\nhello world",
+		numBytesPerRead: 7,
+	}
+	r, err := RequestFromReaderWithOptions(reader, opts)
+	require.NoError(t, err)
+	assert.True(t, r.ExpectsContinue())
+	assert.Empty(t, r.Body)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+	assert.Equal(t, "hello world", string(r.Body))
+
+	// Test: Chunked bodies are deferred too
+	r, err = RequestFromReaderWithOptions(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-Continue\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"), opts)
+	require.NoError(t, err)
+	assert.Empty(t, r.Body)
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: Requests without the expectation are read completely
+	r, err = RequestFromReaderWithOptions(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello"), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	body, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: A truncated deferred body fails when read
+	r, err = RequestFromReaderWithOptions(strings.NewReader("POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\nhel"), opts)
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.Error(t, err)
+}
+
+// endlessReader yields prefix followed by an endless repetition of fill,
+// counting the bytes read, like a client that never ends its line.
+type endlessReader struct {
+	prefix string
+	fill   byte
+	read   int
+}
+
+func (er *endlessReader) Read(p []byte) (int, error) {
+	n := copy(p, er.prefix)
+	er.prefix = er.prefix[n:]
+	for i := n; i < len(p); i++ {
+		p[i] = er.fill
+	}
+	er.read += len(p)
+	return len(p), nil
+}
+
+func TestLimits(t *testing.T) {
+	// Test: An endless request line is rejected after the line limit
+	reader := &endlessReader{prefix: "GET /", fill: 'a'}
+	_, err := RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrLineTooLong)
+	assert.LessOrEqual(t, reader.read, 4*DefaultMaxLineLength)
+
+	// Test: An endless field line is rejected after the line limit
+	reader = &endlessReader{prefix: "GET / HTTP/1.1\r\nHost: localhost\r\nX-Long: ", fill: 'a'}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrLineTooLong)
+	assert.LessOrEqual(t, reader.read, 4*DefaultMaxLineLength)
+
+	// Test: A complete line over the limit is rejected
+	_, err = RequestFromReaderWithOptions(strings.NewReader("GET / HTTP/1.1\r\nX-Long: "+strings.Repeat("a", 100)+"\r\n\r\n"), Options{MaxLineLength: 64})
+	require.ErrorIs(t, err, ErrLineTooLong)
+
+	// Test: Lines within the limit are accepted
+	r, err := RequestFromReaderWithOptions(strings.NewReader("GET / HTTP/1.1\r\nX-Long: "+strings.Repeat("a", 50)+"\r\n\r\n"), Options{MaxLineLength: 64})
+	require.NoError(t, err)
+	assert.Len(t, r.Headers["x-long"], 50)
+
+	// Test: Endless short field lines are rejected after the header limit
+	reader = &endlessReader{prefix: "GET / HTTP/1.1\r\n", fill: 'a'}
+	reader.prefix += strings.Repeat("X-Field: 1\r\n", DefaultMaxHeaderSize/12+1)
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+	assert.LessOrEqual(t, reader.read, 4*DefaultMaxHeaderSize)
+
+	// Test: A header section within a custom limit is accepted
+	_, err = RequestFromReaderWithOptions(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"), Options{MaxHeaderSize: 64})
+	require.NoError(t, err)
+	_, err = RequestFromReaderWithOptions(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\nX-Field: "+strings.Repeat("a", 40)+"\r\n\r\n"), Options{MaxHeaderSize: 64})
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: An endless chunk extension is rejected without buffering it
+	reader = &endlessReader{prefix: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=", fill: 'a'}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+	assert.LessOrEqual(t, reader.read, 4*DefaultMaxLineLength)
+
+	// Test: An endless trailer section is rejected without buffering it
+	reader = &endlessReader{prefix: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n", fill: 'a'}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+	assert.LessOrEqual(t, reader.read, 4*DefaultMaxHeaderSize)
+}
+
+func TestReadBodyLimit(t *testing.T) {
+	deferred := Options{DeferExpectedBody: true}
+
+	// Test: An endless deferred chunked body is read only past the limit
+	reader := &endlessReader{prefix: "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nExpect: 100-continue\r\n\r\nfffffff\r\n", fill: 'a'}
+	r, err := RequestFromReaderWithOptions(reader, deferred)
+	require.NoError(t, err)
+	_, err = r.ReadBodyLimit(1000)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+	assert.LessOrEqual(t, reader.read, 4*4096)
+
+	// Test: A deferred body with a larger Content-Length is not read
+	source := strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 11\r\nExpect: 100-continue\r\n\r\n")
+	r, err = RequestFromReaderWithOptions(io.MultiReader(source, iotest.ErrReader(errors.New("body read"))), deferred)
+	require.NoError(t, err)
+	_, err = r.ReadBodyLimit(10)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Bodies within the limit are returned, deferred or not
+	raw := "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nExpect: 100-continue\r\n\r\n5\r\nhello\r\n0\r\n\r\n"
+	r, err = RequestFromReaderWithOptions(strings.NewReader(raw), deferred)
+	require.NoError(t, err)
+	body, err := r.ReadBodyLimit(5)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	r, err = RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	_, err = r.ReadBodyLimit(4)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestBodyReader(t *testing.T) {
+	deferred := Options{DeferExpectedBody: true}
+
+	// Test: A deferred body is streamed instead of collected into Body
+	reader := &endlessReader{prefix: "POST / HTTP/1.1\r\nContent-Length: 1000000000\r\nExpect: 100-continue\r\n\r\n", fill: 'a'}
+	r, err := RequestFromReaderWithOptions(reader, deferred)
+	require.NoError(t, err)
+	body, err := r.BodyReader()
+	require.NoError(t, err)
+	n, err := io.CopyN(io.Discard, body, 100000)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100000), n)
+	assert.Empty(t, r.Body)
+	assert.LessOrEqual(t, reader.read, 2*100000)
+
+	// Test: A deferred chunked body fills Trailers and keeps what follows
+	raw := "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nExpect: 100-continue\r\n\r\n5\r\nhello\r\n0\r\nX-Sum: 5\r\n\r\nnext"
+	r, err = RequestFromReaderWithOptions(&chunkReader{data: raw, numBytesPerRead: 7}, deferred)
+	require.NoError(t, err)
+	body, err = r.BodyReader()
+	require.NoError(t, err)
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.Equal(t, "5", r.Trailers.Get("X-Sum"))
+	assert.Equal(t, "next", string(r.Unread()))
+
+	// Test: A truncated deferred body fails
+	r, err = RequestFromReaderWithOptions(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\nhel"), deferred)
+	require.NoError(t, err)
+	body, err = r.BodyReader()
+	require.NoError(t, err)
+	_, err = io.ReadAll(body)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Other requests read Body
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello"))
+	require.NoError(t, err)
+	body, err = r.BodyReader()
+	require.NoError(t, err)
+	data, err = io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
@@ -0,0 +1,186 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSmugglingPayloads(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "CL.TE",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 13\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nSMUGGLED",
+		},
+		{
+			name: "TE.CL",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n8\r\nSMUGGLED\r\n0\r\n\r\n",
+		},
+		{
+			name: "TE.TE with unknown coding",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: xchunked\r\n\r\n0\r\n\r\n",
+		},
+		{
+			name: "TE.TE with duplicate header",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: identity\r\n\r\n0\r\n\r\n",
+		},
+		{
+			name: "TE.TE with repeated chunked",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked, chunked\r\n\r\n0\r\n\r\n",
+		},
+		{
+			name: "TE.TE with space before colon",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding : chunked\r\n\r\n0\r\n\r\n",
+		},
+		{
+			name: "TE.TE with vertical tab",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: \x0bchunked\r\n\r\n0\r\n\r\n",
+		},
+		{
+			name: "TE.TE with folded value",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding:\r\n chunked\r\n\r\n0\r\n\r\n",
+		},
+		{
+			name: "duplicate Content-Length with differing values",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\nContent-Length: 8\r\n\r\nabcdefgh",
+		},
+		{
+			name: "Content-Length list with differing values",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3, 8\r\n\r\nabcdefgh",
+		},
+		{
+			name: "Content-Length with plus sign",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: +3\r\n\r\nabc",
+		},
+		{
+			name: "Content-Length with minus sign",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: -1\r\n\r\nabc",
+		},
+		{
+			name: "Content-Length with leading zeros",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 003\r\n\r\nabc",
+		},
+		{
+			name: "Content-Length with hex value",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0x3\r\n\r\nabc",
+		},
+		{
+			name: "Content-Length overflow",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 99999999999999999999\r\n\r\nabc",
+		},
+		{
+			name: "bare LF after request line",
+			data: "POST / HTTP/1.1\nHost: localhost\r\nContent-Length: 3\r\n\r\nabc",
+		},
+		{
+			name: "bare LF after header",
+			data: "POST / HTTP/1.1\r\nHost: localhost\nContent-Length: 3\r\n\r\nabc",
+		},
+		{
+			name: "bare LF ending header section",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\n\nContent-Length: 3\r\n\r\nabc",
+		},
+		{
+			name: "bare LF after chunk size",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n3\nabc\r\n0\r\n\r\n",
+		},
+		{
+			name: "bare LF after chunk data",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\n0\r\n\r\n",
+		},
+		{
+			name: "chunk size with 0x prefix",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n0x3\r\nabc\r\n0\r\n\r\n",
+		},
+		{
+			name: "chunk size with sign",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n+3\r\nabc\r\n0\r\n\r\n",
+		},
+		{
+			name: "chunk size with leading whitespace",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n 3\r\nabc\r\n0\r\n\r\n",
+		},
+		{
+			name: "chunk size with trailing garbage",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n3 x\r\nabc\r\n0\r\n\r\n",
+		},
+		{
+			name: "chunk size overflow",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\nffffffffffffffffff\r\nabc\r\n0\r\n\r\n",
+		},
+		{
+			name: "chunk larger than declared size",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabcdef\r\n0\r\n\r\n",
+		},
+		{
+			name: "missing last chunk",
+			data: "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, numBytesPerRead := range []int{1, 3, len(tt.data)} {
+				reader := &chunkReader{
+					data:            tt.data,
+					numBytesPerRead: numBytesPerRead,
+				}
+				_, err := RequestFromReader(reader)
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestChunkedBodyParse(t *testing.T) {
+	// Test: Chunked body with extensions and trailers
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:9000\r\n" +
+			"Transfer-Encoding: Chunked\r\n" +
+			"\r\n" +
+			"6;name=value\r\n" +
+			"hello \r\n" +
+			"6\r\n" +
+			"world!\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!", string(r.Body))
+	assert.Equal(t, "abc", r.Trailers.Get("X-Checksum"))
+
+	// Test: Identical duplicate Content-Length values are accepted
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:9000\r\n" +
+			"Content-Length: 5\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Bytes after the Content-Length body are not part of the body
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:9000\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"helloGET /smuggled HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 64,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+}
@@ -0,0 +1,109 @@
+package response
+
+import (
+	"github.com/sp41414/goHttp/pkg/headers"
+	"maps"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TimeFormat is the IMF-fixdate format of HTTP dates such as the Date and
+// Last-Modified headers, see RFC 9110 section 5.6.7. Times must be in UTC
+// when formatted with it.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// cachedDate is a formatted Date header value and the second it is for.
+type cachedDate struct {
+	unix  int64
+	value string
+}
+
+// dateCache holds the Date value of the current second, so that busy
+// servers format it once per second rather than once per response.
+var dateCache atomic.Pointer[cachedDate]
+
+// formatDate returns the Date header value for now.
+func formatDate(now time.Time) string {
+	unix := now.Unix()
+	if cached := dateCache.Load(); cached != nil && cached.unix == unix {
+		return cached.value
+	}
+	value := now.UTC().Format(TimeFormat)
+	dateCache.Store(&cachedDate{unix: unix, value: value})
+	return value
+}
+
+// allowsBody reports whether a response with the status code may have a
+// body. Informational (1xx), 204 No Content and 304 Not Modified responses
+// never do, see RFC 9110 section 6.4.1.
+func (s StatusCode) allowsBody() bool {
+	return s >= 200 && s != NO_CONTENT && s != NOT_MODIFIED
+}
+
+// finalHeaders returns the header section to send with a final response
+// with the status code. It adds Date and, if set, Server unless h already
+// has them, and removes the framing fields the status code forbids. h itself
+// is not modified.
+func (w *Writer) finalHeaders(statusCode StatusCode, h headers.Headers) headers.Headers {
+	h = maps.Clone(h)
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+
+	if !hasField(h, "date") {
+		h["date"] = formatDate(time.Now())
+	}
+	if w.server != "" && !hasField(h, "server") {
+		h["server"] = w.server
+	}
+
+	removeFraming(statusCode, h)
+	return h
+}
+
+// interimHeaders returns the header section to send with an interim
+// response, without the framing fields a 1xx response cannot have.
+func interimHeaders(statusCode StatusCode, h headers.Headers) headers.Headers {
+	if h == nil {
+		return nil
+	}
+	h = maps.Clone(h)
+	removeFraming(statusCode, h)
+	return h
+}
+
+// removeFraming removes the fields describing a body that responses with the
+// status code cannot have, see RFC 9110 section 8.6 and RFC 9112 section
+// 6.1. A 304 response keeps Content-Length, which is the length of the
+// selected representation.
+func removeFraming(statusCode StatusCode, h headers.Headers) {
+	if !statusCode.allowsBody() {
+		deleteField(h, "transfer-encoding")
+		deleteField(h, "trailer")
+	}
+	if statusCode < 200 || statusCode == NO_CONTENT {
+		deleteField(h, "content-length")
+	}
+}
+
+// hasField reports whether h has a field with name, compared
+// case-insensitively.
+func hasField(h headers.Headers, name string) bool {
+	for k := range h {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteField removes every field with name from h, compared
+// case-insensitively.
+func deleteField(h headers.Headers, name string) {
+	for k := range h {
+		if strings.EqualFold(k, name) {
+			delete(h, k)
+		}
+	}
+}
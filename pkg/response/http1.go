@@ -0,0 +1,161 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// http1Encoder serializes a response in the HTTP/1.1 wire format.
+type http1Encoder struct {
+	inner io.Writer
+	// conn and reader are the connection and its buffered read side, set
+	// when the connection can switch protocols or be hijacked.
+	conn     net.Conn
+	reader   *bufio.Reader
+	onHijack func() []byte
+}
+
+// SwitchProtocols returns the connection, combining the buffered read side
+// with the write side.
+func (e *http1Encoder) SwitchProtocols() (io.ReadWriter, error) {
+	if e.reader == nil {
+		return nil, fmt.Errorf("Error: connection does not support switching protocols")
+	}
+	return struct {
+		io.Reader
+		io.Writer
+	}{e.reader, e.inner}, nil
+}
+
+// Hijack returns the connection and the bytes read from it but not consumed:
+// those returned by onHijack, followed by the ones buffered by reader.
+func (e *http1Encoder) Hijack() (net.Conn, []byte, error) {
+	if e.conn == nil {
+		return nil, nil, fmt.Errorf("Error: connection does not support hijacking")
+	}
+
+	buffered, err := e.reader.Peek(e.reader.Buffered())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := e.conn.SetDeadline(time.Time{}); err != nil {
+		return nil, nil, err
+	}
+	var unread []byte
+	if e.onHijack != nil {
+		unread = e.onHijack()
+	}
+	return e.conn, append(bytes.Clone(unread), buffered...), nil
+}
+
+// EncodeInterim writes an informational response: its status line, headers
+// and the empty line that ends it.
+func (e *http1Encoder) EncodeInterim(statusCode StatusCode, h headers.Headers) error {
+	err := e.EncodeStatusLine(statusCode)
+	if err != nil {
+		return err
+	}
+	return e.EncodeHeaders(h)
+}
+
+// EncodeStatusLine writes the status line, e.g. "HTTP/1.1 200 OK".
+func (e *http1Encoder) EncodeStatusLine(statusCode StatusCode) error {
+	_, err := e.inner.Write([]byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, statusCode.reasonPhrase())))
+	return err
+}
+
+// EncodeHeaders writes each header as a field line followed by the empty
+// line that separates the header section from the body. Set-Cookie values
+// get a field line each, see headers.Values. Nothing is written if a value
+// contains CR, LF or NUL.
+func (e *http1Encoder) EncodeHeaders(h headers.Headers) error {
+	if err := validateValues(h); err != nil {
+		return err
+	}
+	for k, v := range h {
+		for _, line := range headers.SplitLines(k, v) {
+			_, err := e.inner.Write([]byte(fmt.Sprintf("%s: %s\r\n", k, line)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// blank line before the body
+	_, err := e.inner.Write([]byte("\r\n"))
+	return err
+}
+
+// EncodeBody writes p unmodified.
+func (e *http1Encoder) EncodeBody(p []byte) (int, error) {
+	return e.inner.Write(p)
+}
+
+// EncodeChunk writes p as a single chunk with its hex-length prefix and
+// CRLF suffix.
+func (e *http1Encoder) EncodeChunk(p []byte) (int, error) {
+	n := len(p)
+	hl := fmt.Sprintf("%x", n)
+
+	_, err := e.inner.Write([]byte(hl + "\r\n"))
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = e.inner.Write(p)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = e.inner.Write([]byte("\r\n"))
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// EncodeChunksDone writes the final "0" chunk.
+func (e *http1Encoder) EncodeChunksDone() (int, error) {
+	return e.inner.Write([]byte("0\r\n"))
+}
+
+// EncodeTrailers writes the trailer fields and the terminating empty line.
+// Like EncodeHeaders, it rejects values containing CR, LF or NUL.
+func (e *http1Encoder) EncodeTrailers(h headers.Headers) error {
+	if err := validateValues(h); err != nil {
+		return err
+	}
+	for k, v := range h {
+		loweredK := strings.ToLower(strings.TrimSpace(k))
+		for _, line := range headers.SplitLines(k, v) {
+			_, err := e.inner.Write([]byte(fmt.Sprintf("%s: %s\r\n", loweredK, strings.TrimSpace(line))))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// blank line before the end
+	_, err := e.inner.Write([]byte("\r\n"))
+	return err
+}
+
+// validateValues checks every field line of h before any is written, so
+// that a value cannot inject field lines or end the header section early.
+func validateValues(h headers.Headers) error {
+	for k, v := range h {
+		for _, line := range headers.SplitLines(k, v) {
+			if !headers.ValidValue(line) {
+				return fmt.Errorf("Error: invalid value for header %q: must not contain CR, LF or NUL", k)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/chunked"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxHeaderSize is the default ParseOptions.MaxHeaderSize.
+const DefaultMaxHeaderSize = 1 << 20
+
+// ErrHeaderTooLarge is returned for a response whose status lines and header
+// sections are larger than ParseOptions.MaxHeaderSize.
+var ErrHeaderTooLarge = errors.New("Error: response header section too large")
+
+// Response is a response parsed by ResponseFromReader, the counterpart of
+// request.Request for the other side of a connection.
+type Response struct {
+	// HttpVersion is the protocol version, e.g. "1.1".
+	HttpVersion string
+	// StatusCode is the status code, which may be unknown to this package.
+	StatusCode StatusCode
+	// ReasonPhrase is the reason phrase as received. It may be empty and
+	// carries no meaning.
+	ReasonPhrase string
+	Headers      headers.Headers
+	// ContentLength is the length of the body: 0 for responses without a
+	// body, and -1 if it is chunked or delimited by the end of the reader.
+	ContentLength int64
+	// Body streams the body from the reader the response was parsed from.
+	// It is empty for responses without a body. After 101 Switching
+	// Protocols, it reads the data that follows, in the new protocol.
+	Body io.Reader
+	// Trailers holds the trailer fields of a chunked body once Body has
+	// been read to the end.
+	Trailers headers.Headers
+	// Interim holds the informational (1xx) responses received before this
+	// one, with their status and headers.
+	Interim []*Response
+}
+
+// ParseOptions configures the behavior of ResponseFromReaderWithOptions.
+// The zero value is the configuration used by ResponseFromReader.
+type ParseOptions struct {
+	// Method is the method of the request the response answers. The
+	// response to a HEAD request has no body, whatever its headers say.
+	// Defaults to GET.
+	Method string
+	// HeaderMode selects how obsolete line folding in the header section is
+	// handled. Defaults to headers.Strict.
+	HeaderMode headers.ParseMode
+	// MaxHeaderSize limits the size of the status lines and header sections
+	// of the response and the interim responses before it, together.
+	// Defaults to DefaultMaxHeaderSize.
+	MaxHeaderSize int
+}
+
+// ResponseFromReader reads a response from reader up to the end of its
+// header section, and returns it with a Body that streams the rest from
+// reader. The body is never buffered whole, so its size is up to the caller.
+//
+// Interim 1xx responses are collected in Interim, and parsing continues with
+// the final response, except after 101 Switching Protocols, which ends the
+// HTTP/1.1 exchange: Body reads the data following it.
+//
+// The body is framed following RFC 9112 section 6.3:
+//
+//   - 1xx, 204 and 304 responses and responses to HEAD have no body.
+//   - A Transfer-Encoding ending in chunked is decoded, and any other transfer
+//     coding is read until the end of the reader.
+//   - A Content-Length delimits the body.
+//   - Otherwise the body extends to the end of the reader.
+//
+// A body ending before its framing says it should fails with
+// io.ErrUnexpectedEOF. Like the request parser, it rejects a response with
+// both Transfer-Encoding and Content-Length, which RFC 9112 allows to treat
+// as an error since it may be an attempt at response splitting.
+//
+// Reading is buffered. To read what follows the response, such as the next
+// response on a persistent connection, pass a *bufio.Reader, which is used
+// as is, and keep reading from it once Body is done.
+func ResponseFromReader(reader io.Reader) (*Response, error) {
+	return ResponseFromReaderWithOptions(reader, ParseOptions{})
+}
+
+// ResponseFromReaderWithOptions is like ResponseFromReader but parses the
+// response according to opts.
+func ResponseFromReaderWithOptions(reader io.Reader, opts ParseOptions) (*Response, error) {
+	if opts.MaxHeaderSize <= 0 {
+		opts.MaxHeaderSize = DefaultMaxHeaderSize
+	}
+	r, ok := reader.(*bufio.Reader)
+	if !ok {
+		r = bufio.NewReader(reader)
+	}
+
+	budget := opts.MaxHeaderSize
+	var interim []*Response
+	for {
+		res, err := readHead(r, opts.HeaderMode, &budget)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode < 200 && res.StatusCode != SWITCHING_PROTOCOLS {
+			interim = append(interim, res)
+			continue
+		}
+		res.Interim = interim
+		if err := res.frameBody(r, opts.Method); err != nil {
+			return nil, fmt.Errorf("Error: could not parse response (%w)", err)
+		}
+		return res, nil
+	}
+}
+
+// readHead reads a status line and header section from r, counting their
+// size against budget. The response has an empty body.
+func readHead(r *bufio.Reader, mode headers.ParseMode, budget *int) (*Response, error) {
+	line, err := readLine(r, budget)
+	if err != nil {
+		return nil, fmt.Errorf("Error: could not read status line (%w)", err)
+	}
+	res, err := parseStatusLine(line[:len(line)-len("\r\n")])
+	if err != nil {
+		return nil, fmt.Errorf("Error: could not parse response (%w)", err)
+	}
+
+	// the whole section is parsed at once, so that folded lines are seen
+	// together with the line they continue
+	var section []byte
+	for len(line) > len("\r\n") {
+		line, err = readLine(r, budget)
+		if err != nil {
+			return nil, fmt.Errorf("Error: could not read headers (%w)", err)
+		}
+		section = append(section, line...)
+	}
+	for {
+		n, done, err := res.Headers.ParseWithMode(section, mode)
+		if err != nil {
+			return nil, fmt.Errorf("Error: could not parse response (%w)", err)
+		}
+		section = section[n:]
+		if done {
+			return res, nil
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("Error: could not parse response (incomplete header section)")
+		}
+	}
+}
+
+// readLine reads a line ending in CRLF, including it, and subtracts its
+// length from budget, failing with ErrHeaderTooLarge once budget is
+// exhausted.
+func readLine(r *bufio.Reader, budget *int) ([]byte, error) {
+	var line []byte
+	for {
+		part, err := r.ReadSlice('\n')
+		line = append(line, part...)
+		if len(line) > *budget {
+			return nil, ErrHeaderTooLarge
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		break
+	}
+	*budget -= len(line)
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("line must end with CRLF, found bare LF")
+	}
+	return line, nil
+}
+
+// parseStatusLine parses a status line without its CRLF. The line has the
+// form
+//
+//	HTTP-version SP status-code SP [ reason-phrase ]
+//
+// where the reason phrase may contain any visible characters, spaces and
+// tabs. A missing space after the status code is tolerated.
+func parseStatusLine(line []byte) (*Response, error) {
+	version, rest, ok := bytes.Cut(line, []byte(" "))
+	if !ok || !bytes.HasPrefix(version, []byte("HTTP/")) {
+		return nil, fmt.Errorf("invalid status line, status line must be in HttpVersion StatusCode ReasonPhrase format")
+	}
+	version = version[len("HTTP/"):]
+	if string(version) != "1.1" && string(version) != "1.0" {
+		return nil, fmt.Errorf("invalid status line, unsupported HTTP version %q", version)
+	}
+
+	code, reason, _ := bytes.Cut(rest, []byte(" "))
+	if len(code) != 3 || code[0] < '1' || code[0] > '9' || !isDigit(code[1]) || !isDigit(code[2]) {
+		return nil, fmt.Errorf("invalid status line, status code must be 3 digits")
+	}
+	for _, c := range reason {
+		if c < ' ' && c != '\t' || c == 0x7f {
+			return nil, fmt.Errorf("invalid status line, must not contain control characters")
+		}
+	}
+
+	statusCode, _ := strconv.Atoi(string(code))
+	return &Response{
+		HttpVersion:  string(version),
+		StatusCode:   StatusCode(statusCode),
+		ReasonPhrase: string(reason),
+		Headers:      headers.NewHeaders(),
+		Body:         bytes.NewReader(nil),
+		Trailers:     headers.NewHeaders(),
+	}, nil
+}
+
+// frameBody sets ContentLength and Body to read the body of the final
+// response res from r, answering a request with method.
+func (res *Response) frameBody(r *bufio.Reader, method string) error {
+	code := res.StatusCode
+	switch {
+	case code == SWITCHING_PROTOCOLS:
+		res.Body = r
+		return nil
+	case code == NO_CONTENT || code == NOT_MODIFIED || method == "HEAD":
+		return nil
+	}
+
+	te, hasTE := res.Headers["transfer-encoding"]
+	cl, hasCL := res.Headers["content-length"]
+	switch {
+	case hasTE && hasCL:
+		return fmt.Errorf("invalid framing: both Transfer-Encoding and Content-Length are present")
+	case hasTE:
+		res.ContentLength = -1
+		codings := strings.Split(te, ",")
+		if !strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked") {
+			res.Body = r
+			return nil
+		}
+		res.Body = chunked.NewReader(r, res.Trailers)
+	case hasCL:
+		n, err := parseContentLength(cl)
+		if err != nil {
+			return err
+		}
+		res.ContentLength = n
+		res.Body = &lengthReader{r: r, remaining: n}
+	default:
+		res.ContentLength = -1
+		res.Body = r
+	}
+	return nil
+}
+
+// parseContentLength parses a Content-Length field value with the rules of
+// the request parser: a list of identical lengths left by repeated fields is
+// accepted, while signs, leading zeros and anything but digits are not.
+func parseContentLength(value string) (int64, error) {
+	var length int64 = -1
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return 0, fmt.Errorf("invalid framing: empty Content-Length")
+		}
+		if len(part) > 1 && part[0] == '0' {
+			return 0, fmt.Errorf("invalid framing: Content-Length %q has leading zeros", part)
+		}
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, fmt.Errorf("invalid framing: Content-Length %q is not a number", part)
+			}
+		}
+
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid framing: Content-Length %q is out of range", part)
+		}
+		if length != -1 && n != length {
+			return 0, fmt.Errorf("invalid framing: conflicting Content-Length values %q", value)
+		}
+		length = n
+	}
+	return length, nil
+}
+
+// lengthReader reads a body of a known length.
+type lengthReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *lengthReader) Read(p []byte) (int, error) {
+	if l.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if err == io.EOF {
+		if l.remaining > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// isDigit reports whether c is an ASCII digit.
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,296 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chunkReader struct {
+	data            string
+	numBytesPerRead int
+	pos             int
+}
+
+func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	if cr.pos >= len(cr.data) {
+		return 0, io.EOF
+	}
+	endIndex := min(cr.pos+cr.numBytesPerRead, len(cr.data))
+	n = copy(p, cr.data[cr.pos:endIndex])
+	cr.pos += n
+
+	return n, nil
+}
+
+// parseSplit parses data with every read size from 1 to len(data), so that
+// each part of the response is split across reads at every position, and
+// checks that all reads agree. It returns the response with its whole body,
+// and the first error of parsing or reading the body.
+func parseSplit(t *testing.T, data string, opts ParseOptions) (*Response, string, error) {
+	t.Helper()
+	parse := func(reader io.Reader) (*Response, string, error) {
+		r, err := ResponseFromReaderWithOptions(reader, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		body, err := io.ReadAll(r.Body)
+		return r, string(body), err
+	}
+
+	first, firstBody, firstErr := parse(strings.NewReader(data))
+	for size := 1; size < len(data); size++ {
+		r, body, err := parse(&chunkReader{data: data, numBytesPerRead: size})
+		require.Equal(t, firstErr == nil, err == nil, "read size %d: %v", size, err)
+		if err == nil {
+			require.Equal(t, first.StatusCode, r.StatusCode, "read size %d", size)
+			require.Equal(t, first.Headers, r.Headers, "read size %d", size)
+			require.Equal(t, firstBody, body, "read size %d", size)
+			require.Equal(t, first.Trailers, r.Trailers, "read size %d", size)
+			require.Equal(t, len(first.Interim), len(r.Interim), "read size %d", size)
+		}
+	}
+	return first, firstBody, firstErr
+}
+
+func TestStatusLineParse(t *testing.T) {
+	// Test: Standard status line
+	r, _, err := parseSplit(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "1.1", r.HttpVersion)
+	assert.Equal(t, OK, r.StatusCode)
+	assert.Equal(t, "OK", r.ReasonPhrase)
+
+	// Test: Arbitrary reason phrases, including none at all
+	for raw, reason := range map[string]string{
+		"HTTP/1.1 404 Nothing to see here\r\n": "Nothing to see here",
+		"HTTP/1.0 404 Não\tencontrado\r\n":     "Não\tencontrado",
+		"HTTP/1.1 404 \r\n":                    "",
+		"HTTP/1.1 404\r\n":                     "",
+	} {
+		r, _, err = parseSplit(t, raw+"Content-Length: 0\r\n\r\n", ParseOptions{})
+		require.NoError(t, err, raw)
+		assert.Equal(t, NOT_FOUND, r.StatusCode, raw)
+		assert.Equal(t, reason, r.ReasonPhrase, raw)
+	}
+
+	// Test: Status codes unknown to this package
+	r, _, err = parseSplit(t, "HTTP/1.1 599 Custom\r\nContent-Length: 0\r\n\r\n", ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode(599), r.StatusCode)
+
+	// Test: Invalid status lines
+	for _, raw := range []string{
+		"HTTP/1.1 200 OK\n",
+		"HTTP/2 200 OK\r\n",
+		"HTTP/1.1 20 OK\r\n",
+		"HTTP/1.1 2000 OK\r\n",
+		"HTTP/1.1 099 OK\r\n",
+		"HTTP/1.1 2x0 OK\r\n",
+		"HTTP/1.1 +20 OK\r\n",
+		"HTTP/1.1 200 O\x01K\r\n",
+		"http/1.1 200 OK\r\n",
+		"HTTP/1.1\r\n",
+		"200 OK\r\n",
+	} {
+		_, err = ResponseFromReader(strings.NewReader(raw + "\r\n"))
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestResponseHeadersParse(t *testing.T) {
+	// Test: Repeated Set-Cookie fields stay separate
+	r, _, err := parseSplit(t, "HTTP/1.1 200 OK\r\nSet-Cookie: a=1; Expires=Sun, 06 Nov 1994 08:49:37 GMT\r\nSet-Cookie: b=2\r\nVary: Origin\r\nVary: Accept\r\nContent-Length: 0\r\n\r\n", ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a=1; Expires=Sun, 06 Nov 1994 08:49:37 GMT", "b=2"}, r.Headers.Values("Set-Cookie"))
+	assert.Equal(t, "Origin, Accept", r.Headers.Get("Vary"))
+
+	// Test: Folding is rejected unless lenient
+	raw := "HTTP/1.1 200 OK\r\nX-Folded: a\r\n b\r\nContent-Length: 0\r\n\r\n"
+	_, err = ResponseFromReader(strings.NewReader(raw))
+	require.Error(t, err)
+	r, _, err = parseSplit(t, raw, ParseOptions{HeaderMode: headers.Lenient})
+	require.NoError(t, err)
+	assert.Equal(t, "a b", r.Headers.Get("X-Folded"))
+
+	// Test: EOF inside the header section
+	_, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n"))
+	require.Error(t, err)
+	_, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK"))
+	require.Error(t, err)
+
+	// Test: Header sections beyond the limit, counting interim responses
+	raw = "HTTP/1.1 200 OK\r\nX-Long: " + strings.Repeat("a", 100) + "\r\n\r\n"
+	_, err = ResponseFromReaderWithOptions(strings.NewReader(raw), ParseOptions{MaxHeaderSize: 100})
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+	_, _, err = parseSplit(t, raw, ParseOptions{MaxHeaderSize: 200})
+	require.NoError(t, err)
+	hints := strings.Repeat("HTTP/1.1 103 Early Hints\r\nLink: </a.css>\r\n\r\n", 10)
+	_, err = ResponseFromReaderWithOptions(strings.NewReader(hints+raw), ParseOptions{MaxHeaderSize: 500})
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: An endless header line is rejected without reading all of it
+	reader := &chunkReader{data: "HTTP/1.1 200 OK\r\nX-Long: " + strings.Repeat("a", 1<<20), numBytesPerRead: 1 << 20}
+	_, err = ResponseFromReaderWithOptions(reader, ParseOptions{MaxHeaderSize: 1000})
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+}
+
+func TestResponseBodyParse(t *testing.T) {
+	// Test: Content-Length delimits the body
+	r, body, err := parseSplit(t, "HTTP/1.1 200 OK\r\nContent-Length: 13\r\n\r\nhello world!\n", ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", body)
+	assert.Equal(t, int64(13), r.ContentLength)
+
+	// Test: Chunked bodies with extensions and trailers
+	r, body, err = parseSplit(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nTrailer: X-Sum\r\n\r\n5;ext=1\r\nhello\r\n7\r\n, world\r\n0\r\nX-Sum: 42\r\n\r\n", ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", body)
+	assert.Equal(t, "42", r.Trailers.Get("X-Sum"))
+	assert.Equal(t, int64(-1), r.ContentLength)
+
+	// Test: Without framing the body extends to EOF
+	_, body, err = parseSplit(t, "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\nuntil the connection closes", ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "until the connection closes", body)
+	_, body, err = parseSplit(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip\r\n\r\nraw bytes", ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "raw bytes", body)
+	_, body, err = parseSplit(t, "HTTP/1.1 200 OK\r\n\r\n", ParseOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, body)
+
+	// Test: Framing errors are reported before the body is read
+	for _, raw := range []string{
+		"HTTP/1.1 200 OK\r\nContent-Length: 010\r\n\r\n0123456789",
+		"HTTP/1.1 200 OK\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\nab",
+		"HTTP/1.1 200 OK\r\nContent-Length: 2\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+	} {
+		_, err = ResponseFromReader(strings.NewReader(raw))
+		assert.Error(t, err, raw)
+	}
+
+	// Test: Truncated and malformed bodies fail while reading them
+	for _, raw := range []string{
+		"HTTP/1.1 200 OK\r\nContent-Length: 20\r\n\r\npartial content",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhel",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n",
+	} {
+		r, err := ResponseFromReader(&chunkReader{data: raw, numBytesPerRead: 3})
+		require.NoError(t, err, raw)
+		_, err = io.ReadAll(r.Body)
+		assert.Error(t, err, raw)
+	}
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 20\r\n\r\npartial content"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: The body is streamed rather than read ahead
+	reader := &chunkReader{data: "HTTP/1.1 200 OK\r\nContent-Length: 1000000\r\n\r\n" + strings.Repeat("x", 1000000), numBytesPerRead: 1000}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Less(t, reader.pos, 10000)
+	n, err := io.Copy(io.Discard, r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000000), n)
+}
+
+func TestBodilessResponses(t *testing.T) {
+	// Test: HEAD, 204 and 304 responses have no body whatever their headers
+	// say, and what follows is left in the reader
+	for _, tt := range []struct {
+		raw    string
+		method string
+	}{
+		{"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", "HEAD"},
+		{"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", "HEAD"},
+		{"HTTP/1.1 204 No Content\r\n\r\n", "GET"},
+		{"HTTP/1.1 304 Not Modified\r\nContent-Length: 5\r\nETag: \"v1\"\r\n\r\n", "GET"},
+	} {
+		reader := bufio.NewReader(strings.NewReader(tt.raw + "HTTP/1.1"))
+		r, err := ResponseFromReaderWithOptions(reader, ParseOptions{Method: tt.method})
+		require.NoError(t, err, tt.raw)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err, tt.raw)
+		assert.Empty(t, body, tt.raw)
+		assert.Equal(t, int64(0), r.ContentLength, tt.raw)
+		rest, _ := io.ReadAll(reader)
+		assert.Equal(t, "HTTP/1.1", string(rest), tt.raw)
+	}
+
+	// Test: The same response to GET has a body, and the next response
+	// follows it
+	reader := bufio.NewReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhelloHTTP/1.1 204 No Content\r\n\r\n"))
+	r, err := ResponseFromReaderWithOptions(reader, ParseOptions{Method: "GET"})
+	require.NoError(t, err)
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, NO_CONTENT, r.StatusCode)
+}
+
+func TestInterimResponses(t *testing.T) {
+	// Test: 1xx responses are collected before the final response
+	r, body, err := parseSplit(t, "HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n"+
+		"HTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok", ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode(201), r.StatusCode)
+	assert.Equal(t, "ok", body)
+	require.Len(t, r.Interim, 2)
+	assert.Equal(t, CONTINUE, r.Interim[0].StatusCode)
+	assert.Equal(t, EARLY_HINTS, r.Interim[1].StatusCode)
+	assert.Equal(t, "Early Hints", r.Interim[1].ReasonPhrase)
+	assert.Equal(t, "</style.css>; rel=preload", r.Interim[1].Headers.Get("Link"))
+	assert.Empty(t, r.Headers.Get("Link"))
+
+	// Test: 101 Switching Protocols ends the response, and its body is the
+	// new protocol
+	r, err = ResponseFromReader(strings.NewReader("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n\x81\x02hi"))
+	require.NoError(t, err)
+	assert.Equal(t, SWITCHING_PROTOCOLS, r.StatusCode)
+	data, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "\x81\x02hi", string(data))
+
+	// Test: EOF after an interim response
+	_, err = ResponseFromReader(strings.NewReader("HTTP/1.1 100 Continue\r\n\r\n"))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	// Test: Responses written by Writer parse back, one byte at a time
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteEarlyHints("</a.js>; rel=preload"))
+	require.NoError(t, w.WriteStatusLine(OK))
+	h := headers.Headers{"transfer-encoding": "chunked", "trailer": "x-checksum"}
+	require.NoError(t, h.Add("Set-Cookie", "a=1"))
+	require.NoError(t, h.Add("Set-Cookie", "b=2"))
+	require.NoError(t, w.WriteHeaders(h))
+	for _, chunk := range []string{"hello", ", ", "world"} {
+		_, err := w.WriteChunkedBody([]byte(chunk))
+		require.NoError(t, err)
+	}
+	_, err := w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(headers.Headers{"x-checksum": "abc"}))
+
+	r, body, err := parseSplit(t, buf.String(), ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, OK, r.StatusCode)
+	assert.Len(t, r.Interim, 1)
+	assert.Equal(t, "hello, world", body)
+	assert.Equal(t, "abc", r.Trailers.Get("X-Checksum"))
+	assert.Equal(t, []string{"a=1", "b=2"}, r.Headers.Values("Set-Cookie"))
+	assert.NotEmpty(t, r.Headers.Get("Date"))
+}
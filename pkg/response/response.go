@@ -1,12 +1,18 @@
-// Package response provides a stateful HTTP/1.1 response writer.
+// Package response provides a stateful HTTP response writer.
 // It ensures that response components (Status Line, Headers, Body, and Trailers)
 // are written in the correct order as defined by the HTTP specification.
+//
+// The Writer only enforces ordering; serializing each component is delegated
+// to an Encoder, so the same handler code can answer HTTP/1.1 and HTTP/2
+// requests.
 package response
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/sp41414/goHttp/pkg/headers"
 	"io"
+	"net"
 	"strconv"
 	"strings"
 )
@@ -14,11 +20,55 @@ import (
 // StatusCode represents an HTTP response status code e.g.(200, 400, 500).
 type StatusCode int
 
-// Writer wraps an io.Writer to manage the lifecycle of an HTTP response.
+// Writer manages the lifecycle of an HTTP response.
 // It maintains an internal state to prevent out-of-order writes.
 type Writer struct {
-	inner io.Writer
+	enc   Encoder
 	State writerState
+	// omitBody drops body data, see OmitBody.
+	omitBody bool
+	// status is the status code of the final response once written.
+	status StatusCode
+	// server is the Server header value added to responses, if not empty.
+	server string
+}
+
+// Encoder serializes the components of a response for one protocol version.
+// The Writer calls an Encoder only in a valid order, so implementations do
+// not need to track the response state themselves.
+type Encoder interface {
+	// EncodeInterim serializes an informational (1xx) response sent ahead
+	// of the final response.
+	EncodeInterim(statusCode StatusCode, h headers.Headers) error
+	// EncodeStatusLine serializes the status of the response.
+	EncodeStatusLine(statusCode StatusCode) error
+	// EncodeHeaders serializes the header section.
+	EncodeHeaders(h headers.Headers) error
+	// EncodeBody serializes body data for a response with a known length.
+	EncodeBody(p []byte) (int, error)
+	// EncodeChunk serializes a piece of body data of a chunked response.
+	EncodeChunk(p []byte) (int, error)
+	// EncodeChunksDone marks the end of a chunked body.
+	EncodeChunksDone() (int, error)
+	// EncodeTrailers serializes the trailer section, completing the response.
+	EncodeTrailers(h headers.Headers) error
+}
+
+// ProtocolSwitcher is implemented by encoders whose connection can carry
+// another protocol after a 101 Switching Protocols response.
+type ProtocolSwitcher interface {
+	// SwitchProtocols returns the connection the response is written to.
+	// Reads return any data buffered after the request before reading
+	// from the connection itself.
+	SwitchProtocols() (io.ReadWriter, error)
+}
+
+// Hijacker is implemented by encoders that can hand their connection over
+// to the handler.
+type Hijacker interface {
+	// Hijack returns the connection and any data read from it but not yet
+	// consumed by the request parser.
+	Hijack() (net.Conn, []byte, error)
 }
 
 // writerState defines the valid stages of a response lifecycle.
@@ -33,19 +83,162 @@ const (
 )
 
 const (
-	OK                    StatusCode = 200
-	BAD_REQUEST           StatusCode = 400
-	INTERNAL_SERVER_ERROR StatusCode = 500
+	CONTINUE                        StatusCode = 100
+	SWITCHING_PROTOCOLS             StatusCode = 101
+	EARLY_HINTS                     StatusCode = 103
+	OK                              StatusCode = 200
+	NO_CONTENT                      StatusCode = 204
+	PARTIAL_CONTENT                 StatusCode = 206
+	MOVED_PERMANENTLY               StatusCode = 301
+	NOT_MODIFIED                    StatusCode = 304
+	BAD_REQUEST                     StatusCode = 400
+	FORBIDDEN                       StatusCode = 403
+	NOT_FOUND                       StatusCode = 404
+	METHOD_NOT_ALLOWED              StatusCode = 405
+	NOT_ACCEPTABLE                  StatusCode = 406
+	PRECONDITION_FAILED             StatusCode = 412
+	CONTENT_TOO_LARGE               StatusCode = 413
+	UNSUPPORTED_MEDIA_TYPE          StatusCode = 415
+	RANGE_NOT_SATISFIABLE           StatusCode = 416
+	EXPECTATION_FAILED              StatusCode = 417
+	UPGRADE_REQUIRED                StatusCode = 426
+	REQUEST_HEADER_FIELDS_TOO_LARGE StatusCode = 431
+	INTERNAL_SERVER_ERROR           StatusCode = 500
 )
 
-// NewWriter initializes a Writer in the StatusLine state.
+// StatusText returns the standard reason phrase for the status code, e.g.
+// "Not Found", or an empty string if the code is not known to this package.
+func StatusText(statusCode StatusCode) string {
+	return statusCode.reasonPhrase()
+}
+
+// reasonPhrase returns the standard reason phrase for the status code, or an
+// empty string if the code is not known to this package.
+func (s StatusCode) reasonPhrase() string {
+	switch s {
+	case CONTINUE:
+		return "Continue"
+	case SWITCHING_PROTOCOLS:
+		return "Switching Protocols"
+	case EARLY_HINTS:
+		return "Early Hints"
+	case OK:
+		return "OK"
+	case NO_CONTENT:
+		return "No Content"
+	case PARTIAL_CONTENT:
+		return "Partial Content"
+	case MOVED_PERMANENTLY:
+		return "Moved Permanently"
+	case NOT_MODIFIED:
+		return "Not Modified"
+	case BAD_REQUEST:
+		return "Bad Request"
+	case FORBIDDEN:
+		return "Forbidden"
+	case NOT_FOUND:
+		return "Not Found"
+	case METHOD_NOT_ALLOWED:
+		return "Method Not Allowed"
+	case NOT_ACCEPTABLE:
+		return "Not Acceptable"
+	case PRECONDITION_FAILED:
+		return "Precondition Failed"
+	case CONTENT_TOO_LARGE:
+		return "Content Too Large"
+	case UNSUPPORTED_MEDIA_TYPE:
+		return "Unsupported Media Type"
+	case RANGE_NOT_SATISFIABLE:
+		return "Range Not Satisfiable"
+	case EXPECTATION_FAILED:
+		return "Expectation Failed"
+	case UPGRADE_REQUIRED:
+		return "Upgrade Required"
+	case REQUEST_HEADER_FIELDS_TOO_LARGE:
+		return "Request Header Fields Too Large"
+	case INTERNAL_SERVER_ERROR:
+		return "Internal Server Error"
+	default:
+		return ""
+	}
+}
+
+// NewWriter initializes a Writer in the StatusLine state that writes an
+// HTTP/1.1 response to inner.
 func NewWriter(inner io.Writer) *Writer {
+	return NewWriterWithEncoder(&http1Encoder{inner: inner})
+}
+
+// NewConnWriter initializes a Writer in the StatusLine state that writes an
+// HTTP/1.1 response to conn. r is the reader the request was parsed from,
+// which lets the handler switch protocols with SwitchProtocols or take over
+// the connection with Hijack. onHijack, if not nil, is called when the
+// connection is hijacked. It returns data read from the connection that r
+// does not hold, such as the part of a deferred request body the handler did
+// not read, which Hijack hands over before the data buffered by r.
+func NewConnWriter(conn net.Conn, r *bufio.Reader, onHijack func() []byte) *Writer {
+	return NewWriterWithEncoder(&http1Encoder{inner: conn, conn: conn, reader: r, onHijack: onHijack})
+}
+
+// NewWriterWithEncoder initializes a Writer in the StatusLine state that
+// serializes the response with enc.
+func NewWriterWithEncoder(enc Encoder) *Writer {
 	return &Writer{
 		State: StatusLine,
-		inner: inner,
+		enc:   enc,
 	}
 }
 
+// OmitBody makes the writer drop all body data, chunks and trailers while
+// still accepting them in the usual order. The server calls it for HEAD
+// requests, so a GET handler can answer them unchanged: its headers, such as
+// Content-Length, still describe the body a GET request would receive.
+func (w *Writer) OmitBody() {
+	w.omitBody = true
+}
+
+// WrapEncoder replaces the encoder of the writer with wrap(enc), so that
+// middleware can transform the response before it is serialized, e.g. to
+// compress the body. The wrapping encoder should implement ProtocolSwitcher
+// and Hijacker by delegating to enc. It fails once the status line is
+// written.
+func (w *Writer) WrapEncoder(wrap func(enc Encoder) Encoder) error {
+	if w.State != StatusLine {
+		return fmt.Errorf("Error: unexpected state, expected state to be StatusLine")
+	}
+	w.enc = wrap(w.enc)
+	return nil
+}
+
+// SetServerHeader makes the writer add a Server header with name to the
+// final response, unless the handler sets one. The server calls it when
+// configured with Server.SetServerHeader.
+func (w *Writer) SetServerHeader(name string) {
+	w.server = name
+}
+
+// WriteInterim writes an informational (1xx) response with headers h, which
+// may be nil, ahead of the final response. Any number of interim responses
+// can be written before WriteStatusLine; the writer stays in the StatusLine
+// state. Use SwitchProtocols for 101 Switching Protocols.
+func (w *Writer) WriteInterim(statusCode StatusCode, h headers.Headers) error {
+	if w.State != StatusLine {
+		return fmt.Errorf("Error: unexpected state, expected state to be StatusLine")
+	}
+	if statusCode < 100 || statusCode > 199 || statusCode == SWITCHING_PROTOCOLS {
+		return fmt.Errorf("Error: %d is not an interim status code", statusCode)
+	}
+
+	return w.enc.EncodeInterim(statusCode, interimHeaders(statusCode, h))
+}
+
+// WriteEarlyHints writes a 103 Early Hints response with a Link header for
+// each of links, e.g. `</style.css>; rel=preload; as=style`, so the client
+// can start loading them while the final response is prepared.
+func (w *Writer) WriteEarlyHints(links ...string) error {
+	return w.WriteInterim(EARLY_HINTS, headers.Headers{"link": strings.Join(links, ", ")})
+}
+
 // WriteStatusLine writes the HTTP/1.1 status line.
 // It transitions the writer from StatusLine to Header state.
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
@@ -53,29 +246,12 @@ func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 		return fmt.Errorf("Error: unexpected state, expected state to be StatusLine")
 	}
 
-	switch statusCode {
-	case OK:
-		_, err := w.inner.Write([]byte("HTTP/1.1 200 OK\r\n"))
-		if err != nil {
-			return err
-		}
-	case BAD_REQUEST:
-		_, err := w.inner.Write([]byte("HTTP/1.1 400 Bad Request\r\n"))
-		if err != nil {
-			return err
-		}
-	case INTERNAL_SERVER_ERROR:
-		_, err := w.inner.Write([]byte("HTTP/1.1 500 Internal Server Error\r\n"))
-		if err != nil {
-			return err
-		}
-	default:
-		_, err := w.inner.Write([]byte(fmt.Sprintf("HTTP/1.1 %d \r\n", statusCode)))
-		if err != nil {
-			return err
-		}
+	err := w.enc.EncodeStatusLine(statusCode)
+	if err != nil {
+		return err
 	}
 
+	w.status = statusCode
 	w.State = Header
 	return nil
 }
@@ -90,22 +266,33 @@ func GetDefaultHeaders(contentLen int) headers.Headers {
 	}
 }
 
+// WriteError writes a complete plain text response with message as its
+// body, e.g. for a handler rejecting a request.
+func WriteError(w *Writer, statusCode StatusCode, message string) error {
+	body := []byte(message)
+	if err := w.WriteStatusLine(statusCode); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(GetDefaultHeaders(len(body))); err != nil {
+		return err
+	}
+	_, err := w.WriteBody(body)
+	return err
+}
+
 // WriteHeaders writes the provided headers followed by the required
 // empty line (\r\n). It transitions the writer to the Body state.
+//
+// A Date header is added unless present. Fields the status code forbids are
+// dropped: Content-Length on 1xx and 204 responses, and Transfer-Encoding
+// and Trailer on responses that cannot have a body (1xx, 204 and 304). The
+// body of such a response must be empty.
 func (w *Writer) WriteHeaders(headers headers.Headers) error {
 	if w.State != Header {
 		return fmt.Errorf("Error: unexpected state, expected state to be Header")
 	}
 
-	for k, v := range headers {
-		_, err := w.inner.Write([]byte(fmt.Sprintf("%s: %s\r\n", k, v)))
-		if err != nil {
-			return err
-		}
-	}
-
-	// blank line before the body
-	_, err := w.inner.Write([]byte("\r\n"))
+	err := w.enc.EncodeHeaders(w.finalHeaders(w.status, headers))
 	if err != nil {
 		return err
 	}
@@ -120,8 +307,14 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.State != Body {
 		return 0, fmt.Errorf("Error: unexpected state, expected state to be Body")
 	}
+	if err := w.checkBody(p); err != nil {
+		return 0, err
+	}
+	if w.omitBody || !w.status.allowsBody() {
+		return len(p), nil
+	}
 
-	n, err := w.inner.Write(p)
+	n, err := w.enc.EncodeBody(p)
 	if err != nil {
 		return 0, err
 	}
@@ -129,27 +322,36 @@ func (w *Writer) WriteBody(p []byte) (int, error) {
 	return n, nil
 }
 
+// BodyWriter returns an io.Writer writing to w with WriteBody, so that a
+// body with a known length can be copied into the response, e.g. with
+// io.Copy.
+func BodyWriter(w *Writer) io.Writer {
+	return bodyWriter{w}
+}
+
+// bodyWriter is the io.Writer returned by BodyWriter.
+type bodyWriter struct {
+	w *Writer
+}
+
+func (b bodyWriter) Write(p []byte) (int, error) {
+	return b.w.WriteBody(p)
+}
+
 // WriteChunkedBody writes a single data chunk using HTTP Chunked Transfer Encoding.
 // It automatically handles the hex-length prefix and CRLF suffixes.
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	if w.State != Body {
 		return 0, fmt.Errorf("Error: unexpected state, expected state to be Body")
 	}
-
-	n := len(p)
-	hl := fmt.Sprintf("%x", n)
-
-	_, err := w.inner.Write([]byte(hl + "\r\n"))
-	if err != nil {
+	if err := w.checkBody(p); err != nil {
 		return 0, err
 	}
-
-	_, err = w.inner.Write(p)
-	if err != nil {
-		return 0, err
+	if w.omitBody || !w.status.allowsBody() {
+		return len(p), nil
 	}
 
-	_, err = w.inner.Write([]byte("\r\n"))
+	n, err := w.enc.EncodeChunk(p)
 	if err != nil {
 		return 0, err
 	}
@@ -163,8 +365,12 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	if w.State != Body {
 		return 0, fmt.Errorf("Error: unexpected state, expected state to be Body")
 	}
+	if w.omitBody || !w.status.allowsBody() {
+		w.State = Trailers
+		return 0, nil
+	}
 
-	n, err := w.inner.Write([]byte("0\r\n"))
+	n, err := w.enc.EncodeChunksDone()
 	if err != nil {
 		return 0, err
 	}
@@ -179,17 +385,12 @@ func (w *Writer) WriteTrailers(h headers.Headers) error {
 	if w.State != Trailers {
 		return fmt.Errorf("Error: unexpected state, expected state to be Trailers")
 	}
-
-	for k, v := range h {
-		loweredK := strings.ToLower(strings.TrimSpace(k))
-		_, err := w.inner.Write([]byte(fmt.Sprintf("%s: %s\r\n", loweredK, strings.TrimSpace(v))))
-		if err != nil {
-			return err
-		}
+	if w.omitBody || !w.status.allowsBody() {
+		w.State = Done
+		return nil
 	}
 
-	// blank line before the end
-	_, err := w.inner.Write([]byte("\r\n"))
+	err := w.enc.EncodeTrailers(h)
 	if err != nil {
 		return err
 	}
@@ -197,3 +398,70 @@ func (w *Writer) WriteTrailers(h headers.Headers) error {
 	w.State = Done
 	return nil
 }
+
+// SwitchProtocols writes a 101 Switching Protocols response with headers h
+// and returns the connection, which from then on carries the protocol named
+// in the Upgrade header. It transitions the writer to the Done state.
+//
+// The connection remains usable until the handler returns. It fails if the
+// encoder does not implement ProtocolSwitcher, e.g. for HTTP/2 streams.
+func (w *Writer) SwitchProtocols(h headers.Headers) (io.ReadWriter, error) {
+	if w.State != StatusLine {
+		return nil, fmt.Errorf("Error: unexpected state, expected state to be StatusLine")
+	}
+
+	switcher, ok := w.enc.(ProtocolSwitcher)
+	if !ok {
+		return nil, fmt.Errorf("Error: connection does not support switching protocols")
+	}
+	conn, err := switcher.SwitchProtocols()
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.enc.EncodeStatusLine(SWITCHING_PROTOCOLS)
+	if err != nil {
+		return nil, err
+	}
+	err = w.enc.EncodeHeaders(h)
+	if err != nil {
+		return nil, err
+	}
+
+	w.State = Done
+	return conn, nil
+}
+
+// Hijack takes over the connection from the server. It returns the
+// connection and any bytes the server already read past the request, which
+// the caller must process before reading from the connection. Deadlines on
+// the connection are cleared. It transitions the writer to the Done state.
+//
+// After Hijack the server neither writes to nor closes the connection, and
+// Server.Close leaves it open; the caller is responsible for closing it. It
+// fails if the encoder does not implement Hijacker, e.g. for HTTP/2 streams.
+func (w *Writer) Hijack() (net.Conn, []byte, error) {
+	if w.State == Done {
+		return nil, nil, fmt.Errorf("Error: unexpected state, response is already done")
+	}
+
+	hijacker, ok := w.enc.(Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("Error: connection does not support hijacking")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w.State = Done
+	return conn, buffered, nil
+}
+
+// checkBody rejects body data for a status code that does not allow a body.
+func (w *Writer) checkBody(p []byte) error {
+	if len(p) > 0 && !w.status.allowsBody() {
+		return fmt.Errorf("Error: a %d response cannot have a body", w.status)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteInterim(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	// Test: Several interim responses before the final one
+	require.NoError(t, w.WriteEarlyHints("</style.css>; rel=preload; as=style"))
+	require.NoError(t, w.WriteInterim(EARLY_HINTS, headers.Headers{"link": "</app.js>; rel=preload; as=script"}))
+	require.NoError(t, w.WriteInterim(CONTINUE, nil))
+	assert.Equal(t, StatusLine, w.State)
+
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(headers.Headers{"date": "Sun, 06 Nov 1994 08:49:37 GMT"}))
+	_, err := w.WriteBody([]byte("ok"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 103 Early Hints\r\nlink: </style.css>; rel=preload; as=style\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\nlink: </app.js>; rel=preload; as=script\r\n\r\n"+
+		"HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\ndate: Sun, 06 Nov 1994 08:49:37 GMT\r\n\r\nok", buf.String())
+
+	// Test: Interim responses after the final status line are rejected
+	require.Error(t, w.WriteInterim(EARLY_HINTS, nil))
+
+	// Test: Only 1xx codes other than 101 are interim
+	w = NewWriter(&buf)
+	require.Error(t, w.WriteInterim(OK, nil))
+	require.Error(t, w.WriteInterim(SWITCHING_PROTOCOLS, nil))
+	require.Error(t, w.WriteInterim(99, nil))
+}
+
+func TestWriteError(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	// Test: A complete plain text response
+	require.NoError(t, WriteError(w, NOT_FOUND, "file not found"))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 404 Not Found\r\n"))
+	assert.Contains(t, buf.String(), "content-length: 14\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nfile not found"))
+
+	// Test: It fails once the status line is written
+	require.Error(t, WriteError(w, NOT_FOUND, "file not found"))
+}
+
+func TestBodyWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	// Test: Copied data is written as the body
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(headers.Headers{"content-length": "5"}))
+	n, err := io.Copy(BodyWriter(w), strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+
+	// Test: Writing before the headers fails
+	_, err = BodyWriter(NewWriter(&buf)).Write([]byte("x"))
+	require.Error(t, err)
+}
+
+func TestDateAndServerHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetServerHeader("goHttp")
+
+	// Test: Date and Server are added to the final response
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(headers.Headers{"content-length": "0"}))
+	assert.Regexp(t, `\r\ndate: \w{3}, \d{2} \w{3} \d{4} \d{2}:\d{2}:\d{2} GMT\r\n`, buf.String())
+	assert.Contains(t, buf.String(), "\r\nserver: goHttp\r\n")
+
+	// Test: Headers set by the handler are kept, whatever their case
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetServerHeader("goHttp")
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(headers.Headers{"Date": "Sun, 06 Nov 1994 08:49:37 GMT", "server": "custom"}))
+	assert.Contains(t, buf.String(), "\r\nDate: Sun, 06 Nov 1994 08:49:37 GMT\r\n")
+	assert.Contains(t, buf.String(), "\r\nserver: custom\r\n")
+	assert.Equal(t, 2, strings.Count(buf.String(), ": "))
+
+	// Test: The formatted date is reused within the same second
+	now := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	first := formatDate(now)
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", first)
+	assert.Equal(t, first, formatDate(now.Add(500*time.Millisecond)))
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:38 GMT", formatDate(now.Add(time.Second)))
+}
+
+func TestSetCookieFieldLines(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	// Test: Each Set-Cookie value is written on its own field line
+	h := headers.Headers{"content-length": "0"}
+	require.NoError(t, h.Add("Set-Cookie", "a=1; Expires=Sun, 06 Nov 1994 08:49:37 GMT"))
+	require.NoError(t, h.Add("Set-Cookie", "b=2"))
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Contains(t, buf.String(), "\r\nset-cookie: a=1; Expires=Sun, 06 Nov 1994 08:49:37 GMT\r\n")
+	assert.Contains(t, buf.String(), "\r\nset-cookie: b=2\r\n")
+	assert.NotContains(t, buf.String(), "\n\n")
+}
+
+func TestInvalidFieldValues(t *testing.T) {
+	// Test: Values with CR, LF or NUL are rejected before anything is written
+	for _, value := range []string{"a\r\nX-Injected: 1", "a\nb", "a\rb", "a\x00b"} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		require.NoError(t, w.WriteStatusLine(OK))
+		n := buf.Len()
+		assert.Error(t, w.WriteHeaders(headers.Headers{"content-length": "0", "x-custom": value}), "%q", value)
+		assert.Equal(t, n, buf.Len())
+	}
+
+	// Test: Trailers are checked too
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(OK))
+	require.NoError(t, w.WriteHeaders(headers.Headers{"transfer-encoding": "chunked"}))
+	_, err := w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	assert.Error(t, w.WriteTrailers(headers.Headers{"x-checksum": "a\rb"}))
+	assert.NotContains(t, buf.String(), "x-checksum")
+}
+
+func TestBodilessStatus(t *testing.T) {
+	var buf bytes.Buffer
+	h := headers.Headers{
+		"date":              "Sun, 06 Nov 1994 08:49:37 GMT",
+		"content-length":    "5",
+		"Transfer-Encoding": "chunked",
+	}
+
+	// Test: 204 drops Content-Length and Transfer-Encoding and rejects a body
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(NO_CONTENT))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteBody([]byte("hello"))
+	require.Error(t, err)
+	_, err = w.WriteBody(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\ndate: Sun, 06 Nov 1994 08:49:37 GMT\r\n\r\n", buf.String())
+	assert.Len(t, h, 3, "the handler's headers are not modified")
+
+	// Test: 304 keeps Content-Length, and a chunked response ends without
+	// writing the last chunk
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(NOT_MODIFIED))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.Error(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(headers.Headers{"checksum": "abc"}))
+	assert.Equal(t, Done, w.State)
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 304 Not Modified\r\n"))
+	assert.Contains(t, buf.String(), "\r\ncontent-length: 5\r\n")
+	assert.Contains(t, buf.String(), "\r\ndate: Sun, 06 Nov 1994 08:49:37 GMT\r\n")
+	assert.NotContains(t, strings.ToLower(buf.String()), "transfer-encoding")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"), "nothing follows the header section")
+
+	// Test: Interim responses never carry framing fields or a Date
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteInterim(EARLY_HINTS, headers.Headers{"link": "</a.css>", "content-length": "0"}))
+	assert.Equal(t, "HTTP/1.1 103 Early Hints\r\nlink: </a.css>\r\n\r\n", buf.String())
+}
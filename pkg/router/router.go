@@ -0,0 +1,132 @@
+// Package router dispatches requests to handlers by method and path.
+//
+// Besides the registered routes, a Router answers on its own:
+//   - HEAD requests for paths with a GET handler, by running that handler
+//     (the server drops the body of HEAD responses),
+//   - OPTIONS requests, including the server-wide "OPTIONS *", with 204 No
+//     Content and an Allow header listing the supported methods,
+//   - 405 Method Not Allowed with an Allow header for known paths, and 404
+//     Not Found for unknown ones.
+//
+// Example:
+//
+//	r := router.New()
+//	r.Handle("GET", "/items", listItems)
+//	r.Handle("POST", "/items", createItem)
+//	s, err := server.Serve(8080, r.ServeRequest)
+package router
+
+import (
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"slices"
+	"strings"
+)
+
+// Router maps a method and an exact path to a handler.
+type Router struct {
+	// routes maps a path to its handlers by method.
+	routes map[string]map[string]server.Handler
+	// NotFound handles requests for unknown paths. It defaults to a plain
+	// 404 Not Found response.
+	NotFound server.Handler
+}
+
+// New creates an empty Router.
+func New() *Router {
+	return &Router{routes: make(map[string]map[string]server.Handler)}
+}
+
+// Handle registers handler for requests with method and path. The path is
+// matched exactly, ignoring the query string. A later registration for the
+// same method and path replaces the earlier one.
+func (r *Router) Handle(method, path string, handler server.Handler) {
+	methods, ok := r.routes[path]
+	if !ok {
+		methods = make(map[string]server.Handler)
+		r.routes[path] = methods
+	}
+	methods[strings.ToUpper(method)] = handler
+}
+
+// ServeRequest dispatches req to the matching handler. It has the signature
+// of server.Handler, so it can be passed to server.Serve.
+func (r *Router) ServeRequest(w *response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	target := req.RequestLine.RequestTarget
+
+	if target == "*" {
+		if method == "OPTIONS" {
+			writeEmpty(w, response.NO_CONTENT, r.allMethods())
+			return
+		}
+		writeEmpty(w, response.BAD_REQUEST, nil)
+		return
+	}
+
+	path, _, _ := strings.Cut(target, "?")
+	methods, ok := r.routes[path]
+	if !ok {
+		if r.NotFound != nil {
+			r.NotFound(w, req)
+			return
+		}
+		writeEmpty(w, response.NOT_FOUND, nil)
+		return
+	}
+
+	if handler, ok := methods[method]; ok {
+		handler(w, req)
+		return
+	}
+	if handler, ok := methods["GET"]; ok && method == "HEAD" {
+		handler(w, req)
+		return
+	}
+	if method == "OPTIONS" {
+		writeEmpty(w, response.NO_CONTENT, allowed(methods))
+		return
+	}
+	writeEmpty(w, response.METHOD_NOT_ALLOWED, allowed(methods))
+}
+
+// allMethods returns the methods supported by any route.
+func (r *Router) allMethods() []string {
+	all := make(map[string]server.Handler)
+	for _, methods := range r.routes {
+		for method, handler := range methods {
+			all[method] = handler
+		}
+	}
+	return allowed(all)
+}
+
+// allowed returns the sorted methods supported by a route, adding HEAD when
+// GET is handled and OPTIONS, which is always answered.
+func allowed(methods map[string]server.Handler) []string {
+	list := []string{"OPTIONS"}
+	for method := range methods {
+		list = append(list, method)
+	}
+	if _, ok := methods["GET"]; ok {
+		list = append(list, "HEAD")
+	}
+	slices.Sort(list)
+	return slices.Compact(list)
+}
+
+// writeEmpty writes an empty response with statusCode, listing methods in
+// an Allow header unless it is nil.
+func writeEmpty(w *response.Writer, statusCode response.StatusCode, methods []string) {
+	h := headers.NewHeaders()
+	if methods != nil {
+		h["allow"] = strings.Join(methods, ", ")
+	}
+	if statusCode != response.NO_CONTENT {
+		h["content-length"] = "0"
+	}
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(h)
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// textHandler answers with body as a fixed-length response.
+func textHandler(body string) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody([]byte(body))
+	}
+}
+
+// chunkedHandler answers with body in chunks followed by a trailer.
+func chunkedHandler(w *response.Writer, req *request.Request) {
+	w.WriteStatusLine(response.OK)
+	w.WriteHeaders(headers.Headers{"transfer-encoding": "chunked", "trailer": "x-done"})
+	w.WriteChunkedBody([]byte("chunk"))
+	w.WriteChunkedBodyDone()
+	w.WriteTrailers(headers.Headers{"x-done": "yes"})
+}
+
+// roundTrip sends a raw request to s and returns the raw response.
+func roundTrip(t *testing.T, s *server.Server, method, target string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = fmt.Fprintf(conn, "%s %s HTTP/1.1\r\nHost: localhost\r\n\r\n", method, target)
+	require.NoError(t, err)
+	res, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(res)
+}
+
+func TestRouter(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/items", textHandler("all items"))
+	r.Handle("post", "/items", textHandler("created"))
+	r.Handle("GET", "/stream", chunkedHandler)
+	r.Handle("DELETE", "/items/1", textHandler("deleted"))
+	s, err := server.Serve(0, r.ServeRequest)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: Dispatch by method, ignoring the query string
+	res := roundTrip(t, s, "GET", "/items?page=2")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\nall items"))
+	res = roundTrip(t, s, "POST", "/items")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\ncreated"))
+
+	// Test: HEAD runs the GET handler without sending the body
+	res = roundTrip(t, s, "HEAD", "/items")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, res, "content-length: 9\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n"))
+	assert.NotContains(t, res, "all items")
+
+	// Test: HEAD of a chunked response drops chunks and trailers
+	res = roundTrip(t, s, "HEAD", "/stream")
+	assert.Contains(t, res, "transfer-encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(res, "\r\n\r\n"))
+	assert.NotContains(t, res, "chunk\r\n")
+	assert.NotContains(t, res, "x-done: yes")
+
+	// Test: OPTIONS lists the methods of a path
+	res = roundTrip(t, s, "OPTIONS", "/items")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 204 No Content\r\n"))
+	assert.Contains(t, res, "allow: GET, HEAD, OPTIONS, POST\r\n")
+
+	// Test: OPTIONS * lists the methods of every route
+	res = roundTrip(t, s, "OPTIONS", "*")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 204 No Content\r\n"))
+	assert.Contains(t, res, "allow: DELETE, GET, HEAD, OPTIONS, POST\r\n")
+
+	// Test: Unsupported methods and unknown paths
+	res = roundTrip(t, s, "PUT", "/items")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, res, "allow: GET, HEAD, OPTIONS, POST\r\n")
+	res = roundTrip(t, s, "GET", "/missing")
+	assert.True(t, strings.HasPrefix(res, "HTTP/1.1 404 Not Found\r\n"))
+}
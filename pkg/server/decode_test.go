@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rawLengthHandler echoes the body, followed by the length of the raw body.
+func rawLengthHandler(w *response.Writer, req *request.Request) {
+	body := []byte(fmt.Sprintf("%s %d", req.Body, len(req.RawBody)))
+	w.WriteStatusLine(response.OK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func TestDecodeRequestBodies(t *testing.T) {
+	s, err := Serve(0, rawLengthHandler)
+	require.NoError(t, err)
+	defer s.Close()
+	s.DecodeRequestBodies(100)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("hello"))
+	zw.Close()
+	compressed := bytes.Clone(buf.Bytes())
+
+	send := func(coding string, body []byte) (*http.Response, string) {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Encoding: %s\r\nContent-Length: %d\r\n\r\n", coding, len(body))
+		conn.Write(body)
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		data, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(data)
+	}
+
+	// Test: The handler sees the decoded body over HTTP/1.1
+	res, body := send("gzip", compressed)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, fmt.Sprintf("hello %d", len(compressed)), body)
+
+	// Test: Unknown codings are answered with 415 and the supported ones
+	res, _ = send("br", []byte("data"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+	assert.Equal(t, "gzip, deflate", res.Header.Get("Accept-Encoding"))
+
+	// Test: Bodies decoding beyond the limit are answered with 413
+	buf.Reset()
+	zw.Reset(&buf)
+	zw.Write(make([]byte, 1000))
+	zw.Close()
+	res, _ = send("gzip", buf.Bytes())
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+
+	// Test: Corrupt bodies are answered with 400, not a closed connection
+	res, _ = send("gzip", compressed[:len(compressed)-4])
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = send("deflate", []byte("not deflate data"))
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// Test: HTTP/2 request bodies are decoded too
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/", s.Listener.Addr()), bytes.NewReader(compressed))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	res, err = client.Do(req)
+	require.NoError(t, err)
+	data, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 2, res.ProtoMajor)
+	assert.Equal(t, fmt.Sprintf("hello %d", len(compressed)), string(data))
+
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://%s/", s.Listener.Addr()), bytes.NewReader([]byte("data")))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "compress")
+	res, err = client.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+}
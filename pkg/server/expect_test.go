@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// uploadHandler rejects bodies larger than 10 bytes and echoes the others.
+func uploadHandler(w *response.Writer, req *request.Request) {
+	n, _ := strconv.Atoi(req.Headers.Get("Content-Length"))
+	if n > 10 {
+		body := []byte("too large")
+		w.WriteStatusLine(response.CONTENT_TOO_LARGE)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+		return
+	}
+
+	body, err := req.ReadBody()
+	if err != nil {
+		return
+	}
+	w.WriteStatusLine(response.OK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// readHead reads a response status line and header section.
+func readHead(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+	var head strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		head.WriteString(line)
+		if line == "\r\n" {
+			return head.String()
+		}
+	}
+}
+
+func TestExpectContinue(t *testing.T) {
+	s, err := Serve(0, uploadHandler)
+	require.NoError(t, err)
+	defer s.Close()
+	s.DeferExpectedBodies()
+
+	dial := func(head string) (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		_, err = io.WriteString(conn, head)
+		require.NoError(t, err)
+		return conn, bufio.NewReader(conn)
+	}
+
+	// Test: 100 Continue is sent once the handler reads the body
+	conn, reader := dial("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n", readHead(t, reader))
+	_, err = io.WriteString(conn, "hello")
+	require.NoError(t, err)
+	assert.Contains(t, readHead(t, reader), "HTTP/1.1 200 OK\r\n")
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: Rejected before the body is sent
+	_, reader = dial("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5000\r\nExpect: 100-continue\r\n\r\n")
+	assert.True(t, strings.HasPrefix(readHead(t, reader), "HTTP/1.1 413 Content Too Large\r\n"))
+
+	// Test: A body sent without waiting is read without 100 Continue
+	_, reader = dial("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\nhello")
+	res, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(res), "HTTP/1.1 200 OK\r\n"))
+	assert.NotContains(t, string(res), "100 Continue")
+
+	// Test: Unknown expectations are refused
+	_, reader = dial("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: something-else\r\n\r\nhello")
+	assert.True(t, strings.HasPrefix(readHead(t, reader), "HTTP/1.1 417 Expectation Failed\r\n"))
+}
+
+func TestExpectContinueWithoutDeferral(t *testing.T) {
+	// echo reads req.Body directly, like handlers unaware of deferral
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(req.Body)))
+		w.WriteBody(req.Body)
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+
+	// Test: 100 Continue is sent and the body read before the handler runs
+	reader := bufio.NewReader(conn)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n", readHead(t, reader))
+	_, err = io.WriteString(conn, "hello")
+	require.NoError(t, err)
+	assert.Contains(t, readHead(t, reader), "HTTP/1.1 200 OK\r\n")
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+}
+
+func TestHijackDeferredBody(t *testing.T) {
+	hijacked := make(chan string, 1)
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		conn, buffered, err := w.Hijack()
+		if err != nil {
+			hijacked <- err.Error()
+			return
+		}
+		defer conn.Close()
+		hijacked <- string(buffered)
+	})
+	require.NoError(t, err)
+	defer s.Close()
+	s.DeferExpectedBodies()
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Test: The part of a deferred body read with the headers is handed over
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\nhello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", <-hijacked)
+}
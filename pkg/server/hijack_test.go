@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHijack(t *testing.T) {
+	hijacked := make(chan struct{})
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		conn, buffered, err := w.Hijack()
+		if err != nil {
+			return
+		}
+
+		// Test: The conn outlives the handler
+		go func() {
+			defer conn.Close()
+			<-hijacked
+			reader := bufio.NewReader(io.MultiReader(strings.NewReader(string(buffered)), conn))
+			line, _ := reader.ReadString('\n')
+			io.WriteString(conn, "echo "+line)
+		}()
+
+		// Test: Writes after a hijack fail
+		_, err = w.WriteBody([]byte("late"))
+		if err == nil {
+			io.WriteString(conn, "write after hijack succeeded\n")
+		}
+	})
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the first line after the request is already buffered by the server
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\nbuffered ")
+	require.NoError(t, err)
+
+	// Test: Closing the server leaves the hijacked conn open
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, s.Close())
+	close(hijacked)
+
+	_, err = io.WriteString(conn, "line\n")
+	require.NoError(t, err)
+	res, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "echo buffered line\n", string(res))
+}
+
+func TestCloseClosesConnections(t *testing.T) {
+	started := make(chan struct{})
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		close(started)
+		time.Sleep(time.Second)
+	})
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+
+	// Test: Connections still being served are closed
+	<-started
+	require.NoError(t, s.Close())
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	res, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
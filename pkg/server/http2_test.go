@@ -0,0 +1,288 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sp41414/goHttp/pkg/cookie"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoHandler answers with the method, target, protocol version and body of
+// the request, streaming larger bodies with chunked encoding and trailers.
+func echoHandler(w *response.Writer, req *request.Request) {
+	body := []byte(fmt.Sprintf("%s %s %s %s", req.RequestLine.Method, req.RequestLine.RequestTarget, req.RequestLine.HttpVersion, req.Body))
+	if req.RequestLine.RequestTarget == "/hints" {
+		w.WriteEarlyHints("</style.css>; rel=preload")
+		w.WriteEarlyHints("</app.js>; rel=preload")
+	}
+	if req.RequestLine.RequestTarget != "/chunked" {
+		w.WriteStatusLine(response.OK)
+		h := response.GetDefaultHeaders(len(body))
+		h.OverrideValue("X-Host", req.Headers.Get("Host"))
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+		return
+	}
+
+	w.WriteStatusLine(response.OK)
+	h := headers.NewHeaders()
+	h.Add("Transfer-Encoding", "chunked")
+	h.Add("Trailer", "X-Length")
+	w.WriteHeaders(h)
+	size := 0
+	for i := 0; i < 100; i++ {
+		chunk := []byte(strings.Repeat("x", 1000))
+		n, _ := w.WriteChunkedBody(chunk)
+		size += n
+	}
+	w.WriteChunkedBodyDone()
+	w.WriteTrailers(headers.Headers{"x-length": fmt.Sprint(size)})
+}
+
+func TestHTTP2OverTLS(t *testing.T) {
+	pair := writeSelfSignedCert(t, t.TempDir(), "localhost", "localhost")
+	s, err := ServeTLS(0, echoHandler, pair.CertFile, pair.KeyFile)
+	require.NoError(t, err)
+	defer s.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	url := fmt.Sprintf("https://localhost:%d", s.Listener.Addr().(*net.TCPAddr).Port)
+
+	// Test: Request negotiated with ALPN h2
+	res, err := client.Post(url+"/echo", "text/plain", strings.NewReader("ping"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 2, res.ProtoMajor)
+	assert.Equal(t, "POST /echo 2 ping", string(body))
+	assert.Equal(t, fmt.Sprintf("localhost:%d", s.Listener.Addr().(*net.TCPAddr).Port), res.Header.Get("X-Host"))
+
+	// Test: Early hints are sent as interim HEADERS frames
+	var hints []string
+	trace := &httptrace.ClientTrace{Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+		hints = append(hints, fmt.Sprintf("%d %s", code, header.Get("Link")))
+		return nil
+	}}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), "GET", url+"/hints", nil)
+	require.NoError(t, err)
+	res, err = client.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{"103 </style.css>; rel=preload", "103 </app.js>; rel=preload"}, hints)
+
+	// Test: Chunked responses become DATA frames with trailers, larger than
+	// the initial flow control window
+	res, err = client.Get(url + "/chunked")
+	require.NoError(t, err)
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 2, res.ProtoMajor)
+	assert.Len(t, body, 100000)
+	assert.Equal(t, "100000", res.Trailer.Get("X-Length"))
+}
+
+func TestHTTP2PriorKnowledge(t *testing.T) {
+	s, err := Serve(0, echoHandler)
+	require.NoError(t, err)
+	defer s.Close()
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	url := fmt.Sprintf("http://%s", s.Listener.Addr())
+
+	// Test: Concurrent streams on one connection
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			res, err := client.Post(fmt.Sprintf("%s/%d", url, i), "text/plain", strings.NewReader("body"))
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			if err == nil && string(body) != fmt.Sprintf("POST /%d 2 body", i) {
+				err = fmt.Errorf("unexpected body %q", body)
+			}
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	// Test: A client waiting for 100 Continue is answered before the body
+	expectClient := &http.Client{Transport: &http.Transport{Protocols: protocols, ExpectContinueTimeout: time.Minute}}
+	req, err := http.NewRequest("POST", url+"/expect", strings.NewReader("body"))
+	require.NoError(t, err)
+	req.Header.Set("Expect", "100-continue")
+	res, err := expectClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, "POST /expect 2 body", string(body))
+
+	// Test: HTTP/1.1 still works on the same port
+	res, err = http.Get(url + "/plain")
+	require.NoError(t, err)
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 1, res.ProtoMajor)
+	assert.Equal(t, "GET /plain 1.1 ", string(body))
+}
+
+func TestHTTP2Upgrade(t *testing.T) {
+	s, err := Serve(0, echoHandler)
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Test: Upgrade request is answered with 101 and then over HTTP/2
+	_, err = io.WriteString(conn, "GET /upgrade HTTP/1.1\r\n"+
+		"Host: localhost\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\n"+
+		"Upgrade: h2c\r\n"+
+		"HTTP2-Settings: AAMAAABkAAQAAP__\r\n"+
+		"\r\n")
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols\r\n", status)
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+	}
+
+	_, err = io.WriteString(conn, "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+	require.NoError(t, err)
+	_, err = conn.Write([]byte{0, 0, 0, 4, 0, 0, 0, 0, 0})
+	require.NoError(t, err)
+
+	// read frames until stream 1 ends, collecting its DATA
+	var data []byte
+	for {
+		var hdr [9]byte
+		_, err := io.ReadFull(reader, hdr[:])
+		require.NoError(t, err)
+		payload := make([]byte, int(hdr[0])<<16|int(hdr[1])<<8|int(hdr[2]))
+		_, err = io.ReadFull(reader, payload)
+		require.NoError(t, err)
+		streamID := uint32(hdr[5])<<24 | uint32(hdr[6])<<16 | uint32(hdr[7])<<8 | uint32(hdr[8])
+		if hdr[3] == 0 && streamID == 1 {
+			data = append(data, payload...)
+			if hdr[4]&1 != 0 {
+				break
+			}
+		}
+	}
+	assert.Equal(t, "GET /upgrade 1.1 ", string(data))
+}
+
+func TestServerAndDateHeaders(t *testing.T) {
+	s, err := Serve(0, echoHandler)
+	require.NoError(t, err)
+	defer s.Close()
+	s.SetServerHeader("goHttp")
+	url := fmt.Sprintf("http://%s/", s.Listener.Addr())
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	clients := map[int]*http.Client{
+		1: {Transport: &http.Transport{}},
+		2: {Transport: &http.Transport{Protocols: protocols}},
+	}
+
+	// Test: Both HTTP/1.1 and HTTP/2 responses get Date and Server headers
+	for major, client := range clients {
+		res, err := client.Get(url)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, major, res.ProtoMajor)
+		assert.Equal(t, "goHttp", res.Header.Get("Server"))
+		date, err := http.ParseTime(res.Header.Get("Date"))
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), date, 2*time.Second)
+	}
+}
+
+func TestCookies(t *testing.T) {
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		body := []byte("no session")
+		if c, err := req.Cookie("session"); err == nil {
+			body = []byte("session " + c.Value)
+		}
+		h := response.GetDefaultHeaders(len(body))
+		cookie.Set(h, &cookie.Cookie{Name: "session", Value: "new", Path: "/", HttpOnly: true})
+		cookie.Set(h, &cookie.Cookie{Name: "seen", Value: "1", Expires: time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)})
+		w.WriteStatusLine(response.OK)
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+	})
+	require.NoError(t, err)
+	defer s.Close()
+	url := fmt.Sprintf("http://%s/", s.Listener.Addr())
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	clients := map[int]*http.Client{
+		1: {Transport: &http.Transport{}},
+		2: {Transport: &http.Transport{Protocols: protocols}},
+	}
+
+	// Test: Request cookies are parsed, and each Set-Cookie is a separate
+	// field over both HTTP/1.1 and HTTP/2
+	for major, client := range clients {
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+		req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, major, res.ProtoMajor)
+		assert.Equal(t, "session abc", string(body))
+
+		cookies := map[string]*http.Cookie{}
+		for _, c := range res.Cookies() {
+			cookies[c.Name] = c
+		}
+		require.Len(t, cookies, 2, major)
+		assert.Equal(t, "new", cookies["session"].Value)
+		assert.True(t, cookies["session"].HttpOnly)
+		assert.Equal(t, 2030, cookies["seen"].Expires.Year())
+	}
+}
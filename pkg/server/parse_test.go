@@ -0,0 +1,58 @@
+package server
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseErrors(t *testing.T) {
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		response.WriteError(w, response.OK, "ok")
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	send := func(raw string) *response.Response {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = io.WriteString(conn, raw)
+		require.NoError(t, err)
+		res, err := response.ResponseFromReader(conn)
+		require.NoError(t, err)
+		return res
+	}
+
+	// Test: A valid request reaches the handler
+	res := send("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, response.OK, res.StatusCode)
+
+	// Test: A malformed request line is answered with 400
+	res = send("get / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, response.BAD_REQUEST, res.StatusCode)
+
+	// Test: Smuggling attempts are answered with 400
+	res = send("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+	assert.Equal(t, response.BAD_REQUEST, res.StatusCode)
+	res = send("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\nContent-Length: 4\r\n\r\nabcd")
+	assert.Equal(t, response.BAD_REQUEST, res.StatusCode)
+
+	// Test: A line that is too long is answered with 431
+	res = send("GET / HTTP/1.1\r\nHost: localhost\r\nX-Long: " + strings.Repeat("a", request.DefaultMaxLineLength) + "\r\n\r\n")
+	assert.Equal(t, response.REQUEST_HEADER_FIELDS_TOO_LARGE, res.StatusCode)
+
+	// Test: A header section that is too large is answered with 431
+	var fields strings.Builder
+	for fields.Len() <= request.DefaultMaxHeaderSize {
+		fields.WriteString("X-Field: " + strings.Repeat("a", 1000) + "\r\n")
+	}
+	res = send("GET / HTTP/1.1\r\nHost: localhost\r\n" + fields.String() + "\r\n")
+	assert.Equal(t, response.REQUEST_HEADER_FIELDS_TOO_LARGE, res.StatusCode)
+}
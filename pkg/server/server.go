@@ -4,11 +4,20 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/http2"
 	"github.com/sp41414/goHttp/pkg/request"
 	"github.com/sp41414/goHttp/pkg/response"
+	"io"
 	"log"
 	"net"
+	"strings"
+	"sync"
 	"sync/atomic"
 )
 
@@ -26,10 +35,31 @@ type HandlerError struct {
 	Message    string
 }
 
+// Error returns the message of the error.
+func (e *HandlerError) Error() string {
+	return e.Message
+}
+
 // Server represents an active HTTP server instance listening for connections.
 type Server struct {
 	Listener net.Listener
 	Closed   atomic.Bool // Closed tracks the server's shutdown status safely.
+	// reloader is the certificate reloader owned by the server, if any.
+	reloader *CertReloader
+
+	mu sync.Mutex
+	// conns tracks the connections being served, closed by Close.
+	// Hijacked connections are removed.
+	conns map[net.Conn]struct{}
+	// serverHeader is the Server header value added to responses.
+	serverHeader atomic.Pointer[string]
+	// decodeBodies enables decoding compressed request bodies of up to
+	// maxDecodedBodySize bytes, see DecodeRequestBodies.
+	decodeBodies       atomic.Bool
+	maxDecodedBodySize atomic.Int64
+	// deferBodies lets handlers read the bodies of requests expecting
+	// 100 Continue themselves, see DeferExpectedBodies.
+	deferBodies atomic.Bool
 }
 
 // Serve initializes and starts a new HTTP server on the specified port.
@@ -44,24 +74,113 @@ func Serve(port int, handler Handler) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	return serveListener(listener, handler), nil
+}
+
+// serveListener starts accepting connections from listener in a background
+// goroutine and returns the Server managing them.
+func serveListener(listener net.Listener, handler Handler) *Server {
 	s := &Server{
 		Listener: listener,
+		conns:    make(map[net.Conn]struct{}),
 	}
 	go s.listen(handler)
-	return s, nil
+	return s
 }
 
-// Close gracefully stops the server by closing the underlying TCP listener.
-// Any ongoing connection attempts will be rejected immediately.
+// Close stops the server by closing the underlying TCP listener and every
+// connection still being served. Any ongoing connection attempts will be
+// rejected immediately. Hijacked connections are left open.
 func (s *Server) Close() error {
 	s.Closed.Store(true)
+	if s.reloader != nil {
+		s.reloader.Close()
+	}
 	err := s.Listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// SetServerHeader makes the server add a "Server: name" header to every
+// response whose handler does not set one. An empty name, the default,
+// disables the header.
+func (s *Server) SetServerHeader(name string) {
+	s.serverHeader.Store(&name)
+}
+
+// DecodeRequestBodies makes the server decode request bodies sent with a
+// gzip or deflate Content-Encoding before running the handler, which sees
+// the decoded Body and the original in RawBody. Bodies decoding to more
+// than maxSize bytes are rejected with 413 Content Too Large, or with
+// request.DefaultMaxDecodedBodySize if maxSize is zero. Corrupt bodies are
+// rejected with 400 Bad Request, and other codings with 415 Unsupported
+// Media Type.
+//
+// Bodies deferred by DeferExpectedBodies are decoded by ReadBody.
+func (s *Server) DecodeRequestBodies(maxSize int64) {
+	s.maxDecodedBodySize.Store(maxSize)
+	s.decodeBodies.Store(true)
+}
+
+// DeferExpectedBodies makes the server run the handler of an HTTP/1.1
+// request with "Expect: 100-continue" as soon as its header section is
+// received. Its Body stays empty until the handler calls req.ReadBody, which
+// sends 100 Continue first, so a handler answering without reading it, e.g.
+// with 413 Content Too Large, spares the client sending the body.
+//
+// By default the server sends 100 Continue and reads the body before running
+// the handler, like for any other request. HTTP/2 request bodies are always
+// received before the handler runs.
+func (s *Server) DeferExpectedBodies() {
+	s.deferBodies.Store(true)
+}
+
+// wrapHandler wraps handler to apply the server configuration to every
+// request, whether it arrived over HTTP/1.1 or HTTP/2.
+func (s *Server) wrapHandler(handler Handler) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		if name := s.serverHeader.Load(); name != nil {
+			w.SetServerHeader(*name)
+		}
+		// HTTP/1.1 bodies are decoded by the parser
+		if s.decodeBodies.Load() && req.RequestLine.HttpVersion == "2" {
+			if err := req.DecodeBody(s.maxDecodedBodySize.Load()); err != nil {
+				writeDecodeError(w, err)
+				return
+			}
+		}
+		handler(w, req)
+	}
+}
+
+// track adds conn to the connections closed by Close. It returns false if
+// the server is already closed.
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Closed.Load() {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack removes conn from the connections managed by the server.
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
 // listen is the internal loop responsible for accepting new TCP connections.
 func (s *Server) listen(handler Handler) {
 	for {
@@ -79,14 +198,245 @@ func (s *Server) listen(handler Handler) {
 
 // handle manages the lifecycle of a single connection:
 // parsing the request, invoking the handler, and closing the connection.
+// Handlers may take over the connection for another protocol with
+// response.Writer.SwitchProtocols until they return, or for good with
+// response.Writer.Hijack.
+//
+// A request with "Expect: 100-continue" is answered with 100 Continue when
+// its body is read: before the handler runs, or when the handler calls
+// ReadBody if the server defers the body, see DeferExpectedBodies. Other
+// expectations are answered with 417 Expectation Failed.
+//
+// Responses to HEAD requests are written without their body, so handlers
+// can treat HEAD like GET.
+//
+// HTTP/2 is served instead when it was negotiated with ALPN over TLS, when a
+// cleartext connection starts with the HTTP/2 client preface (prior
+// knowledge), or when the request asks to upgrade to h2c.
 func (s *Server) handle(conn net.Conn, handler Handler) {
-	defer conn.Close()
-	req, err := request.RequestFromReader(conn)
+	hijacked := false
+	defer func() {
+		if !hijacked {
+			conn.Close()
+		}
+	}()
+	if !s.track(conn) {
+		return
+	}
+	defer s.untrack(conn)
+	handler = s.wrapHandler(handler)
+
+	tlsConn, isTLS := conn.(*tls.Conn)
+	if isTLS {
+		if err := tlsConn.Handshake(); err != nil {
+			log.Println(err)
+			return
+		}
+		if tlsConn.ConnectionState().NegotiatedProtocol == "h2" {
+			if err := http2.ServeConn(conn, conn, http2.Handler(handler)); err != nil {
+				log.Println(err)
+			}
+			return
+		}
+	}
+
+	reader := bufio.NewReader(conn)
+	if !isTLS && hasHTTP2Preface(reader) {
+		if err := http2.ServeConn(conn, reader, http2.Handler(handler)); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	body := &continueReader{r: reader}
+	req, err := request.RequestFromReaderWithOptions(body, request.Options{
+		DeferExpectedBody:  true,
+		DecodeBody:         s.decodeBodies.Load(),
+		MaxDecodedBodySize: s.maxDecodedBodySize.Load(),
+	})
 	if err != nil {
-		log.Println(err)
+		w := response.NewWriter(conn)
+		if !writeDecodeError(w, err) && !writeParseError(w, err) {
+			log.Println(err)
+		}
+		return
+	}
+	if req.Headers.Get("Expect") != "" && !req.ExpectsContinue() {
+		response.WriteError(response.NewWriter(conn), response.EXPECTATION_FAILED, "unsupported expectation")
+		return
+	}
+
+	deferred := req.ExpectsContinue() && s.deferBodies.Load()
+	if req.ExpectsContinue() && !deferred {
+		body.send = func() error {
+			return response.NewWriter(conn).WriteInterim(response.CONTINUE, nil)
+		}
+		if _, err := req.ReadBody(); err != nil {
+			w := response.NewWriter(conn)
+			if !writeDecodeError(w, err) && !writeParseError(w, err) {
+				log.Println(err)
+			}
+			return
+		}
+	}
+
+	// the unread data of a request with a deferred body is the start of
+	// that body, which the request reads itself, or hands over on hijack
+	if !deferred {
+		reader = withUnread(reader, req.Unread())
+	}
+	writer := response.NewConnWriter(conn, reader, func() []byte {
+		hijacked = true
+		s.untrack(conn)
+		if deferred {
+			return req.Unread()
+		}
+		return nil
+	})
+	if req.RequestLine.Method == "HEAD" {
+		writer.OmitBody()
+	}
+	if deferred {
+		body.send = func() error {
+			if writer.State != response.StatusLine {
+				// the handler already answered without the body
+				return nil
+			}
+			return writer.WriteInterim(response.CONTINUE, nil)
+		}
+	}
+
+	if !isTLS && isH2CUpgrade(req) {
+		if deferred {
+			if _, err := req.ReadBody(); err != nil {
+				log.Println(err)
+				return
+			}
+			reader = withUnread(reader, req.Unread())
+		}
+		_, err := writer.SwitchProtocols(headers.Headers{
+			"connection": "Upgrade",
+			"upgrade":    "h2c",
+		})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if err := http2.ServeUpgrade(conn, reader, http2.Handler(handler), req, req.Headers.Get("HTTP2-Settings")); err != nil {
+			log.Println(err)
+		}
 		return
 	}
 
-	writer := response.NewWriter(conn)
 	handler(writer, req)
 }
+
+// continueReader reads the request from r. Once send is set, it is called
+// before the next read, which is the first read of a body the client only
+// sends after receiving 100 Continue.
+type continueReader struct {
+	r    io.Reader
+	send func() error
+}
+
+func (c *continueReader) Read(p []byte) (int, error) {
+	if c.send != nil {
+		send := c.send
+		c.send = nil
+		if err := send(); err != nil {
+			return 0, err
+		}
+	}
+	return c.r.Read(p)
+}
+
+// writeParseError answers a request that could not be parsed before the
+// connection is closed: 431 if a line or the header section is too long,
+// and 400 otherwise. It reports whether err was such an error.
+func writeParseError(w *response.Writer, err error) bool {
+	var invalid *request.ParseError
+	switch {
+	case errors.Is(err, request.ErrLineTooLong), errors.Is(err, request.ErrHeaderTooLarge):
+		response.WriteError(w, response.REQUEST_HEADER_FIELDS_TOO_LARGE, "request header fields too large")
+	case errors.As(err, &invalid):
+		response.WriteError(w, response.BAD_REQUEST, "malformed request")
+	default:
+		return false
+	}
+	return true
+}
+
+// writeDecodeError answers a request whose body could not be decoded, see
+// DecodeRequestBodies. It reports whether err was such an error.
+func writeDecodeError(w *response.Writer, err error) bool {
+	var unsupported *request.UnsupportedEncodingError
+	var invalid *request.DecodeError
+	switch {
+	case errors.As(err, &unsupported):
+		// RFC 9110 section 15.5.16 suggests listing the supported codings
+		body := []byte(fmt.Sprintf("unsupported content coding %q", unsupported.Coding))
+		h := response.GetDefaultHeaders(len(body))
+		h["accept-encoding"] = "gzip, deflate"
+		w.WriteStatusLine(response.UNSUPPORTED_MEDIA_TYPE)
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+	case errors.Is(err, request.ErrDecodedBodyTooLarge):
+		response.WriteError(w, response.CONTENT_TOO_LARGE, "decoded body too large")
+	case errors.As(err, &invalid):
+		response.WriteError(w, response.BAD_REQUEST, "invalid body encoding")
+	default:
+		return false
+	}
+	return true
+}
+
+// hasHTTP2Preface reports whether the buffered connection starts with the
+// HTTP/2 client preface, without consuming it. It stops reading as soon as
+// the data differs, so an HTTP/1.1 request shorter than the preface does
+// not block it.
+func hasHTTP2Preface(reader *bufio.Reader) bool {
+	for i := 1; i <= len(http2.ClientPreface); i++ {
+		b, err := reader.Peek(i)
+		if err != nil || !strings.HasPrefix(http2.ClientPreface, string(b)) {
+			return false
+		}
+	}
+	return true
+}
+
+// withUnread returns a reader that yields unread, the data the request parser
+// read past the end of the request, and then the rest of reader. All data
+// that has been read from the connection stays buffered, so a hijacked
+// connection can hand it over.
+func withUnread(reader *bufio.Reader, unread []byte) *bufio.Reader {
+	if len(unread) == 0 {
+		return reader
+	}
+	buffered, _ := reader.Peek(reader.Buffered())
+	buffered = bytes.Clone(buffered)
+	reader.Discard(len(buffered))
+	n := len(unread) + len(buffered)
+	r := bufio.NewReaderSize(io.MultiReader(bytes.NewReader(unread), bytes.NewReader(buffered), reader), max(n, 4096))
+	r.Peek(n)
+	return r
+}
+
+// isH2CUpgrade reports whether req asks to upgrade the connection to
+// cleartext HTTP/2, as described in RFC 7540 section 3.2.
+func isH2CUpgrade(req *request.Request) bool {
+	return hasToken(req.Headers.Get("Upgrade"), "h2c") &&
+		hasToken(req.Headers.Get("Connection"), "upgrade") &&
+		hasToken(req.Headers.Get("Connection"), "http2-settings") &&
+		req.Headers.Get("HTTP2-Settings") != ""
+}
+
+// hasToken reports whether the comma-separated header value contains token,
+// compared case-insensitively.
+func hasToken(value, token string) bool {
+	for _, v := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
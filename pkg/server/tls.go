@@ -0,0 +1,211 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is how often ServeTLS checks its certificate and key
+// files for changes.
+const DefaultReloadInterval = 10 * time.Second
+
+// ServeTLS initializes and starts a new HTTPS server on the specified port
+// using the certificate and key stored in PEM files.
+//
+// The files are watched for changes and reloaded without restarting the
+// server, so renewed certificates are picked up automatically. ALPN
+// advertises "h2" and "http/1.1".
+//
+// Example:
+//
+//	s, err := server.ServeTLS(8443, handler, "cert.pem", "key.pem")
+func ServeTLS(port int, handler Handler, certFile, keyFile string) (*Server, error) {
+	reloader, err := NewCertReloader(CertPair{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := ServeTLSWithConfig(port, handler, &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.reloader = reloader
+	reloader.Watch(DefaultReloadInterval)
+	return s, nil
+}
+
+// ServeTLSWithConfig initializes and starts a new HTTPS server on the
+// specified port using config. The config must provide certificates through
+// Certificates or GetCertificate; a CertReloader can be used for SNI-based
+// selection between several certificates with hot reload.
+//
+// If config does not set NextProtos, ALPN advertises "h2" and "http/1.1".
+// Connections that negotiate "h2" are served with HTTP/2.
+func ServeTLSWithConfig(port int, handler Handler, config *tls.Config) (*Server, error) {
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, fmt.Errorf("Error: tls config has no certificates")
+	}
+
+	config = config.Clone()
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	return serveListener(tls.NewListener(listener, config), handler), nil
+}
+
+// CertPair names the PEM encoded certificate chain and private key files of
+// a single certificate.
+type CertPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertReloader serves certificates loaded from files and reloads them when
+// the files change. When it holds several certificates, GetCertificate
+// selects one based on the server name (SNI) requested by the client.
+type CertReloader struct {
+	mu    sync.RWMutex
+	pairs []CertPair
+	certs []*tls.Certificate
+	// modTimes records the modification times the certificates were loaded from.
+	modTimes [][2]time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewCertReloader loads the given certificates. The first pair is the
+// default certificate, used when no other certificate matches the client's
+// requested server name.
+func NewCertReloader(pairs ...CertPair) (*CertReloader, error) {
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("Error: no certificates provided")
+	}
+
+	c := &CertReloader{
+		pairs:    slices.Clone(pairs),
+		certs:    make([]*tls.Certificate, len(pairs)),
+		modTimes: make([][2]time.Time, len(pairs)),
+		stop:     make(chan struct{}),
+	}
+	for i := range pairs {
+		if err := c.load(i); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// GetCertificate returns the certificate for the server name requested in
+// hello. It is meant to be used as tls.Config.GetCertificate.
+func (c *CertReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if hello.ServerName != "" {
+		for _, cert := range c.certs {
+			if cert.Leaf != nil && cert.Leaf.VerifyHostname(hello.ServerName) == nil {
+				return cert, nil
+			}
+		}
+	}
+	return c.certs[0], nil
+}
+
+// Reload reloads every certificate whose certificate or key file has been
+// modified since it was last loaded. If a changed pair fails to load, the
+// previous certificate stays in use and the error is returned.
+func (c *CertReloader) Reload() error {
+	var firstErr error
+	for i, pair := range c.pairs {
+		certTime, keyTime, err := modTimes(pair)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		c.mu.RLock()
+		changed := !certTime.Equal(c.modTimes[i][0]) || !keyTime.Equal(c.modTimes[i][1])
+		c.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		if err := c.load(i); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Watch starts a background goroutine that calls Reload every interval until
+// Close is called. Reload errors are ignored so that a half-written file
+// does not replace a working certificate; it is retried on the next tick.
+func (c *CertReloader) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.Reload()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the goroutine started by Watch.
+func (c *CertReloader) Close() {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+}
+
+// load reads the certificate pair at index i and stores it.
+func (c *CertReloader) load(i int) error {
+	pair := c.pairs[i]
+	certTime, keyTime, err := modTimes(pair)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+	if err != nil {
+		return fmt.Errorf("Error: could not load certificate %s (%v)", pair.CertFile, err)
+	}
+
+	c.mu.Lock()
+	c.certs[i] = &cert
+	c.modTimes[i] = [2]time.Time{certTime, keyTime}
+	c.mu.Unlock()
+	return nil
+}
+
+// modTimes returns the modification times of the files in pair.
+func modTimes(pair CertPair) (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(pair.CertFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(pair.KeyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
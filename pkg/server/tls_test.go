@@ -0,0 +1,162 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSignedCert generates a self-signed certificate for the given DNS
+// names and writes it and its key as PEM files into dir.
+func writeSelfSignedCert(t *testing.T, dir, name string, dnsNames ...string) CertPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	pair := CertPair{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	require.NoError(t, os.WriteFile(pair.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(pair.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return pair
+}
+
+func helloHandler(w *response.Writer, req *request.Request) {
+	body := []byte("hello")
+	w.WriteStatusLine(response.OK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// getTLS sends a GET request over TLS to s and returns the connection state
+// and the raw response.
+func getTLS(t *testing.T, s *Server, serverName string) (tls.ConnectionState, string) {
+	t.Helper()
+	conn, err := tls.Dial("tcp", s.Listener.Addr().String(), &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"http/1.1"},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", serverName)
+	require.NoError(t, err)
+	res, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return conn.ConnectionState(), string(res)
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	pair := writeSelfSignedCert(t, dir, "localhost", "localhost")
+
+	// Test: Request over TLS with ALPN
+	s, err := ServeTLS(0, helloHandler, pair.CertFile, pair.KeyFile)
+	require.NoError(t, err)
+	defer s.Close()
+
+	state, res := getTLS(t, s, "localhost")
+	assert.Equal(t, "http/1.1", state.NegotiatedProtocol)
+	assert.Contains(t, res, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, res, "hello")
+
+	// Test: Missing certificate files
+	_, err = ServeTLS(0, helloHandler, filepath.Join(dir, "missing.crt"), pair.KeyFile)
+	require.Error(t, err)
+
+	// Test: Config without certificates
+	_, err = ServeTLSWithConfig(0, helloHandler, &tls.Config{})
+	require.Error(t, err)
+}
+
+func TestCertReloaderSNI(t *testing.T) {
+	dir := t.TempDir()
+	a := writeSelfSignedCert(t, dir, "a", "a.test")
+	b := writeSelfSignedCert(t, dir, "b", "b.test", "*.b.test")
+
+	reloader, err := NewCertReloader(a, b)
+	require.NoError(t, err)
+	s, err := ServeTLSWithConfig(0, helloHandler, &tls.Config{GetCertificate: reloader.GetCertificate})
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Test: Certificate selected by server name
+	state, _ := getTLS(t, s, "b.test")
+	assert.Equal(t, []string{"b.test", "*.b.test"}, state.PeerCertificates[0].DNSNames)
+	state, _ = getTLS(t, s, "www.b.test")
+	assert.Equal(t, []string{"b.test", "*.b.test"}, state.PeerCertificates[0].DNSNames)
+
+	// Test: Unknown server name falls back to the first certificate
+	state, _ = getTLS(t, s, "c.test")
+	assert.Equal(t, []string{"a.test"}, state.PeerCertificates[0].DNSNames)
+}
+
+func TestCertReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	pair := writeSelfSignedCert(t, dir, "site", "old.test")
+
+	reloader, err := NewCertReloader(pair)
+	require.NoError(t, err)
+	s, err := ServeTLSWithConfig(0, helloHandler, &tls.Config{GetCertificate: reloader.GetCertificate})
+	require.NoError(t, err)
+	defer s.Close()
+
+	state, _ := getTLS(t, s, "old.test")
+	assert.Equal(t, []string{"old.test"}, state.PeerCertificates[0].DNSNames)
+
+	// Test: Unchanged files are not reloaded
+	require.NoError(t, reloader.Reload())
+
+	// Test: Replaced files are picked up without restarting the server
+	writeSelfSignedCert(t, dir, "site", "new.test")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(pair.CertFile, future, future))
+	require.NoError(t, os.Chtimes(pair.KeyFile, future, future))
+	require.NoError(t, reloader.Reload())
+
+	state, _ = getTLS(t, s, "new.test")
+	assert.Equal(t, []string{"new.test"}, state.PeerCertificates[0].DNSNames)
+
+	// Test: A broken file keeps the previous certificate
+	require.NoError(t, os.WriteFile(pair.CertFile, []byte("not a certificate"), 0o600))
+	future = future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(pair.CertFile, future, future))
+	require.Error(t, reloader.Reload())
+
+	state, _ = getTLS(t, s, "new.test")
+	assert.Equal(t, []string{"new.test"}, state.PeerCertificates[0].DNSNames)
+}
@@ -0,0 +1,250 @@
+// Package sse implements Server-Sent Events, the text/event-stream format
+// from the HTML Living Standard, on top of a chunked response.Writer.
+//
+// Each event is written as its own chunk, so it reaches the client as soon
+// as it is sent:
+//
+//	func handler(w *response.Writer, req *request.Request) {
+//		stream, err := sse.NewStream(w, req, nil)
+//		if err != nil {
+//			return
+//		}
+//		defer stream.Close()
+//		for msg := range updates {
+//			if err := stream.Send(sse.Event{Data: msg}); err != nil {
+//				return // client disconnected
+//			}
+//		}
+//	}
+package sse
+
+import (
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a single server-sent event. Empty fields are omitted.
+type Event struct {
+	// ID sets the client's last event ID, sent back in the Last-Event-ID
+	// header when it reconnects.
+	ID string
+	// Event names the event type; clients dispatch unnamed events as
+	// "message".
+	Event string
+	// Data is the event payload. Each line is sent as its own data field.
+	Data string
+	// Retry tells the client how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// DefaultHeartbeatInterval is the default Options.HeartbeatInterval.
+const DefaultHeartbeatInterval = 15 * time.Second
+
+// Options configures a Stream.
+type Options struct {
+	// HeartbeatInterval is how often a comment line is sent while no events
+	// are, keeping intermediaries from closing the idle connection and
+	// detecting disconnected clients. It defaults to DefaultHeartbeatInterval
+	// if zero, and heartbeats are disabled if it is negative.
+	HeartbeatInterval time.Duration
+}
+
+// Stream writes server-sent events to a client. It is safe for concurrent
+// use.
+type Stream struct {
+	w           *response.Writer
+	lastEventID string
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+	// activity is signaled on every write, postponing the next heartbeat.
+	activity chan struct{}
+	// done is closed once the stream ends, by Close or by a failed write.
+	done chan struct{}
+}
+
+// NewStream starts an event stream in response to req by writing the status
+// line and the text/event-stream headers. opts may be nil.
+func NewStream(w *response.Writer, req *request.Request, opts *Options) (*Stream, error) {
+	err := w.WriteStatusLine(response.OK)
+	if err != nil {
+		return nil, err
+	}
+	err = w.WriteHeaders(headers.Headers{
+		"content-type":      "text/event-stream",
+		"cache-control":     "no-cache",
+		"transfer-encoding": "chunked",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stream{
+		w:           w,
+		lastEventID: req.Headers.Get("Last-Event-ID"),
+		activity:    make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	if interval := heartbeatInterval(opts); interval > 0 {
+		go s.heartbeat(interval)
+	}
+	return s, nil
+}
+
+// LastEventID returns the ID of the last event the client received before
+// reconnecting, taken from the Last-Event-ID request header. It is empty on
+// the first connection.
+func (s *Stream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done returns a channel that is closed when the stream ends, either because
+// Close was called or because a write failed. A client that disconnects
+// while the stream is idle is noticed by the next heartbeat, so Done closes
+// within about Options.HeartbeatInterval; with heartbeats disabled, only
+// once the next event is sent.
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send writes e as a single chunk. It fails if the event contains invalid
+// fields or the client disconnected, after which the stream is done.
+func (s *Stream) Send(e Event) error {
+	data, err := appendEvent(nil, e)
+	if err != nil {
+		return err
+	}
+	return s.write(data)
+}
+
+// Comment writes a comment line, which clients ignore.
+func (s *Stream) Comment(text string) error {
+	if strings.ContainsAny(text, "\r\n") {
+		return fmt.Errorf("Error: comment must be a single line")
+	}
+	return s.write([]byte(": " + text + "\n\n"))
+}
+
+// Close ends the event stream by finishing the chunked response and stops
+// the heartbeats. Clients reconnect after the retry delay unless told
+// otherwise by the application.
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return s.err
+	}
+	s.end(nil)
+
+	if _, err := s.w.WriteChunkedBodyDone(); err != nil {
+		return err
+	}
+	return s.w.WriteTrailers(headers.Headers{})
+}
+
+// write sends data as a single chunk.
+func (s *Stream) write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		if s.err != nil {
+			return s.err
+		}
+		return fmt.Errorf("Error: event stream is closed")
+	}
+
+	if _, err := s.w.WriteChunkedBody(data); err != nil {
+		s.end(err)
+		return err
+	}
+	select {
+	case s.activity <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// end marks the stream as done with err. s.mu must be held.
+func (s *Stream) end(err error) {
+	s.closed = true
+	s.err = err
+	close(s.done)
+}
+
+// heartbeatInterval returns the heartbeat interval configured by opts, or
+// zero if heartbeats are disabled.
+func heartbeatInterval(opts *Options) time.Duration {
+	if opts == nil || opts.HeartbeatInterval == 0 {
+		return DefaultHeartbeatInterval
+	}
+	if opts.HeartbeatInterval < 0 {
+		return 0
+	}
+	return opts.HeartbeatInterval
+}
+
+// heartbeat sends a comment whenever the stream has been idle for interval,
+// until the stream is done.
+func (s *Stream) heartbeat(interval time.Duration) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.activity:
+			timer.Reset(interval)
+		case <-timer.C:
+			if s.write([]byte(":\n\n")) != nil {
+				return
+			}
+			timer.Reset(interval)
+		}
+	}
+}
+
+// appendEvent appends the text/event-stream encoding of e to dst. Line
+// breaks in Data, whether CRLF, LF or CR, start a new data field.
+func appendEvent(dst []byte, e Event) ([]byte, error) {
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return nil, fmt.Errorf("Error: event id must be a single line without NUL")
+	}
+	if strings.ContainsAny(e.Event, "\r\n") {
+		return nil, fmt.Errorf("Error: event type must be a single line")
+	}
+
+	if e.ID != "" {
+		dst = append(dst, "id: "...)
+		dst = append(dst, e.ID...)
+		dst = append(dst, '\n')
+	}
+	if e.Event != "" {
+		dst = append(dst, "event: "...)
+		dst = append(dst, e.Event...)
+		dst = append(dst, '\n')
+	}
+	if e.Retry > 0 {
+		dst = append(dst, "retry: "...)
+		dst = strconv.AppendInt(dst, e.Retry.Milliseconds(), 10)
+		dst = append(dst, '\n')
+	}
+	// an event with only an id or retry field updates the client without
+	// dispatching anything
+	if e.Data != "" || e.Event != "" || (e.ID == "" && e.Retry == 0) {
+		data := strings.ReplaceAll(e.Data, "\r\n", "\n")
+		data = strings.ReplaceAll(data, "\r", "\n")
+		for _, line := range strings.Split(data, "\n") {
+			dst = append(dst, "data: "...)
+			dst = append(dst, line...)
+			dst = append(dst, '\n')
+		}
+	}
+	return append(dst, '\n'), nil
+}
@@ -0,0 +1,132 @@
+package sse
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{"data only", Event{Data: "hello"}, "data: hello\n\n"},
+		{"all fields", Event{ID: "7", Event: "update", Data: "x", Retry: 3 * time.Second}, "id: 7\nevent: update\nretry: 3000\ndata: x\n\n"},
+		{"multi-line data", Event{Data: "a\nb\r\nc\rd"}, "data: a\ndata: b\ndata: c\ndata: d\n\n"},
+		{"trailing newline", Event{Data: "a\n"}, "data: a\ndata: \n\n"},
+		{"empty event", Event{}, "data: \n\n"},
+		{"named event without data", Event{Event: "ping"}, "event: ping\ndata: \n\n"},
+		{"id only", Event{ID: "42"}, "id: 42\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := appendEvent(nil, tt.event)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	// Test: Fields that would break the framing are rejected
+	_, err := appendEvent(nil, Event{ID: "1\n2"})
+	require.Error(t, err)
+	_, err = appendEvent(nil, Event{ID: "1\x002"})
+	require.Error(t, err)
+	_, err = appendEvent(nil, Event{Event: "a\rb"})
+	require.Error(t, err)
+}
+
+func TestStream(t *testing.T) {
+	s, err := server.Serve(0, func(w *response.Writer, req *request.Request) {
+		stream, err := NewStream(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer stream.Close()
+		stream.Comment("welcome")
+		stream.Send(Event{ID: "1", Data: "resumed after " + stream.LastEventID()})
+		stream.Send(Event{Event: "multi", Data: "line 1\nline 2"})
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/events", s.Listener.Addr()), nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "41")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	// Test: Headers and events, with the Last-Event-ID of the reconnect
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+	assert.Equal(t, []string{"chunked"}, res.TransferEncoding)
+
+	var body strings.Builder
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		body.WriteString(scanner.Text() + "\n")
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, ": welcome\n\nid: 1\ndata: resumed after 41\n\nevent: multi\ndata: line 1\ndata: line 2\n\n", body.String())
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+	// Test: Heartbeats are on by default, so Done notices disconnects
+	assert.Equal(t, DefaultHeartbeatInterval, heartbeatInterval(nil))
+	assert.Equal(t, DefaultHeartbeatInterval, heartbeatInterval(&Options{}))
+
+	// Test: A negative interval disables them
+	assert.Equal(t, time.Duration(0), heartbeatInterval(&Options{HeartbeatInterval: -1}))
+	assert.Equal(t, time.Second, heartbeatInterval(&Options{HeartbeatInterval: time.Second}))
+}
+
+func TestStreamHeartbeatAndDisconnect(t *testing.T) {
+	stopped := make(chan error, 1)
+	s, err := server.Serve(0, func(w *response.Writer, req *request.Request) {
+		stream, err := NewStream(w, req, &Options{HeartbeatInterval: 20 * time.Millisecond})
+		if err != nil {
+			stopped <- err
+			return
+		}
+		<-stream.Done()
+		stopped <- stream.Send(Event{Data: "too late"})
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	_, err = fmt.Fprint(conn, "GET /events HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+
+	// Test: Idle streams send heartbeat comments
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line == ":\n" {
+			break
+		}
+	}
+
+	// Test: The stream ends once the client disconnects
+	conn.Close()
+	select {
+	case err := <-stopped:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not notice the disconnect")
+	}
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// deflateResponse is the extension response sent when permessage-deflate is
+// negotiated. Without context takeover every message is compressed on its
+// own, so no compression state is kept between messages.
+const deflateResponse = "permessage-deflate; server_no_context_takeover; client_no_context_takeover"
+
+// deflateTail is appended to a received message before inflating it: the
+// empty stored block removed by the sender (RFC 7692 section 7.2.2),
+// followed by a final empty block so the reader ends cleanly.
+const deflateTail = "\x00\x00\xff\xff\x01\x00\x00\xff\xff"
+
+// errTooLarge is returned by decompress when a message inflates beyond the
+// size limit.
+var errTooLarge = errors.New("websocket: decompressed message too large")
+
+var flateWriterPool = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+// acceptDeflate reports whether the Sec-WebSocket-Extensions header value
+// contains a permessage-deflate offer this server can accept, see RFC 7692
+// section 7.1.
+func acceptDeflate(value string) bool {
+	for _, offer := range strings.Split(value, ",") {
+		params := strings.Split(offer, ";")
+		if strings.TrimSpace(params[0]) != "permessage-deflate" {
+			continue
+		}
+		if acceptDeflateParams(params[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptDeflateParams reports whether the parameters of a permessage-deflate
+// offer are valid and can be honored.
+func acceptDeflateParams(params []string) bool {
+	seen := make(map[string]bool)
+	for _, param := range params {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(param), "=")
+		name = strings.TrimSpace(name)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if seen[name] {
+			return false
+		}
+		seen[name] = true
+
+		switch name {
+		case "server_no_context_takeover", "client_no_context_takeover":
+			if hasValue {
+				return false
+			}
+		case "client_max_window_bits":
+			if hasValue && !isWindowBits(value) {
+				return false
+			}
+		case "server_max_window_bits":
+			// compress/flate always uses a 32 KiB window
+			if value != "15" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isWindowBits reports whether s is a valid window size between 8 and 15.
+func isWindowBits(s string) bool {
+	switch s {
+	case "8", "9", "10", "11", "12", "13", "14", "15":
+		return true
+	}
+	return false
+}
+
+// compress deflates a message payload, removing the trailing empty block.
+func compress(p []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	fw := flateWriterPool.Get().(*flate.Writer)
+	defer flateWriterPool.Put(fw)
+	fw.Reset(&buf)
+
+	if _, err := fw.Write(p); err != nil {
+		return nil, err
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte(deflateTail[:4])), nil
+}
+
+// decompress inflates a received message payload of at most limit bytes.
+func decompress(p []byte, limit int64) ([]byte, error) {
+	fr := flate.NewReader(io.MultiReader(bytes.NewReader(p), strings.NewReader(deflateTail)))
+	defer fr.Close()
+
+	msg, err := io.ReadAll(io.LimitReader(fr, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(msg)) > limit {
+		return nil, errTooLarge
+	}
+	return msg, nil
+}
@@ -0,0 +1,429 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// MessageType is the type of a data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// opcode identifies the type of a frame, see RFC 6455 section 5.2.
+type opcode byte
+
+const (
+	opContinuation opcode = 0x0
+	opText         opcode = 0x1
+	opBinary       opcode = 0x2
+	opClose        opcode = 0x8
+	opPing         opcode = 0x9
+	opPong         opcode = 0xa
+)
+
+// isControl reports whether op is a control frame opcode.
+func (op opcode) isControl() bool {
+	return op&0x8 != 0
+}
+
+// Frame header bits.
+const (
+	finBit  = 0x80
+	rsv1Bit = 0x40
+	rsvBits = 0x70
+	maskBit = 0x80
+)
+
+// maxControlPayload is the largest payload of a control frame.
+const maxControlPayload = 125
+
+// CloseCode is a status code sent in a close frame, see RFC 6455 section 7.4.
+type CloseCode uint16
+
+const (
+	CloseNormal             CloseCode = 1000
+	CloseGoingAway          CloseCode = 1001
+	CloseProtocolError      CloseCode = 1002
+	CloseUnsupportedData    CloseCode = 1003
+	CloseNoStatus           CloseCode = 1005
+	CloseAbnormal           CloseCode = 1006
+	CloseInvalidPayload     CloseCode = 1007
+	ClosePolicyViolation    CloseCode = 1008
+	CloseMessageTooBig      CloseCode = 1009
+	CloseMandatoryExtension CloseCode = 1010
+	CloseInternalError      CloseCode = 1011
+)
+
+// isValid reports whether code may be sent in a close frame. Codes such as
+// 1005, 1006 and 1015 only report a closure locally, and codes below 3000
+// that RFC 6455 section 7.4.1 does not define are reserved.
+func (code CloseCode) isValid() bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// CloseError is returned by ReadMessage when the peer closed the
+// connection. The close frame has already been answered.
+type CloseError struct {
+	Code   CloseCode
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed with code %d %s", e.Code, e.Reason)
+}
+
+// ErrCloseSent is returned when writing a message after Close.
+var ErrCloseSent = errors.New("websocket: close frame already sent")
+
+// Conn is a WebSocket connection on the server side.
+//
+// One goroutine may read while others write; writes are serialized.
+// Pings are answered and pongs handled by ReadMessage, so a handler that
+// sends messages should keep a goroutine reading.
+type Conn struct {
+	rw          io.ReadWriter
+	subprotocol string
+	compress    bool
+	maxSize     int64
+	pongHandler func(data []byte)
+
+	// readErr is the error that ended reading, returned by every later
+	// call to ReadMessage.
+	readErr error
+
+	wmu       sync.Mutex
+	closeSent bool
+}
+
+// Subprotocol returns the negotiated subprotocol, or an empty string if none
+// was selected.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// ReadMessage reads the next data message, reassembling fragmented messages
+// and decompressing them if needed. Control frames received in between are
+// handled: pings are answered with pongs, and a close frame is answered and
+// returned as a *CloseError.
+//
+// Protocol violations close the connection with the matching close code and
+// are returned as errors.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+
+	var (
+		msgType    MessageType
+		msg        []byte
+		inMessage  bool
+		compressed bool
+	)
+	for {
+		op, fin, rsv1, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, c.endRead(err)
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, true, false, payload); err != nil && err != ErrCloseSent {
+				return 0, nil, c.endRead(err)
+			}
+			continue
+		case opPong:
+			if c.pongHandler != nil {
+				c.pongHandler(payload)
+			}
+			continue
+		case opClose:
+			return 0, nil, c.endRead(c.handleClose(payload))
+		case opText, opBinary:
+			if inMessage {
+				return 0, nil, c.endRead(c.fail(CloseProtocolError, "new message before the previous one ended"))
+			}
+			inMessage = true
+			msgType = MessageType(op)
+			compressed = rsv1
+		case opContinuation:
+			if !inMessage {
+				return 0, nil, c.endRead(c.fail(CloseProtocolError, "continuation frame outside of a message"))
+			}
+		}
+
+		if int64(len(msg))+int64(len(payload)) > c.maxSize {
+			return 0, nil, c.endRead(c.fail(CloseMessageTooBig, "message exceeds size limit"))
+		}
+		msg = append(msg, payload...)
+		if !fin {
+			continue
+		}
+
+		if compressed {
+			msg, err = decompress(msg, c.maxSize)
+			if err == errTooLarge {
+				return 0, nil, c.endRead(c.fail(CloseMessageTooBig, "message exceeds size limit"))
+			}
+			if err != nil {
+				return 0, nil, c.endRead(c.fail(CloseInvalidPayload, "invalid compressed data"))
+			}
+		}
+		if msgType == TextMessage && !utf8.Valid(msg) {
+			return 0, nil, c.endRead(c.fail(CloseInvalidPayload, "text message is not valid UTF-8"))
+		}
+		return msgType, msg, nil
+	}
+}
+
+// endRead records err as the error returned by every later read.
+func (c *Conn) endRead(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	c.readErr = err
+	return err
+}
+
+// readFrame reads and unmasks the next frame, validating its header.
+func (c *Conn) readFrame() (op opcode, fin, rsv1 bool, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.rw, hdr[:]); err != nil {
+		return 0, false, false, nil, err
+	}
+	fin = hdr[0]&finBit != 0
+	rsv1 = hdr[0]&rsv1Bit != 0
+	op = opcode(hdr[0] & 0x0f)
+
+	switch {
+	case hdr[0]&rsvBits&^rsv1Bit != 0:
+		return 0, false, false, nil, c.fail(CloseProtocolError, "reserved bits set")
+	case rsv1 && (!c.compress || op.isControl() || op == opContinuation):
+		return 0, false, false, nil, c.fail(CloseProtocolError, "unexpected RSV1 bit")
+	case op > opBinary && !op.isControl(), op > opPong:
+		return 0, false, false, nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", op))
+	case hdr[1]&maskBit == 0:
+		return 0, false, false, nil, c.fail(CloseProtocolError, "client frame is not masked")
+	}
+
+	length := uint64(hdr[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return 0, false, false, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return 0, false, false, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length>>63 != 0 {
+			return 0, false, false, nil, c.fail(CloseProtocolError, "invalid payload length")
+		}
+	}
+
+	if op.isControl() && (!fin || length > maxControlPayload) {
+		return 0, false, false, nil, c.fail(CloseProtocolError, "invalid control frame")
+	}
+	if length > uint64(c.maxSize) {
+		return 0, false, false, nil, c.fail(CloseMessageTooBig, "message exceeds size limit")
+	}
+
+	var key [4]byte
+	if _, err := io.ReadFull(c.rw, key[:]); err != nil {
+		return 0, false, false, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return 0, false, false, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= key[i%4]
+	}
+	return op, fin, rsv1, payload, nil
+}
+
+// handleClose answers a close frame from the peer and returns the resulting
+// *CloseError.
+func (c *Conn) handleClose(payload []byte) error {
+	code, reason := CloseNoStatus, ""
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		code = CloseCode(binary.BigEndian.Uint16(payload))
+		reason = string(payload[2:])
+		if !code.isValid() {
+			return c.fail(CloseProtocolError, fmt.Sprintf("invalid close code %d", code))
+		}
+		if !utf8.ValidString(reason) {
+			return c.fail(CloseInvalidPayload, "close reason is not valid UTF-8")
+		}
+	}
+
+	// echo the status code, see RFC 6455 section 5.5.1
+	var echo []byte
+	if code != CloseNoStatus {
+		echo = binary.BigEndian.AppendUint16(nil, uint16(code))
+	}
+	if err := c.writeFrame(opClose, true, false, echo); err != nil && err != ErrCloseSent {
+		return err
+	}
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// fail sends a close frame with code and returns an error describing the
+// protocol violation.
+func (c *Conn) fail(code CloseCode, reason string) error {
+	c.Close(code, reason)
+	return fmt.Errorf("websocket: %s", reason)
+}
+
+// WriteMessage sends p as a single data message of type t, compressed if
+// permessage-deflate was negotiated.
+func (c *Conn) WriteMessage(t MessageType, p []byte) error {
+	if t != TextMessage && t != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", t)
+	}
+	if c.compress {
+		compressed, err := compress(p)
+		if err != nil {
+			return err
+		}
+		return c.writeFrame(opcode(t), true, true, compressed)
+	}
+	return c.writeFrame(opcode(t), true, false, p)
+}
+
+// NextWriter returns a writer that sends a message of type t in fragments,
+// one frame per call to Write. Close sends the final fragment. No other data
+// message may be written until the writer is closed; control frames may.
+// Fragmented messages are not compressed.
+func (c *Conn) NextWriter(t MessageType) (io.WriteCloser, error) {
+	if t != TextMessage && t != BinaryMessage {
+		return nil, fmt.Errorf("websocket: invalid message type %d", t)
+	}
+	return &messageWriter{conn: c, op: opcode(t)}, nil
+}
+
+// messageWriter sends a fragmented message.
+type messageWriter struct {
+	conn   *Conn
+	op     opcode
+	closed bool
+}
+
+// Write sends p as the next fragment of the message.
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("websocket: write to closed message writer")
+	}
+	if err := w.conn.writeFrame(w.op, false, false, p); err != nil {
+		return 0, err
+	}
+	w.op = opContinuation
+	return len(p), nil
+}
+
+// Close sends the final, empty fragment of the message.
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.conn.writeFrame(w.op, true, false, nil)
+}
+
+// Ping sends a ping with data, which must be at most 125 bytes. The peer's
+// pong is passed to Options.PongHandler by ReadMessage.
+func (c *Conn) Ping(data []byte) error {
+	if len(data) > maxControlPayload {
+		return fmt.Errorf("websocket: ping payload exceeds %d bytes", maxControlPayload)
+	}
+	return c.writeFrame(opPing, true, false, data)
+}
+
+// Close starts the closing handshake by sending a close frame with code and
+// reason. The peer's answer is returned by ReadMessage as a *CloseError.
+// The underlying connection is closed when the handler returns.
+//
+// Codes that must not be sent, such as CloseNoStatus and CloseAbnormal, and
+// reasons that are not valid UTF-8 are rejected. A reason longer than 123
+// bytes is cut at the last character that fits.
+func (c *Conn) Close(code CloseCode, reason string) error {
+	if !code.isValid() {
+		return fmt.Errorf("websocket: close code %d must not be sent", code)
+	}
+	if !utf8.ValidString(reason) {
+		return fmt.Errorf("websocket: close reason is not valid UTF-8")
+	}
+	if max := maxControlPayload - 2; len(reason) > max {
+		for max > 0 && !utf8.RuneStart(reason[max]) {
+			max--
+		}
+		reason = reason[:max]
+	}
+
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	err := c.writeFrame(opClose, true, false, payload)
+	if err == ErrCloseSent {
+		return nil
+	}
+	return err
+}
+
+// writeFrame sends a single unmasked frame. Once a close frame is sent, no
+// other frame may follow.
+func (c *Conn) writeFrame(op opcode, fin, rsv1 bool, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+
+	b := byte(op)
+	if fin {
+		b |= finBit
+	}
+	if rsv1 {
+		b |= rsv1Bit
+	}
+	frame := make([]byte, 0, 10+len(payload))
+	frame = append(frame, b)
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	if _, err := c.rw.Write(frame); err != nil {
+		return err
+	}
+	if op == opClose {
+		c.closeSent = true
+	}
+	return nil
+}
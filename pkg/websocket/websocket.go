@@ -0,0 +1,193 @@
+// Package websocket implements the server side of the WebSocket protocol
+// defined in RFC 6455, with optional permessage-deflate compression from
+// RFC 7692.
+//
+// A handler upgrades a request with Upgrade and then exchanges messages on
+// the returned Conn until it returns:
+//
+//	func handler(w *response.Writer, req *request.Request) {
+//		conn, err := websocket.Upgrade(w, req, nil)
+//		if err != nil {
+//			return
+//		}
+//		for {
+//			t, msg, err := conn.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			conn.WriteMessage(t, msg)
+//		}
+//	}
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"github.com/sp41414/goHttp/pkg/headers"
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"strings"
+)
+
+// acceptGUID is appended to the client's key to compute
+// Sec-WebSocket-Accept, see RFC 6455 section 1.3.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// DefaultMaxMessageSize is the largest message accepted when
+// Options.MaxMessageSize is not set.
+const DefaultMaxMessageSize = 16 << 20
+
+// Options configures the handshake and the resulting connection.
+type Options struct {
+	// Subprotocols lists the supported subprotocols in order of preference.
+	// The first one also requested by the client is selected.
+	Subprotocols []string
+	// EnableCompression negotiates permessage-deflate if the client offers it.
+	EnableCompression bool
+	// MaxMessageSize limits the size of a received message, after
+	// decompression. Larger messages close the connection with
+	// CloseMessageTooBig.
+	MaxMessageSize int64
+	// CheckOrigin reports whether a request with the given Origin header is
+	// allowed. All origins are allowed if it is nil.
+	CheckOrigin func(origin string) bool
+	// PongHandler is called with the payload of every received pong.
+	PongHandler func(data []byte)
+}
+
+// HandshakeError is returned by Upgrade when the request is not a valid
+// WebSocket handshake. The error response has already been written.
+type HandshakeError struct {
+	StatusCode response.StatusCode
+	Message    string
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("websocket: handshake failed: %s", e.Message)
+}
+
+// IsUpgrade reports whether req asks to upgrade the connection to the
+// WebSocket protocol.
+func IsUpgrade(req *request.Request) bool {
+	return hasToken(req.Headers.Get("Upgrade"), "websocket") &&
+		hasToken(req.Headers.Get("Connection"), "upgrade")
+}
+
+// Upgrade validates the opening handshake in req, answers it with
+// 101 Switching Protocols and returns the WebSocket connection. opts may be
+// nil.
+//
+// An invalid handshake is answered with 400 Bad Request, 403 Forbidden for a
+// rejected origin or 426 Upgrade Required for an unsupported version, and a
+// *HandshakeError is returned.
+// The connection is only usable until the handler returns.
+func Upgrade(w *response.Writer, req *request.Request, opts *Options) (*Conn, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	key, herr := checkHandshake(req, opts)
+	if herr != nil {
+		writeError(w, herr)
+		return nil, herr
+	}
+
+	h := headers.Headers{
+		"upgrade":              "websocket",
+		"connection":           "Upgrade",
+		"sec-websocket-accept": acceptKey(key),
+	}
+	if protocol := selectSubprotocol(req, opts.Subprotocols); protocol != "" {
+		h["sec-websocket-protocol"] = protocol
+	}
+	compress := opts.EnableCompression && acceptDeflate(req.Headers.Get("Sec-WebSocket-Extensions"))
+	if compress {
+		h["sec-websocket-extensions"] = deflateResponse
+	}
+
+	rw, err := w.SwitchProtocols(h)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSize := opts.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxMessageSize
+	}
+	return &Conn{
+		rw:          rw,
+		subprotocol: h["sec-websocket-protocol"],
+		compress:    compress,
+		maxSize:     maxSize,
+		pongHandler: opts.PongHandler,
+	}, nil
+}
+
+// checkHandshake validates the client's opening handshake as described in
+// RFC 6455 section 4.2.1 and returns its Sec-WebSocket-Key.
+func checkHandshake(req *request.Request, opts *Options) (string, *HandshakeError) {
+	if req.RequestLine.Method != "GET" {
+		return "", &HandshakeError{response.BAD_REQUEST, "method must be GET"}
+	}
+	if req.Headers.Get("Host") == "" {
+		return "", &HandshakeError{response.BAD_REQUEST, "missing Host header"}
+	}
+	if !IsUpgrade(req) {
+		return "", &HandshakeError{response.BAD_REQUEST, "missing Upgrade: websocket or Connection: Upgrade"}
+	}
+	if req.Headers.Get("Sec-WebSocket-Version") != "13" {
+		return "", &HandshakeError{response.UPGRADE_REQUIRED, "unsupported Sec-WebSocket-Version"}
+	}
+
+	key := strings.TrimSpace(req.Headers.Get("Sec-WebSocket-Key"))
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return "", &HandshakeError{response.BAD_REQUEST, "invalid Sec-WebSocket-Key"}
+	}
+
+	if opts.CheckOrigin != nil && !opts.CheckOrigin(req.Headers.Get("Origin")) {
+		return "", &HandshakeError{response.FORBIDDEN, "origin not allowed"}
+	}
+	return key, nil
+}
+
+// writeError answers a failed handshake.
+func writeError(w *response.Writer, herr *HandshakeError) {
+	body := []byte(herr.Message)
+	h := response.GetDefaultHeaders(len(body))
+	if herr.StatusCode == response.UPGRADE_REQUIRED {
+		h["sec-websocket-version"] = "13"
+	}
+	w.WriteStatusLine(herr.StatusCode)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+// acceptKey computes the Sec-WebSocket-Accept value for key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// selectSubprotocol returns the first supported subprotocol requested by the
+// client, or an empty string if there is none.
+func selectSubprotocol(req *request.Request, supported []string) string {
+	requested := req.Headers.Get("Sec-WebSocket-Protocol")
+	for _, protocol := range supported {
+		if hasToken(requested, protocol) {
+			return protocol
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether the comma-separated header value contains token,
+// compared case-insensitively.
+func hasToken(value, token string) bool {
+	for _, v := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/sp41414/goHttp/pkg/request"
+	"github.com/sp41414/goHttp/pkg/response"
+	"github.com/sp41414/goHttp/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer starts a server that upgrades every request with opts and
+// echoes messages back. The text message "fragment" is answered in three
+// fragments.
+func echoServer(t *testing.T, opts *Options) *server.Server {
+	t.Helper()
+	s, err := server.Serve(0, func(w *response.Writer, req *request.Request) {
+		conn, err := Upgrade(w, req, opts)
+		if err != nil {
+			return
+		}
+		for {
+			msgType, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(msg) != "fragment" {
+				conn.WriteMessage(msgType, msg)
+				continue
+			}
+			mw, _ := conn.NextWriter(msgType)
+			mw.Write([]byte("frag"))
+			mw.Write([]byte("ment"))
+			mw.Close()
+		}
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// dial sends an opening handshake with extra header lines and returns the
+// connection and the raw response head.
+func dial(t *testing.T, s *server.Server, extra string) (net.Conn, *bufio.Reader, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = io.WriteString(conn, "GET /chat HTTP/1.1\r\n"+
+		"Host: localhost\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		extra+
+		"\r\n")
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	var head strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		head.WriteString(line)
+		if line == "\r\n" {
+			return conn, reader, head.String()
+		}
+	}
+}
+
+// writeFrame sends a client frame. first is the first header byte, holding
+// the FIN and RSV bits and the opcode.
+func writeFrame(t *testing.T, conn net.Conn, first byte, payload []byte, masked bool) {
+	t.Helper()
+	frame := []byte{first}
+	var maskFlag byte
+	if masked {
+		maskFlag = maskBit
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskFlag|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskFlag|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskFlag|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if masked {
+		key := []byte{0x37, 0xfa, 0x21, 0x3d}
+		frame = append(frame, key...)
+		for i, b := range payload {
+			frame = append(frame, b^key[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := conn.Write(frame)
+	require.NoError(t, err)
+}
+
+// readFrame reads a server frame and returns its first header byte and
+// payload.
+func readFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var hdr [2]byte
+	_, err := io.ReadFull(reader, hdr[:])
+	require.NoError(t, err)
+	require.Zero(t, hdr[1]&maskBit, "server frames must not be masked")
+
+	length := uint64(hdr[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(reader, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(reader, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	require.NoError(t, err)
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	require.NoError(t, err)
+	return hdr[0], payload
+}
+
+// closePayload builds a close frame payload.
+func closePayload(code CloseCode, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+func TestHandshake(t *testing.T) {
+	s := echoServer(t, &Options{
+		Subprotocols: []string{"v2.chat", "chat"},
+		CheckOrigin:  func(origin string) bool { return origin != "http://evil.test" },
+	})
+
+	// Test: Accept key from RFC 6455 section 1.3 and subprotocol selection
+	_, _, head := dial(t, s, "Sec-WebSocket-Version: 13\r\nSec-WebSocket-Protocol: chat, v2.chat\r\n")
+	assert.True(t, strings.HasPrefix(head, "HTTP/1.1 101 Switching Protocols\r\n"))
+	assert.Contains(t, head, "sec-websocket-accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n")
+	assert.Contains(t, head, "sec-websocket-protocol: v2.chat\r\n")
+	assert.Contains(t, head, "upgrade: websocket\r\n")
+	assert.NotContains(t, head, "sec-websocket-extensions")
+
+	// Test: Unsupported version
+	_, _, head = dial(t, s, "Sec-WebSocket-Version: 8\r\n")
+	assert.True(t, strings.HasPrefix(head, "HTTP/1.1 426 Upgrade Required\r\n"))
+	assert.Contains(t, head, "sec-websocket-version: 13\r\n")
+
+	// Test: Rejected origin
+	_, _, head = dial(t, s, "Sec-WebSocket-Version: 13\r\nOrigin: http://evil.test\r\n")
+	assert.True(t, strings.HasPrefix(head, "HTTP/1.1 403 Forbidden\r\n"))
+
+	// Test: Invalid key
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: short\r\n\r\n")
+	require.NoError(t, err)
+	res, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(res), "HTTP/1.1 400 Bad Request\r\n"))
+}
+
+func TestMessages(t *testing.T) {
+	s := echoServer(t, nil)
+	conn, reader, _ := dial(t, s, "Sec-WebSocket-Version: 13\r\n")
+
+	// Test: Single frame text message
+	writeFrame(t, conn, finBit|byte(opText), []byte("hello"), true)
+	first, payload := readFrame(t, reader)
+	assert.Equal(t, finBit|byte(opText), first)
+	assert.Equal(t, "hello", string(payload))
+
+	// Test: Fragmented binary message with a ping in between
+	writeFrame(t, conn, byte(opBinary), []byte("Hel"), true)
+	writeFrame(t, conn, finBit|byte(opPing), []byte("are you there"), true)
+	writeFrame(t, conn, finBit|byte(opContinuation), []byte("lo"), true)
+	first, payload = readFrame(t, reader)
+	assert.Equal(t, finBit|byte(opPong), first)
+	assert.Equal(t, "are you there", string(payload))
+	first, payload = readFrame(t, reader)
+	assert.Equal(t, finBit|byte(opBinary), first)
+	assert.Equal(t, "Hello", string(payload))
+
+	// Test: Messages with 16-bit and 64-bit lengths
+	for _, size := range []int{1000, 70000} {
+		msg := []byte(strings.Repeat("x", size))
+		writeFrame(t, conn, finBit|byte(opBinary), msg, true)
+		_, payload = readFrame(t, reader)
+		assert.Len(t, payload, size)
+	}
+
+	// Test: Server sends a fragmented message
+	writeFrame(t, conn, finBit|byte(opText), []byte("fragment"), true)
+	var parts []string
+	for {
+		first, payload = readFrame(t, reader)
+		parts = append(parts, string(payload))
+		if first&finBit != 0 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"frag", "ment", ""}, parts)
+
+	// Test: Close handshake echoes the status code
+	writeFrame(t, conn, finBit|byte(opClose), closePayload(CloseNormal, "bye"), true)
+	first, payload = readFrame(t, reader)
+	assert.Equal(t, finBit|byte(opClose), first)
+	assert.Equal(t, closePayload(CloseNormal, ""), payload)
+}
+
+func TestProtocolErrors(t *testing.T) {
+	s := echoServer(t, &Options{MaxMessageSize: 1024})
+
+	tests := []struct {
+		name   string
+		first  byte
+		data   []byte
+		masked bool
+		code   CloseCode
+	}{
+		{"unmasked frame", finBit | byte(opText), []byte("hi"), false, CloseProtocolError},
+		{"invalid UTF-8", finBit | byte(opText), []byte{0xff, 0xfe}, true, CloseInvalidPayload},
+		{"message too big", finBit | byte(opBinary), make([]byte, 2000), true, CloseMessageTooBig},
+		{"orphan continuation", finBit | byte(opContinuation), []byte("x"), true, CloseProtocolError},
+		{"reserved bit", finBit | 0x20 | byte(opText), []byte("x"), true, CloseProtocolError},
+		{"compressed without extension", finBit | rsv1Bit | byte(opText), []byte("x"), true, CloseProtocolError},
+		{"unknown opcode", finBit | 0x3, []byte("x"), true, CloseProtocolError},
+		{"fragmented control frame", byte(opPing), []byte("x"), true, CloseProtocolError},
+		{"invalid close code", finBit | byte(opClose), closePayload(1005, ""), true, CloseProtocolError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, reader, _ := dial(t, s, "Sec-WebSocket-Version: 13\r\n")
+			writeFrame(t, conn, tt.first, tt.data, tt.masked)
+			first, payload := readFrame(t, reader)
+			assert.Equal(t, finBit|byte(opClose), first)
+			require.GreaterOrEqual(t, len(payload), 2)
+			assert.Equal(t, tt.code, CloseCode(binary.BigEndian.Uint16(payload)))
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	s := echoServer(t, &Options{EnableCompression: true})
+
+	// Test: Offers with unsupported parameters are declined
+	_, _, head := dial(t, s, "Sec-WebSocket-Version: 13\r\nSec-WebSocket-Extensions: permessage-deflate; server_max_window_bits=10\r\n")
+	assert.NotContains(t, head, "sec-websocket-extensions")
+
+	// Test: The first acceptable offer is negotiated
+	conn, reader, head := dial(t, s, "Sec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Extensions: permessage-deflate; server_max_window_bits=10, permessage-deflate; client_max_window_bits\r\n")
+	assert.Contains(t, head, fmt.Sprintf("sec-websocket-extensions: %s\r\n", deflateResponse))
+
+	// Test: Compressed messages are inflated and answered compressed
+	msg := strings.Repeat("compress me ", 100)
+	compressed, err := compress([]byte(msg))
+	require.NoError(t, err)
+	writeFrame(t, conn, finBit|rsv1Bit|byte(opText), compressed, true)
+	first, payload := readFrame(t, reader)
+	assert.Equal(t, finBit|rsv1Bit|byte(opText), first)
+	assert.Less(t, len(payload), len(msg))
+	decompressed, err := decompress(payload, DefaultMaxMessageSize)
+	require.NoError(t, err)
+	assert.Equal(t, msg, string(decompressed))
+
+	// Test: Uncompressed messages are still accepted
+	writeFrame(t, conn, finBit|byte(opText), []byte("plain"), true)
+	_, payload = readFrame(t, reader)
+	decompressed, err = decompress(payload, DefaultMaxMessageSize)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(decompressed))
+}
+
+func TestClose(t *testing.T) {
+	// Test: Codes that must not be sent are rejected
+	for _, code := range []CloseCode{0, 999, 1004, CloseNoStatus, CloseAbnormal, 1015, 2000, 5000} {
+		var buf bytes.Buffer
+		conn := &Conn{rw: &buf}
+		assert.Error(t, conn.Close(code, ""), "code %d", code)
+		assert.Zero(t, buf.Len())
+	}
+
+	// Test: A reason that is not valid UTF-8 is rejected
+	conn := &Conn{rw: &bytes.Buffer{}}
+	assert.Error(t, conn.Close(CloseNormal, "\xff"))
+
+	// Test: A long reason is cut at a character boundary
+	var buf bytes.Buffer
+	conn = &Conn{rw: &buf}
+	require.NoError(t, conn.Close(CloseGoingAway, strings.Repeat("é", 70)))
+	first, payload := readFrame(t, bufio.NewReader(&buf))
+	assert.Equal(t, finBit|byte(opClose), first)
+	assert.Equal(t, closePayload(CloseGoingAway, strings.Repeat("é", 61)), payload)
+
+	// Test: Application codes are sent
+	buf.Reset()
+	conn = &Conn{rw: &buf}
+	require.NoError(t, conn.Close(4000, "done"))
+	_, payload = readFrame(t, bufio.NewReader(&buf))
+	assert.Equal(t, closePayload(4000, "done"), payload)
+}